@@ -0,0 +1,206 @@
+package handlers
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/gin-gonic/gin"
+)
+
+const archiveManifestName = "MANIFEST.json"
+
+var errArchiveTooLarge = errors.New("archive too large")
+
+type archiveEntry struct {
+	key      string
+	name     string // the entry's name in the zip
+	size     int64
+	modified time.Time
+}
+
+type archiveManifest struct {
+	Included []string          `json:"included"`
+	Skipped  map[string]string `json:"skipped"`
+}
+
+// listArchiveEntries lists everything under prefix, refusing listings over
+// maxItems objects or maxSize bytes before anything is streamed.
+func listArchiveEntries(ctx context.Context, cl *awsClients, bucket, prefix string, maxItems int, maxSize int64) ([]archiveEntry, error) {
+	input := &s3.ListObjectsV2Input{Bucket: aws.String(bucket)}
+	if prefix != "" {
+		input.Prefix = aws.String(prefix)
+	}
+	var entries []archiveEntry
+	var total int64
+	paginator := s3.NewListObjectsV2Paginator(cl.bucketS3(ctx, bucket), input)
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, o := range page.Contents {
+			key := aws.ToString(o.Key)
+			if strings.HasSuffix(key, "/") {
+				continue // folder placeholder
+			}
+			total += aws.ToInt64(o.Size)
+			entries = append(entries, archiveEntry{key: key, size: aws.ToInt64(o.Size), modified: aws.ToTime(o.LastModified)})
+			if maxItems > 0 && len(entries) > maxItems {
+				return nil, fmt.Errorf("%w: more than %d objects under prefix", errArchiveTooLarge, maxItems)
+			}
+			if total > maxSize {
+				return nil, fmt.Errorf("%w: objects under prefix exceed %d bytes", errArchiveTooLarge, maxSize)
+			}
+		}
+	}
+	return entries, nil
+}
+
+// archiveEntryName names the zip entry for key, relative to prefix, or the
+// key's base name when key is the prefix itself. Names that could land
+// outside the directory a client extracts to, with a leading / or a ..
+// segment, are refused: S3 keys are arbitrary.
+func archiveEntryName(prefix, key string) (string, error) {
+	name := strings.TrimPrefix(key, prefix)
+	if prefix != "" && !strings.HasSuffix(prefix, "/") {
+		name = strings.TrimPrefix(name, "/") // the separator after the prefix
+	}
+	if name == "" {
+		name = path.Base(key)
+	}
+	if strings.HasPrefix(name, "/") || strings.HasPrefix(name, `\`) {
+		return "", errors.New("zip entry name would be absolute")
+	}
+	for _, segment := range strings.FieldsFunc(name, func(r rune) bool { return r == '/' || r == '\\' }) {
+		if segment == ".." {
+			return "", errors.New("zip entry name has a .. segment")
+		}
+	}
+	return path.Clean(name), nil
+}
+
+// archiveHandler streams every object under ?prefix= as one zip, without
+// temp files. The listing is checked against maxSize and MAX_RESPONSE_ITEMS
+// up front, and the whole download is bounded by timeout. An object that
+// can't be fetched fails the archive by default; with ?onError=skip it is
+// left out and listed in a trailing MANIFEST.json, as is an object whose key
+// can't be a safe entry name; without it such a key fails the archive with
+// a 422 before anything is sent. Once streaming has begun
+// a failure can only cut the zip short, leaving it without its central
+// directory so clients reject it rather than extract partial content.
+func archiveHandler(cl *awsClients, live *liveConfig, maxSize int64, timeout time.Duration) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		bucket, prefix := c.Param("bucket"), c.Query("prefix")
+		skip := false
+		switch c.DefaultQuery("onError", "fail") {
+		case "fail":
+		case "skip":
+			skip = true
+		default:
+			respondError(c, http.StatusBadRequest, "bad_request", "onError must be fail or skip")
+			return
+		}
+		ctx, cancel := context.WithTimeout(c.Request.Context(), timeout)
+		defer cancel()
+		logger := loggerFrom(ctx)
+
+		entries, err := listArchiveEntries(ctx, cl, bucket, prefix, live.get().MaxResponseItems, maxSize)
+		if err != nil {
+			if errors.Is(err, errArchiveTooLarge) {
+				respondError(c, http.StatusRequestEntityTooLarge, "too_large", err.Error())
+				return
+			}
+			respondS3Error(c, err)
+			return
+		}
+		if len(entries) == 0 {
+			respondError(c, http.StatusNotFound, "not_found", "no objects under prefix")
+			return
+		}
+		manifest := archiveManifest{Included: []string{}, Skipped: map[string]string{}}
+		named := entries[:0]
+		for _, e := range entries {
+			if e.name, err = archiveEntryName(prefix, e.key); err != nil {
+				if !skip {
+					respondError(c, http.StatusUnprocessableEntity, "unprocessable", fmt.Sprintf("object %q: %v", e.key, err))
+					return
+				}
+				logger.Warn("archive: skipping object", "key", e.key, "err", err)
+				manifest.Skipped[e.key] = "unsafe name"
+				continue
+			}
+			named = append(named, e)
+		}
+		entries = named
+
+		name := bucket
+		if p := strings.Trim(prefix, "/"); p != "" {
+			name += "-" + strings.ReplaceAll(p, "/", "-")
+		}
+		c.Header("Content-Type", "application/zip")
+		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name+".zip"))
+		c.Status(http.StatusOK)
+
+		client := cl.bucketS3(ctx, bucket)
+		zw := zip.NewWriter(c.Writer)
+		for _, e := range entries {
+			out, err := client.GetObject(ctx, &s3.GetObjectInput{Bucket: aws.String(bucket), Key: aws.String(e.key)})
+			if err != nil {
+				if skip && ctx.Err() == nil {
+					logger.Warn("archive: skipping object", "key", e.key, "err", err)
+					reason := apiErrorCode(err)
+					if reason == "" {
+						reason = "fetch failed"
+					}
+					manifest.Skipped[e.key] = reason
+					continue
+				}
+				logger.Error("archive: aborting", "key", e.key, "err", err)
+				return
+			}
+			err = writeArchiveEntry(zw, e, out.Body)
+			_ = out.Body.Close()
+			if err != nil {
+				logger.Error("archive: aborting", "key", e.key, "err", err)
+				return
+			}
+			manifest.Included = append(manifest.Included, e.key)
+		}
+		if skip {
+			w, err := zw.Create(archiveManifestName)
+			if err == nil {
+				err = json.NewEncoder(w).Encode(manifest)
+			}
+			if err != nil {
+				logger.Error("archive: writing manifest", "err", err)
+				return
+			}
+		}
+		if err := zw.Close(); err != nil {
+			logger.Error("archive: finishing zip", "err", err)
+		}
+	}
+}
+
+func writeArchiveEntry(zw *zip.Writer, e archiveEntry, body io.Reader) error {
+	w, err := zw.CreateHeader(&zip.FileHeader{
+		Name:     e.name,
+		Method:   zip.Deflate,
+		Modified: e.modified,
+	})
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(w, body)
+	return err
+}
@@ -0,0 +1,132 @@
+package handlers
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+func TestArchiveEntryNames(t *testing.T) {
+	tests := []struct {
+		name    string
+		prefix  string
+		keys    []string
+		onError string
+		status  int
+		entries []string // the zip's entries, in order
+		skipped []string
+	}{
+		{
+			name:    "relative to prefix",
+			prefix:  "reports/",
+			keys:    []string{"reports/a.csv", "reports/sub/./b.csv"},
+			entries: []string{"a.csv", "sub/b.csv"},
+		},
+		{
+			name:    "prefix without separator",
+			prefix:  "reports",
+			keys:    []string{"reports/a.csv"},
+			entries: []string{"a.csv"},
+		},
+		{
+			name:    "key is the prefix",
+			prefix:  "reports/q1.csv",
+			keys:    []string{"reports/q1.csv"},
+			entries: []string{"q1.csv"},
+		},
+		{
+			name:   "traversal fails",
+			prefix: "reports/",
+			keys:   []string{"reports/a.csv", "reports/../../etc/passwd"},
+			status: http.StatusUnprocessableEntity,
+		},
+		{
+			name:   "absolute fails",
+			prefix: "reports/",
+			keys:   []string{"reports//etc/passwd"},
+			status: http.StatusUnprocessableEntity,
+		},
+		{
+			name:    "unsafe skipped",
+			prefix:  "reports/",
+			keys:    []string{"reports/a.csv", "reports/x/../../../evil", "reports//etc/passwd", `reports/..\evil.bat`},
+			onError: "skip",
+			entries: []string{"a.csv", archiveManifestName},
+			skipped: []string{"reports/x/../../../evil", "reports//etc/passwd", `reports/..\evil.bat`},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := &fakeS3{
+				listObjectsV2: func(context.Context, *s3.ListObjectsV2Input) (*s3.ListObjectsV2Output, error) {
+					out := &s3.ListObjectsV2Output{}
+					for _, k := range tt.keys {
+						out.Contents = append(out.Contents, s3types.Object{Key: aws.String(k), Size: aws.Int64(4)})
+					}
+					return out, nil
+				},
+				getObject: func(_ context.Context, in *s3.GetObjectInput) (*s3.GetObjectOutput, error) {
+					return &s3.GetObjectOutput{Body: io.NopCloser(strings.NewReader(aws.ToString(in.Key)))}, nil
+				},
+			}
+			s := newTestServer(t, testConfig(t), testClients(fake, &fakeSSM{}))
+
+			target := "/buckets/reports/archive?prefix=" + tt.prefix
+			if tt.onError != "" {
+				target += "&onError=" + tt.onError
+			}
+			w := s.do(t, http.MethodGet, target, "")
+			if tt.status != 0 {
+				wantError(t, w, tt.status, "unprocessable")
+				if n := fake.count("GetObject"); n != 0 {
+					t.Errorf("GetObject calls = %d, want 0", n)
+				}
+				return
+			}
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d, want 200: %s", w.Code, w.Body)
+			}
+			zr, err := zip.NewReader(bytes.NewReader(w.Body.Bytes()), int64(w.Body.Len()))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var names []string
+			var manifest archiveManifest
+			for _, f := range zr.File {
+				names = append(names, f.Name)
+				if f.Name != archiveManifestName {
+					continue
+				}
+				r, err := f.Open()
+				if err != nil {
+					t.Fatal(err)
+				}
+				if err := json.NewDecoder(r).Decode(&manifest); err != nil {
+					t.Fatal(err)
+				}
+				r.Close()
+			}
+			if !slices.Equal(names, tt.entries) {
+				t.Errorf("entries = %q, want %q", names, tt.entries)
+			}
+			for _, key := range tt.skipped {
+				if manifest.Skipped[key] != "unsafe name" {
+					t.Errorf("manifest skipped[%q] = %q, want unsafe name", key, manifest.Skipped[key])
+				}
+			}
+			if n := fake.count("GetObject"); n != len(tt.keys)-len(tt.skipped) {
+				t.Errorf("GetObject calls = %d, want %d", n, len(tt.keys)-len(tt.skipped))
+			}
+		})
+	}
+}
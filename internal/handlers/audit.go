@@ -0,0 +1,107 @@
+package handlers
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+
+	"github.com/gin-gonic/gin"
+)
+
+// auditLogger writes one JSON event per parameter read, for the audit trail
+// of who read which parameter. It is separate from the access log and
+// never records values. A nil auditLogger logs nothing.
+type auditLogger struct {
+	logger *slog.Logger
+}
+
+// newAuditLogger opens the audit sink: "" disables auditing, "stdout" writes
+// to standard output and anything else is a file path appended to.
+func newAuditLogger(sink string) (*auditLogger, error) {
+	var w io.Writer
+	switch sink {
+	case "":
+		return nil, nil
+	case "stdout":
+		w = os.Stdout
+	default:
+		f, err := os.OpenFile(sink, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+		if err != nil {
+			return nil, fmt.Errorf("open audit log: %w", err)
+		}
+		w = f
+	}
+	return &auditLogger{logger: slog.New(slog.NewJSONHandler(w, nil))}, nil
+}
+
+func auditResult(status int) string {
+	switch {
+	case status < 400:
+		return "success"
+	case status == http.StatusNotFound:
+		return "not_found"
+	case status == http.StatusUnauthorized || status == http.StatusForbidden:
+		return "denied"
+	default:
+		return "error"
+	}
+}
+
+const auditParametersKey = "auditParameters"
+
+// setAuditParameters records the parameter names a request read beyond its
+// route's, such as batch-get's from the body or those a rendered template
+// pulled in, for the audit event to list.
+func setAuditParameters(c *gin.Context, names []string) {
+	c.Set(auditParametersKey, names)
+}
+
+func auditParametersFrom(c *gin.Context) []string {
+	v, _ := c.Get(auditParametersKey)
+	names, _ := v.([]string)
+	return names
+}
+
+// parameterReads audits h once it has run, recording the action (read,
+// history, watch, validate, diff, batch-get) and the parameter name of
+// single reads, the ?path=, ?left= and ?right= of hierarchy reads or the
+// names a handler set with setAuditParameters.
+func (a *auditLogger) parameterReads(action string, h gin.HandlerFunc) gin.HandlerFunc {
+	if a == nil {
+		return h
+	}
+	return func(c *gin.Context) {
+		h(c)
+		attrs := []any{
+			"event", "parameter_read",
+			"action", action,
+			"caller", principalFrom(c).ID,
+			"clientIp", c.ClientIP(),
+			"requestId", requestIDFrom(c.Request.Context()),
+			"status", c.Writer.Status(),
+			"result", auditResult(c.Writer.Status()),
+		}
+		hierarchy := false
+		for _, q := range []string{"path", "left", "right"} {
+			if v := c.Query(q); v != "" {
+				attrs = append(attrs, q, v)
+				hierarchy = true
+			}
+		}
+		if name := parameterName(c); name != "" && !hierarchy {
+			attrs = append(attrs, "parameter", name)
+		}
+		if names := auditParametersFrom(c); names != nil {
+			attrs = append(attrs, "parameters", names)
+		}
+		a.logger.Info("audit", attrs...)
+	}
+}
+
+// middleware audits the rest of the handler chain, including requests its
+// guards reject.
+func (a *auditLogger) middleware(action string) gin.HandlerFunc {
+	return a.parameterReads(action, func(c *gin.Context) { c.Next() })
+}
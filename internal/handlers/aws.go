@@ -0,0 +1,330 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsmiddleware "github.com/aws/aws-sdk-go-v2/aws/middleware"
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/aws/smithy-go/middleware"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	serviceS3  = "s3"
+	serviceSSM = "ssm"
+)
+
+// The *API interfaces are the parts of the SDK clients the service calls,
+// so fakes can stand in for them. s3API includes what the upload manager
+// and the bucket region lookup need, so both run on any implementation.
+type s3API interface {
+	manager.UploadAPIClient
+	HeadBucket(ctx context.Context, in *s3.HeadBucketInput, optFns ...func(*s3.Options)) (*s3.HeadBucketOutput, error)
+	ListBuckets(ctx context.Context, in *s3.ListBucketsInput, optFns ...func(*s3.Options)) (*s3.ListBucketsOutput, error)
+	GetBucketTagging(ctx context.Context, in *s3.GetBucketTaggingInput, optFns ...func(*s3.Options)) (*s3.GetBucketTaggingOutput, error)
+	GetBucketPolicy(ctx context.Context, in *s3.GetBucketPolicyInput, optFns ...func(*s3.Options)) (*s3.GetBucketPolicyOutput, error)
+	GetBucketAcl(ctx context.Context, in *s3.GetBucketAclInput, optFns ...func(*s3.Options)) (*s3.GetBucketAclOutput, error)
+	ListObjectsV2(ctx context.Context, in *s3.ListObjectsV2Input, optFns ...func(*s3.Options)) (*s3.ListObjectsV2Output, error)
+	HeadObject(ctx context.Context, in *s3.HeadObjectInput, optFns ...func(*s3.Options)) (*s3.HeadObjectOutput, error)
+	GetObject(ctx context.Context, in *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error)
+	CopyObject(ctx context.Context, in *s3.CopyObjectInput, optFns ...func(*s3.Options)) (*s3.CopyObjectOutput, error)
+	DeleteObject(ctx context.Context, in *s3.DeleteObjectInput, optFns ...func(*s3.Options)) (*s3.DeleteObjectOutput, error)
+	SelectObjectContent(ctx context.Context, in *s3.SelectObjectContentInput, optFns ...func(*s3.Options)) (*s3.SelectObjectContentOutput, error)
+}
+
+// s3Presigner is the part of s3.PresignClient the presign handlers use;
+// presigning is local, so it needs a real client but no network.
+type s3Presigner interface {
+	PresignGetObject(ctx context.Context, in *s3.GetObjectInput, optFns ...func(*s3.PresignOptions)) (*v4.PresignedHTTPRequest, error)
+	PresignPutObject(ctx context.Context, in *s3.PutObjectInput, optFns ...func(*s3.PresignOptions)) (*v4.PresignedHTTPRequest, error)
+}
+
+type ssmAPI interface {
+	GetParameter(ctx context.Context, in *ssm.GetParameterInput, optFns ...func(*ssm.Options)) (*ssm.GetParameterOutput, error)
+	GetParameters(ctx context.Context, in *ssm.GetParametersInput, optFns ...func(*ssm.Options)) (*ssm.GetParametersOutput, error)
+	GetParameterHistory(ctx context.Context, in *ssm.GetParameterHistoryInput, optFns ...func(*ssm.Options)) (*ssm.GetParameterHistoryOutput, error)
+	GetParametersByPath(ctx context.Context, in *ssm.GetParametersByPathInput, optFns ...func(*ssm.Options)) (*ssm.GetParametersByPathOutput, error)
+	DescribeParameters(ctx context.Context, in *ssm.DescribeParametersInput, optFns ...func(*ssm.Options)) (*ssm.DescribeParametersOutput, error)
+	PutParameter(ctx context.Context, in *ssm.PutParameterInput, optFns ...func(*ssm.Options)) (*ssm.PutParameterOutput, error)
+	DeleteParameter(ctx context.Context, in *ssm.DeleteParameterInput, optFns ...func(*ssm.Options)) (*ssm.DeleteParameterOutput, error)
+	ListTagsForResource(ctx context.Context, in *ssm.ListTagsForResourceInput, optFns ...func(*ssm.Options)) (*ssm.ListTagsForResourceOutput, error)
+}
+
+type sqsAPI interface {
+	SendMessage(ctx context.Context, in *sqs.SendMessageInput, optFns ...func(*sqs.Options)) (*sqs.SendMessageOutput, error)
+	ReceiveMessage(ctx context.Context, in *sqs.ReceiveMessageInput, optFns ...func(*sqs.Options)) (*sqs.ReceiveMessageOutput, error)
+	DeleteMessage(ctx context.Context, in *sqs.DeleteMessageInput, optFns ...func(*sqs.Options)) (*sqs.DeleteMessageOutput, error)
+}
+
+type kmsAPI interface {
+	Encrypt(ctx context.Context, in *kms.EncryptInput, optFns ...func(*kms.Options)) (*kms.EncryptOutput, error)
+	Decrypt(ctx context.Context, in *kms.DecryptInput, optFns ...func(*kms.Options)) (*kms.DecryptOutput, error)
+}
+
+type iamAPI interface {
+	SimulatePrincipalPolicy(ctx context.Context, in *iam.SimulatePrincipalPolicyInput, optFns ...func(*iam.Options)) (*iam.SimulatePrincipalPolicyOutput, error)
+}
+
+type stsAPI interface {
+	GetCallerIdentity(ctx context.Context, in *sts.GetCallerIdentityInput, optFns ...func(*sts.Options)) (*sts.GetCallerIdentityOutput, error)
+}
+
+type awsClients struct {
+	s3      s3API
+	ssm     ssmAPI
+	sqs     sqsAPI
+	kms     kmsAPI
+	iam     iamAPI
+	sts     stsAPI
+	regions *s3Regions
+	ssmIn   *ssmRegions
+	region  string
+	account string // from the startup GetCallerIdentity
+
+	// unavailable holds the startup probe error of each service that failed
+	// to initialize; routes backed by those services answer 503.
+	unavailable map[string]error
+}
+
+func newAWSClients(ctx context.Context, appCfg Config, m *metrics) (*awsClients, error) {
+	cfg, err := config.LoadDefaultConfig(ctx, // reads env vars automatically
+		config.WithAPIOptions([]func(*middleware.Stack) error{
+			awsmiddleware.AddUserAgentKeyValue(appCfg.UserAgentName, appCfg.VERSION),
+			addRequestIDUserAgent,
+			m.instrumentAWS,
+			newAWSCallLimits(appCfg.MaxConcurrentAWSCalls,
+				map[string]float64{serviceS3: appCfg.S3RPS, serviceSSM: appCfg.SSMRPS},
+				appCfg.AWSCallLimitWait, serviceS3, serviceSSM).apply,
+			addCallTimeout(appCfg.AWSCallTimeout),
+		}),
+		config.WithRetryer(newRetryer(appCfg)),
+	)
+	if err != nil {
+		return nil, err
+	}
+	if appCfg.AssumeRoleARN != "" {
+		cfg.Credentials = assumeRoleCredentials(sts.NewFromConfig(cfg), appCfg)
+	}
+
+	// validate credentials with a cheap sts call, which also assumes the role
+	stsClient := sts.NewFromConfig(cfg)
+	identity, err := stsClient.GetCallerIdentity(ctx, &sts.GetCallerIdentityInput{})
+	if err != nil {
+		if appCfg.AssumeRoleARN != "" {
+			return nil, fmt.Errorf("assume role %s: %w", appCfg.AssumeRoleARN, err)
+		}
+		return nil, err
+	}
+
+	s3Default := sdkBucketClient(s3.NewFromConfig(cfg))
+	ssmClient := ssm.NewFromConfig(cfg)
+	cl := &awsClients{
+		s3:  s3Default.api,
+		ssm: ssmClient,
+		sqs: sqs.NewFromConfig(cfg),
+		kms: kms.NewFromConfig(cfg),
+		iam: iam.NewFromConfig(cfg),
+		sts: stsClient,
+		regions: newS3Regions(cfg.Region, s3Default, func(region string) bucketClient {
+			return sdkBucketClient(s3.NewFromConfig(cfg, func(o *s3.Options) { o.Region = region }))
+		}),
+		ssmIn: newSSMRegions(cfg.Region, ssmClient, func(region string) ssmAPI {
+			return ssm.NewFromConfig(cfg, func(o *ssm.Options) { o.Region = region })
+		}),
+		region:      cfg.Region,
+		account:     aws.ToString(identity.Account),
+		unavailable: map[string]error{},
+	}
+
+	// probe each service on its own so a missing endpoint or permission for
+	// one of them doesn't take the whole service down
+	if _, err := cl.s3.ListBuckets(ctx, &s3.ListBucketsInput{MaxBuckets: aws.Int32(1)}); err != nil {
+		cl.unavailable[serviceS3] = err
+	}
+	if _, err := cl.ssm.DescribeParameters(ctx, &ssm.DescribeParametersInput{MaxResults: aws.Int32(1)}); err != nil {
+		cl.unavailable[serviceSSM] = err
+	}
+	if len(cl.unavailable) == 2 {
+		return nil, fmt.Errorf("no AWS service available: s3: %v; ssm: %v",
+			cl.unavailable[serviceS3], cl.unavailable[serviceSSM])
+	}
+	return cl, nil
+}
+
+// assumeRoleCredentials returns credentials for ASSUME_ROLE_ARN, obtained
+// through client with the base credentials. The cache refreshes the session
+// before it expires.
+func assumeRoleCredentials(client stscreds.AssumeRoleAPIClient, appCfg Config) aws.CredentialsProvider {
+	return aws.NewCredentialsCache(stscreds.NewAssumeRoleProvider(client, appCfg.AssumeRoleARN,
+		func(o *stscreds.AssumeRoleOptions) {
+			o.RoleSessionName = appCfg.RoleSessionName
+			if appCfg.AssumeRoleExternalID != "" {
+				o.ExternalID = aws.String(appCfg.AssumeRoleExternalID)
+			}
+		}))
+}
+
+// newRetryer builds the SDK retryer from AWS_RETRY_MODE, AWS_MAX_RETRIES and
+// AWS_MAX_BACKOFF.
+func newRetryer(appCfg Config) func() aws.Retryer {
+	standard := func(o *retry.StandardOptions) {
+		o.MaxAttempts = appCfg.AWSMaxRetries + 1
+		o.MaxBackoff = appCfg.AWSMaxBackoff
+	}
+	return func() aws.Retryer {
+		if appCfg.AWSRetryMode == string(aws.RetryModeAdaptive) {
+			return retry.NewAdaptiveMode(func(o *retry.AdaptiveModeOptions) {
+				o.StandardOptions = append(o.StandardOptions, standard)
+			})
+		}
+		return retry.NewStandard(standard)
+	}
+}
+
+// transferOperations move object bodies, which can rightly take longer than
+// any call timeout, or stream them back after the call returns.
+var transferOperations = map[string]bool{
+	"GetObject":           true,
+	"PutObject":           true,
+	"UploadPart":          true,
+	"CopyObject":          true,
+	"UploadPartCopy":      true,
+	"SelectObjectContent": true,
+}
+
+// addCallTimeout bounds each AWS operation, retries included, to timeout so
+// a regional blip fails fast instead of outlasting the load balancer.
+// Transfers are exempt. The deadline derives from the request context, so
+// client disconnects still cancel the call. A zero timeout disables it.
+func addCallTimeout(timeout time.Duration) func(*middleware.Stack) error {
+	return func(stack *middleware.Stack) error {
+		if timeout <= 0 {
+			return nil
+		}
+		return stack.Initialize.Add(middleware.InitializeMiddlewareFunc("auxCallTimeout",
+			func(ctx context.Context, in middleware.InitializeInput, next middleware.InitializeHandler) (
+				middleware.InitializeOutput, middleware.Metadata, error,
+			) {
+				if transferOperations[awsmiddleware.GetOperationName(ctx)] {
+					return next.HandleInitialize(ctx, in)
+				}
+				ctx, cancel := context.WithTimeout(ctx, timeout)
+				defer cancel()
+				return next.HandleInitialize(ctx, in)
+			}), middleware.After)
+	}
+}
+
+// isCallTimeout reports whether err is an AWS call that ran out of time
+// while the request itself was still live.
+func isCallTimeout(ctx context.Context, err error) bool {
+	return errors.Is(err, context.DeadlineExceeded) && ctx.Err() == nil
+}
+
+const (
+	startupBackoffInitial = time.Second
+	startupBackoffMax     = 30 * time.Second
+)
+
+// connectAWS runs newAWSClients until it succeeds or ctx is cancelled, so
+// the service can start before its credentials or endpoints are reachable
+// and stays unready, answering 503, instead of exiting into a crash loop.
+// Retries back off exponentially and are warnings for the first retryFor,
+// errors after that.
+func connectAWS(ctx context.Context, appCfg Config, m *metrics, retryFor time.Duration) (*awsClients, error) {
+	deadline := time.Now().Add(retryFor)
+	backoff := startupBackoffInitial
+	for attempt := 1; ; attempt++ {
+		cl, err := newAWSClients(ctx, appCfg, m)
+		if err == nil {
+			return cl, nil
+		}
+		if ctx.Err() != nil {
+			return nil, err
+		}
+		level := slog.LevelWarn
+		if time.Now().After(deadline) {
+			level = slog.LevelError
+		}
+		slog.Log(ctx, level, "AWS init failed, retrying", "attempt", attempt, "backoff", backoff, "err", err)
+		select {
+		case <-ctx.Done():
+			return nil, err
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, startupBackoffMax)
+	}
+}
+
+// services lists the services probed at startup.
+func (cl *awsClients) services() []string {
+	return []string{serviceS3, serviceSSM}
+}
+
+// bucketS3 returns the S3 client for bucket's region; account-wide calls
+// such as ListBuckets use cl.s3.
+func (cl *awsClients) bucketS3(ctx context.Context, bucket string) s3API {
+	return cl.regions.client(ctx, bucket).api
+}
+
+// bucketPresigner returns the presigner for bucket's region.
+func (cl *awsClients) bucketPresigner(ctx context.Context, bucket string) s3Presigner {
+	return cl.regions.client(ctx, bucket).presign
+}
+
+// ssmFor returns the SSM client for the region the request in ctx asked
+// for; startup and background calls use cl.ssm.
+func (cl *awsClients) ssmFor(ctx context.Context) ssmAPI {
+	if region := requestRegion(ctx); region != "" {
+		return cl.ssmIn.client(region)
+	}
+	return cl.ssm
+}
+
+func (cl *awsClients) available(service string) bool {
+	_, failed := cl.unavailable[service]
+	return !failed
+}
+
+// logStatus reports which services initialized successfully.
+func (cl *awsClients) logStatus() {
+	var status []string
+	for _, svc := range cl.services() {
+		if err, failed := cl.unavailable[svc]; failed {
+			status = append(status, svc+"=unavailable ("+err.Error()+")")
+		} else {
+			status = append(status, svc+"=ok")
+		}
+	}
+	slog.Info("AWS services", "status", strings.Join(status, ", "))
+}
+
+// requireService answers 503 for routes whose backing service failed to
+// initialize at startup.
+func requireService(cl *awsClients, service string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !cl.available(service) {
+			respondError(c, http.StatusServiceUnavailable, "service_unavailable",
+				service+" is not available on this instance")
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,343 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	ststypes "github.com/aws/aws-sdk-go-v2/service/sts/types"
+	"github.com/aws/smithy-go/middleware"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// fakeAssumeRole hands out session credentials expiring after ttl, or err.
+type fakeAssumeRole struct {
+	callLog
+	ttl time.Duration
+	err error
+
+	mu    sync.Mutex
+	input *sts.AssumeRoleInput
+}
+
+func (f *fakeAssumeRole) AssumeRole(_ context.Context, in *sts.AssumeRoleInput, _ ...func(*sts.Options)) (*sts.AssumeRoleOutput, error) {
+	f.record("AssumeRole")
+	f.mu.Lock()
+	f.input = in
+	f.mu.Unlock()
+	if f.err != nil {
+		return nil, f.err
+	}
+	return &sts.AssumeRoleOutput{Credentials: &ststypes.Credentials{
+		AccessKeyId:     aws.String("ASIAASSUMED"),
+		SecretAccessKey: aws.String("secret"),
+		SessionToken:    aws.String("token"),
+		Expiration:      aws.Time(time.Now().Add(f.ttl)),
+	}}, nil
+}
+
+func TestAssumeRoleCredentials(t *testing.T) {
+	const arn = "arn:aws:iam::210987654321:role/reader"
+	tests := []struct {
+		name       string
+		externalID string
+		ttl        time.Duration
+		err        error
+		calls      int
+	}{
+		{name: "cached", ttl: time.Hour, calls: 1},
+		{name: "external id", externalID: "ext-123", ttl: time.Hour, calls: 1},
+		{name: "refreshed after expiry", ttl: -time.Second, calls: 3},
+		{name: "denied", err: awsError("AccessDenied"), calls: 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := &fakeAssumeRole{ttl: tt.ttl, err: tt.err}
+			cfg := testConfig(t)
+			cfg.AssumeRoleARN = arn
+			cfg.AssumeRoleExternalID = tt.externalID
+			creds := assumeRoleCredentials(fake, cfg)
+
+			for range 3 {
+				got, err := creds.Retrieve(t.Context())
+				if tt.err != nil {
+					if err == nil {
+						t.Fatal("Retrieve: no error")
+					}
+					continue
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got.AccessKeyID != "ASIAASSUMED" || got.SessionToken != "token" || !got.CanExpire {
+					t.Errorf("credentials = %+v, want the assumed session", got)
+				}
+			}
+			if n := fake.count("AssumeRole"); n != tt.calls {
+				t.Errorf("AssumeRole calls = %d, want %d", n, tt.calls)
+			}
+			in := fake.input
+			if aws.ToString(in.RoleArn) != arn {
+				t.Errorf("RoleArn = %q, want %q", aws.ToString(in.RoleArn), arn)
+			}
+			if aws.ToString(in.RoleSessionName) != cfg.RoleSessionName {
+				t.Errorf("RoleSessionName = %q, want %q", aws.ToString(in.RoleSessionName), cfg.RoleSessionName)
+			}
+			if got := aws.ToString(in.ExternalId); got != tt.externalID {
+				t.Errorf("ExternalId = %q, want %q", got, tt.externalID)
+			}
+		})
+	}
+}
+
+// awsCall is one request seen by an awsEndpoint: the STS action or the
+// S3/SSM operation, and the access key that signed it.
+type awsCall struct {
+	action    string
+	accessKey string
+}
+
+// awsEndpoint stands in for STS, S3 and SSM behind AWS_ENDPOINT_URL,
+// answering AssumeRole with a session or denyAssume, refusing the first
+// failIdentity GetCallerIdentity calls, and recording who signed each call.
+// The returned func lists the calls so far.
+func awsEndpoint(t *testing.T, denyAssume bool, failIdentity int) func() []awsCall {
+	t.Helper()
+	var (
+		mu    sync.Mutex
+		calls []awsCall
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, credential, _ := strings.Cut(r.Header.Get("Authorization"), "Credential=")
+		key, _, _ := strings.Cut(credential, "/")
+		var action string
+		switch {
+		case r.Header.Get("X-Amz-Target") != "":
+			action = r.Header.Get("X-Amz-Target")
+			w.Header().Set("Content-Type", "application/x-amz-json-1.1")
+			fmt.Fprint(w, `{"Parameters":[]}`)
+		case r.Method == http.MethodGet:
+			action = "ListBuckets"
+			fmt.Fprint(w, `<ListAllMyBucketsResult><Buckets></Buckets></ListAllMyBucketsResult>`)
+		default:
+			if err := r.ParseForm(); err != nil {
+				t.Error(err)
+			}
+			action = r.PostForm.Get("Action")
+			mu.Lock()
+			refuse := action == "GetCallerIdentity" && failIdentity > 0
+			if refuse {
+				failIdentity--
+			}
+			mu.Unlock()
+			w.Header().Set("Content-Type", "text/xml")
+			switch {
+			case refuse:
+				w.WriteHeader(http.StatusForbidden)
+				fmt.Fprint(w, `<ErrorResponse><Error><Type>Sender</Type><Code>ExpiredToken</Code>`+
+					`<Message>token expired</Message></Error><RequestId>r</RequestId></ErrorResponse>`)
+			case action == "AssumeRole" && denyAssume:
+				w.WriteHeader(http.StatusForbidden)
+				fmt.Fprint(w, `<ErrorResponse><Error><Type>Sender</Type><Code>AccessDenied</Code>`+
+					`<Message>not authorized to assume role</Message></Error><RequestId>r</RequestId></ErrorResponse>`)
+			case action == "AssumeRole":
+				fmt.Fprintf(w, `<AssumeRoleResponse><AssumeRoleResult><Credentials>`+
+					`<AccessKeyId>ASIAASSUMED</AccessKeyId><SecretAccessKey>secret</SecretAccessKey>`+
+					`<SessionToken>token</SessionToken><Expiration>%s</Expiration></Credentials>`+
+					`</AssumeRoleResult></AssumeRoleResponse>`, time.Now().Add(time.Hour).UTC().Format(time.RFC3339))
+			default:
+				fmt.Fprint(w, `<GetCallerIdentityResponse><GetCallerIdentityResult>`+
+					`<Account>210987654321</Account></GetCallerIdentityResult></GetCallerIdentityResponse>`)
+			}
+		}
+		mu.Lock()
+		calls = append(calls, awsCall{action: action, accessKey: key})
+		mu.Unlock()
+	}))
+	t.Cleanup(srv.Close)
+
+	dir := t.TempDir()
+	t.Setenv("AWS_ENDPOINT_URL", srv.URL)
+	t.Setenv("AWS_REGION", testRegion)
+	t.Setenv("AWS_ACCESS_KEY_ID", "AKIDBASE")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+	t.Setenv("AWS_SESSION_TOKEN", "")
+	t.Setenv("AWS_EC2_METADATA_DISABLED", "true")
+	t.Setenv("AWS_CONFIG_FILE", filepath.Join(dir, "config"))
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", filepath.Join(dir, "credentials"))
+	return func() []awsCall {
+		mu.Lock()
+		defer mu.Unlock()
+		return slices.Clone(calls)
+	}
+}
+
+func TestNewAWSClientsAssumeRole(t *testing.T) {
+	const arn = "arn:aws:iam::210987654321:role/reader"
+	tests := []struct {
+		name       string
+		arn        string
+		denyAssume bool
+		calls      []awsCall
+		err        string
+	}{
+		{
+			name: "base credentials",
+			calls: []awsCall{
+				{"GetCallerIdentity", "AKIDBASE"},
+				{"ListBuckets", "AKIDBASE"},
+				{"AmazonSSM.DescribeParameters", "AKIDBASE"},
+			},
+		},
+		{
+			name: "assumed role",
+			arn:  arn,
+			calls: []awsCall{
+				{"AssumeRole", "AKIDBASE"},
+				{"GetCallerIdentity", "ASIAASSUMED"},
+				{"ListBuckets", "ASIAASSUMED"},
+				{"AmazonSSM.DescribeParameters", "ASIAASSUMED"},
+			},
+		},
+		{
+			name:       "assume denied",
+			arn:        arn,
+			denyAssume: true,
+			calls:      []awsCall{{"AssumeRole", "AKIDBASE"}},
+			err:        "assume role " + arn,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := awsEndpoint(t, tt.denyAssume, 0)
+			cfg := testConfig(t)
+			cfg.AssumeRoleARN = tt.arn
+
+			cl, err := newAWSClients(t.Context(), cfg, newMetrics(prometheus.NewRegistry()))
+			switch {
+			case tt.err != "":
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Errorf("error = %v, want it to name %q", err, tt.err)
+				}
+			case err != nil:
+				t.Fatal(err)
+			case cl.account != "210987654321":
+				t.Errorf("account = %q, want 210987654321", cl.account)
+			}
+			if got := calls(); !slices.Equal(got, tt.calls) {
+				t.Errorf("calls = %v, want %v", got, tt.calls)
+			}
+		})
+	}
+}
+
+// slowEndpoint answers GetParameter and GetObject after delay, or gives up
+// once the caller goes away.
+func slowEndpoint(t *testing.T, delay time.Duration) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// the server only notices a dropped connection once the body is read
+		io.Copy(io.Discard, r.Body)
+		select {
+		case <-time.After(delay):
+		case <-r.Context().Done():
+			return
+		}
+		if r.Header.Get("X-Amz-Target") != "" {
+			w.Header().Set("Content-Type", "application/x-amz-json-1.1")
+			fmt.Fprint(w, `{"Parameter":{"Name":"app","Value":"v","Type":"String","Version":1}}`)
+			return
+		}
+		fmt.Fprint(w, "object body")
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// timedClients points real SDK clients at url with the call timeout
+// middleware installed, as newAWSClients does.
+func timedClients(url string, timeout time.Duration) *awsClients {
+	creds := credentials.NewStaticCredentialsProvider("AKIDTEST", "secret", "")
+	apiOptions := []func(*middleware.Stack) error{addCallTimeout(timeout)}
+	return testClients(
+		s3.New(s3.Options{
+			Region: testRegion, BaseEndpoint: aws.String(url), UsePathStyle: true,
+			Credentials: creds, APIOptions: apiOptions,
+		}),
+		ssm.New(ssm.Options{
+			Region: testRegion, BaseEndpoint: aws.String(url),
+			Credentials: creds, APIOptions: apiOptions,
+		}),
+	)
+}
+
+func TestAddCallTimeout(t *testing.T) {
+	tests := []struct {
+		name    string
+		target  string
+		delay   time.Duration
+		timeout time.Duration
+		status  int
+		code    string
+	}{
+		{name: "within timeout", target: "/parameters/app", timeout: time.Second, status: http.StatusOK},
+		{name: "past deadline", target: "/parameters/app", delay: 5 * time.Second, timeout: 50 * time.Millisecond,
+			status: http.StatusGatewayTimeout, code: "timeout"},
+		{name: "disabled", target: "/parameters/app", delay: 100 * time.Millisecond, status: http.StatusOK},
+		{name: "transfer exempt", target: "/buckets/b/objects/k", delay: 100 * time.Millisecond, timeout: 20 * time.Millisecond,
+			status: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := slowEndpoint(t, tt.delay)
+			s := newTestServer(t, testConfig(t), timedClients(srv.URL, tt.timeout))
+
+			start := time.Now()
+			w := s.do(t, http.MethodGet, tt.target, "")
+			if tt.code != "" {
+				wantError(t, w, tt.status, tt.code)
+				if elapsed := time.Since(start); elapsed > time.Second {
+					t.Errorf("timed out after %v, want about %v", elapsed, tt.timeout)
+				}
+				return
+			}
+			if w.Code != tt.status {
+				t.Errorf("status = %d, want %d: %s", w.Code, tt.status, w.Body)
+			}
+		})
+	}
+}
+
+func TestAddCallTimeoutClientGone(t *testing.T) {
+	srv := slowEndpoint(t, 5*time.Second)
+	s := newTestServer(t, testConfig(t), timedClients(srv.URL, 5*time.Second))
+
+	ctx, cancel := context.WithTimeout(t.Context(), 50*time.Millisecond)
+	defer cancel()
+	// single-parameter reads are shared and outlive any one client, so
+	// use a plain call
+	req := httptest.NewRequestWithContext(ctx, http.MethodGet, "/buckets", nil)
+	w := httptest.NewRecorder()
+	start := time.Now()
+	s.router.ServeHTTP(w, req)
+
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("call outlived the client by %v", elapsed)
+	}
+	if w.Code == http.StatusGatewayTimeout {
+		t.Errorf("status = 504 for a client that went away, want the call timeout reserved for AWS")
+	}
+}
@@ -0,0 +1,82 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	awsmiddleware "github.com/aws/aws-sdk-go-v2/aws/middleware"
+	"github.com/aws/smithy-go/middleware"
+	"golang.org/x/time/rate"
+)
+
+// errAWSCallLimited is returned for an AWS call that couldn't get a slot
+// under this service's own limits in time; it never reached AWS.
+var errAWSCallLimited = errors.New("aws call limit reached")
+
+// awsCallLimits keeps this instance under the AWS API limits itself, with a
+// cap on in-flight calls and an optional request rate per service, rather
+// than letting AWS answer with throttling errors.
+type awsCallLimits struct {
+	wait  time.Duration
+	slots map[string]chan struct{} // by lowercase service ID
+	rates map[string]*rate.Limiter
+}
+
+// newAWSCallLimits allows maxConcurrent in-flight calls to each of services
+// and rps calls a second to the services in rps; zero disables either. A
+// call waits up to wait for its turn.
+func newAWSCallLimits(maxConcurrent int, rps map[string]float64, wait time.Duration, services ...string) *awsCallLimits {
+	l := &awsCallLimits{wait: wait, slots: map[string]chan struct{}{}, rates: map[string]*rate.Limiter{}}
+	if maxConcurrent > 0 {
+		for _, svc := range services {
+			l.slots[svc] = make(chan struct{}, maxConcurrent)
+		}
+	}
+	for svc, r := range rps {
+		if r > 0 {
+			l.rates[svc] = rate.NewLimiter(rate.Limit(r), max(1, int(r)))
+		}
+	}
+	return l
+}
+
+// apply is an SDK API option holding a slot and a rate token for the
+// duration of each call.
+func (l *awsCallLimits) apply(stack *middleware.Stack) error {
+	if len(l.slots) == 0 && len(l.rates) == 0 {
+		return nil
+	}
+	return stack.Initialize.Add(middleware.InitializeMiddlewareFunc("auxCallLimits",
+		func(ctx context.Context, in middleware.InitializeInput, next middleware.InitializeHandler) (
+			middleware.InitializeOutput, middleware.Metadata, error,
+		) {
+			service := strings.ToLower(awsmiddleware.GetServiceID(ctx))
+			waitCtx, cancel := context.WithTimeout(ctx, l.wait)
+			defer cancel()
+			if limiter := l.rates[service]; limiter != nil {
+				if err := limiter.Wait(waitCtx); err != nil {
+					return middleware.InitializeOutput{}, middleware.Metadata{}, l.refuse(ctx)
+				}
+			}
+			if slots := l.slots[service]; slots != nil {
+				select {
+				case slots <- struct{}{}:
+					defer func() { <-slots }()
+				case <-waitCtx.Done():
+					return middleware.InitializeOutput{}, middleware.Metadata{}, l.refuse(ctx)
+				}
+			}
+			return next.HandleInitialize(ctx, in)
+		}), middleware.After)
+}
+
+// refuse reports a call that didn't get its turn, or the request's own
+// cancellation when that is why.
+func (l *awsCallLimits) refuse(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return errAWSCallLimited
+}
@@ -0,0 +1,224 @@
+package handlers
+
+import (
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	"github.com/aws/smithy-go/middleware"
+)
+
+// heldEndpoint answers S3 ListBuckets and SSM DescribeParameters once
+// release is closed, counting the calls in flight per service.
+type heldEndpoint struct {
+	url     string
+	release chan struct{}
+
+	mu       sync.Mutex
+	inFlight map[string]int
+	peak     map[string]int
+}
+
+func newHeldEndpoint(t *testing.T) *heldEndpoint {
+	t.Helper()
+	e := &heldEndpoint{release: make(chan struct{}), inFlight: map[string]int{}, peak: map[string]int{}}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+		svc := serviceS3
+		if r.Header.Get("X-Amz-Target") != "" {
+			svc = serviceSSM
+		}
+		e.mu.Lock()
+		e.inFlight[svc]++
+		e.peak[svc] = max(e.peak[svc], e.inFlight[svc])
+		e.mu.Unlock()
+		defer func() {
+			e.mu.Lock()
+			e.inFlight[svc]--
+			e.mu.Unlock()
+		}()
+		select {
+		case <-e.release:
+		case <-r.Context().Done():
+			return
+		}
+		if svc == serviceSSM {
+			w.Header().Set("Content-Type", "application/x-amz-json-1.1")
+			fmt.Fprint(w, `{"Parameters":[]}`)
+			return
+		}
+		fmt.Fprint(w, `<ListAllMyBucketsResult><Buckets></Buckets></ListAllMyBucketsResult>`)
+	}))
+	t.Cleanup(srv.Close)
+	// release before close, which waits for held handlers
+	t.Cleanup(e.releaseAll)
+	e.url = srv.URL
+	return e
+}
+
+func (e *heldEndpoint) releaseAll() {
+	select {
+	case <-e.release:
+	default:
+		close(e.release)
+	}
+}
+
+func (e *heldEndpoint) counts() (inFlight, peak map[string]int) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return maps.Clone(e.inFlight), maps.Clone(e.peak)
+}
+
+// limitedClients points real SDK clients at url behind limits, as
+// newAWSClients does.
+func limitedClients(url string, limits *awsCallLimits) (*s3.Client, *ssm.Client) {
+	creds := credentials.NewStaticCredentialsProvider("AKIDTEST", "secret", "")
+	apiOptions := []func(*middleware.Stack) error{limits.apply}
+	return s3.New(s3.Options{
+			Region: testRegion, BaseEndpoint: aws.String(url), UsePathStyle: true,
+			Credentials: creds, APIOptions: apiOptions, RetryMaxAttempts: 1,
+		}), ssm.New(ssm.Options{
+			Region: testRegion, BaseEndpoint: aws.String(url),
+			Credentials: creds, APIOptions: apiOptions, RetryMaxAttempts: 1,
+		})
+}
+
+func TestAWSCallLimitsInFlight(t *testing.T) {
+	tests := []struct {
+		name          string
+		maxConcurrent int
+		s3Callers     int
+		ssmCallers    int
+		want          map[string]int // calls in flight while held
+	}{
+		{name: "capped", maxConcurrent: 3, s3Callers: 10, want: map[string]int{serviceS3: 3}},
+		{name: "one at a time", maxConcurrent: 1, ssmCallers: 5, want: map[string]int{serviceSSM: 1}},
+		{
+			name:          "per service",
+			maxConcurrent: 2,
+			s3Callers:     6,
+			ssmCallers:    6,
+			want:          map[string]int{serviceS3: 2, serviceSSM: 2},
+		},
+		{name: "under the cap", maxConcurrent: 8, s3Callers: 4, want: map[string]int{serviceS3: 4}},
+		{name: "disabled", s3Callers: 6, ssmCallers: 6, want: map[string]int{serviceS3: 6, serviceSSM: 6}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := newHeldEndpoint(t)
+			limits := newAWSCallLimits(tt.maxConcurrent, nil, time.Minute, serviceS3, serviceSSM)
+			s3c, ssmc := limitedClients(e.url, limits)
+
+			var wg sync.WaitGroup
+			errs := make(chan error, tt.s3Callers+tt.ssmCallers)
+			for range tt.s3Callers {
+				wg.Go(func() {
+					_, err := s3c.ListBuckets(t.Context(), &s3.ListBucketsInput{})
+					errs <- err
+				})
+			}
+			for range tt.ssmCallers {
+				wg.Go(func() {
+					_, err := ssmc.DescribeParameters(t.Context(), &ssm.DescribeParametersInput{})
+					errs <- err
+				})
+			}
+			eventually(t, "calls to reach the limit", func() bool {
+				inFlight, _ := e.counts()
+				for svc, n := range tt.want {
+					if inFlight[svc] != n {
+						return false
+					}
+				}
+				return true
+			})
+			// give any call that slipped past the limit time to show up
+			time.Sleep(50 * time.Millisecond)
+			e.releaseAll()
+			wg.Wait()
+			close(errs)
+
+			for err := range errs {
+				if err != nil {
+					t.Errorf("call failed: %v", err)
+				}
+			}
+			_, peak := e.counts()
+			for svc, n := range tt.want {
+				if peak[svc] != n {
+					t.Errorf("%s peak in flight = %d, want %d", svc, peak[svc], n)
+				}
+			}
+		})
+	}
+}
+
+func TestAWSCallLimitsRefuse(t *testing.T) {
+	tests := []struct {
+		name          string
+		maxConcurrent int
+		rps           float64
+	}{
+		{name: "no slot", maxConcurrent: 1},
+		{name: "rate", rps: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := newHeldEndpoint(t)
+			limits := newAWSCallLimits(tt.maxConcurrent, map[string]float64{serviceS3: tt.rps},
+				20*time.Millisecond, serviceS3, serviceSSM)
+			s3c, ssmc := limitedClients(e.url, limits)
+			s := newTestServer(t, testConfig(t), testClients(s3c, ssmc))
+
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				s.do(t, http.MethodGet, "/buckets?nocache=true", "")
+			}()
+			eventually(t, "the first call to reach S3", func() bool {
+				inFlight, _ := e.counts()
+				return inFlight[serviceS3] == 1
+			})
+
+			start := time.Now()
+			w := s.do(t, http.MethodGet, "/buckets?nocache=true", "")
+			wantError(t, w, http.StatusTooManyRequests, "throttled")
+			if got := w.Header().Get("Retry-After"); got != "1" {
+				t.Errorf("Retry-After = %q, want 1", got)
+			}
+			if elapsed := time.Since(start); elapsed > time.Second {
+				t.Errorf("refused after %v, want about the 20ms wait", elapsed)
+			}
+			_, peak := e.counts()
+			if peak[serviceS3] != 1 {
+				t.Errorf("S3 peak in flight = %d, want 1", peak[serviceS3])
+			}
+
+			// SSM has its own budget
+			ssmDone := make(chan error, 1)
+			go func() {
+				_, err := ssmc.DescribeParameters(t.Context(), &ssm.DescribeParametersInput{})
+				ssmDone <- err
+			}()
+			eventually(t, "an SSM call while S3 is at its limit", func() bool {
+				inFlight, _ := e.counts()
+				return inFlight[serviceSSM] == 1
+			})
+			e.releaseAll()
+			<-done
+			if err := <-ssmDone; err != nil {
+				t.Errorf("DescribeParameters: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,291 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/gin-gonic/gin"
+	"golang.org/x/sync/errgroup"
+)
+
+type bucketPolicy struct {
+	Policy json.RawMessage `json:"policy"`
+}
+
+type bucketGrantee struct {
+	Type        string `json:"type"`
+	ID          string `json:"id,omitempty"`
+	DisplayName string `json:"displayName,omitempty"`
+	URI         string `json:"uri,omitempty"`
+	Email       string `json:"email,omitempty"`
+}
+
+type bucketGrant struct {
+	Grantee    bucketGrantee `json:"grantee"`
+	Permission string        `json:"permission"`
+}
+
+type bucketACL struct {
+	Owner  string        `json:"owner,omitempty"`
+	Grants []bucketGrant `json:"grants"`
+}
+
+// respondS3Error maps the S3 errors shared by the bucket endpoints onto the
+// JSON error envelope.
+func respondS3Error(c *gin.Context, err error) {
+	if respondThrottled(c, err) {
+		return
+	}
+	switch apiErrorCode(err) {
+	case "NoSuchBucket", "NotFound":
+		respondAWSError(c, err, http.StatusNotFound, "not_found", "bucket not found")
+	case "NoSuchKey":
+		respondAWSError(c, err, http.StatusNotFound, "not_found", "object not found")
+	case "AccessDenied":
+		respondAWSError(c, err, http.StatusForbidden, "access_denied", "access to bucket denied")
+	default:
+		respondAWSError(c, err, http.StatusInternalServerError, "internal", "s3 request failed")
+	}
+}
+
+// bucketDetailConcurrency bounds the per-bucket lookups of a detailed
+// listing.
+const bucketDetailConcurrency = 16
+
+type bucketDetail struct {
+	Name   string            `json:"name"`
+	Region string            `json:"region"`
+	Tags   map[string]string `json:"tags,omitempty"`
+	Error  *apiError         `json:"error,omitempty"`
+}
+
+// bucketDetails looks up the region and tags of each bucket concurrently. A
+// failed lookup is recorded on that bucket, with region "unknown" if the
+// region is what failed, and never cancels the others, so accounts with
+// mixed permissions still get a full listing.
+func bucketDetails(ctx context.Context, cl *awsClients, names []string) []bucketDetail {
+	details := make([]bucketDetail, len(names))
+	var g errgroup.Group
+	g.SetLimit(bucketDetailConcurrency)
+	for i, name := range names {
+		g.Go(func() error {
+			details[i] = bucketDetailOf(ctx, cl, name)
+			return nil
+		})
+	}
+	_ = g.Wait() // per-bucket errors are reported in the details
+	return details
+}
+
+func bucketDetailOf(ctx context.Context, cl *awsClients, bucket string) bucketDetail {
+	detail := bucketDetail{Name: bucket, Region: "unknown"}
+	region, err := cl.regions.region(ctx, bucket)
+	if err != nil {
+		loggerFrom(ctx).Warn("bucket region lookup failed", "bucket", bucket, "err", err)
+		detail.Error = bucketDetailError(err)
+		return detail
+	}
+	detail.Region = region
+
+	out, err := cl.bucketS3(ctx, bucket).GetBucketTagging(ctx, &s3.GetBucketTaggingInput{Bucket: aws.String(bucket)})
+	if err != nil {
+		if apiErrorCode(err) == "NoSuchTagSet" {
+			return detail
+		}
+		loggerFrom(ctx).Warn("bucket tagging lookup failed", "bucket", bucket, "err", err)
+		detail.Error = bucketDetailError(err)
+		return detail
+	}
+	detail.Tags = make(map[string]string, len(out.TagSet))
+	for _, t := range out.TagSet {
+		detail.Tags[aws.ToString(t.Key)] = aws.ToString(t.Value)
+	}
+	return detail
+}
+
+func bucketDetailError(err error) *apiError {
+	switch apiErrorCode(err) {
+	case "AccessDenied", "Forbidden":
+		return &apiError{Code: "access_denied", Message: "access denied"}
+	case "NoSuchBucket", "NotFound":
+		return &apiError{Code: "not_found", Message: "bucket not found"}
+	}
+	return &apiError{Code: "internal", Message: "s3 request failed"}
+}
+
+func bucketPolicyHandler(cl *awsClients) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		out, err := cl.bucketS3(c.Request.Context(), c.Param("bucket")).GetBucketPolicy(c.Request.Context(), &s3.GetBucketPolicyInput{
+			Bucket: aws.String(c.Param("bucket")),
+		})
+		// a bucket without a policy is a valid audit answer, not an error
+		if apiErrorCode(err) == "NoSuchBucketPolicy" {
+			respond(c, http.StatusOK, bucketPolicy{})
+			return
+		}
+		if err != nil {
+			respondS3Error(c, err)
+			return
+		}
+
+		var policy bucketPolicy
+		if p := aws.ToString(out.Policy); p != "" {
+			policy.Policy = json.RawMessage(p)
+		}
+		respond(c, http.StatusOK, policy)
+	}
+}
+
+func bucketACLHandler(cl *awsClients) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		out, err := cl.bucketS3(c.Request.Context(), c.Param("bucket")).GetBucketAcl(c.Request.Context(), &s3.GetBucketAclInput{
+			Bucket: aws.String(c.Param("bucket")),
+		})
+		if err != nil {
+			respondS3Error(c, err)
+			return
+		}
+
+		acl := bucketACL{Grants: []bucketGrant{}}
+		if out.Owner != nil {
+			acl.Owner = aws.ToString(out.Owner.ID)
+		}
+		for _, g := range out.Grants {
+			grant := bucketGrant{Permission: string(g.Permission)}
+			if g.Grantee != nil {
+				grant.Grantee = bucketGrantee{
+					Type:        string(g.Grantee.Type),
+					ID:          aws.ToString(g.Grantee.ID),
+					DisplayName: aws.ToString(g.Grantee.DisplayName),
+					URI:         aws.ToString(g.Grantee.URI),
+					Email:       aws.ToString(g.Grantee.EmailAddress),
+				}
+			}
+			acl.Grants = append(acl.Grants, grant)
+		}
+		respond(c, http.StatusOK, acl)
+	}
+}
+
+// bucketAllowlist restricts which buckets the service exposes. A nil
+// allowlist allows every bucket.
+type bucketAllowlist map[string]struct{}
+
+func newBucketAllowlist(names []string) bucketAllowlist {
+	if len(names) == 0 {
+		return nil
+	}
+	allow := make(bucketAllowlist, len(names))
+	for _, n := range names {
+		if n = strings.TrimSpace(n); n != "" {
+			allow[n] = struct{}{}
+		}
+	}
+	return allow
+}
+
+func (a bucketAllowlist) allows(bucket string) bool {
+	if a == nil {
+		return true
+	}
+	_, ok := a[bucket]
+	return ok
+}
+
+// requireAllowedBucket rejects requests for buckets outside the allowlist
+// before any S3 call is made.
+func requireAllowedBucket(allow bucketAllowlist) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !allow.allows(c.Param("bucket")) {
+			respondError(c, http.StatusForbidden, "forbidden", "bucket is not exposed by this service")
+			return
+		}
+		c.Next()
+	}
+}
+
+// listBucketNames follows ListBuckets pages from token until limit buckets
+// have been fetched, returning the allowed names and where to resume.
+func listBucketNames(ctx context.Context, cl *awsClients, allow bucketAllowlist, limit int, token string) ([]string, listPage, error) {
+	input := &s3.ListBucketsInput{}
+	if token != "" {
+		input.ContinuationToken = &token
+	}
+	names := []string{}
+	fetched := 0
+	for {
+		if limit > 0 {
+			input.MaxBuckets = aws.Int32(pageSize(limit, fetched, 10000))
+		}
+		out, err := cl.s3.ListBuckets(ctx, input)
+		if err != nil {
+			return nil, listPage{}, err
+		}
+		fetched += len(out.Buckets)
+		for _, b := range out.Buckets {
+			if name := aws.ToString(b.Name); name != "" && allow.allows(name) {
+				names = append(names, name)
+			}
+		}
+		token := aws.ToString(out.ContinuationToken)
+		if token == "" {
+			return names, listPage{}, nil
+		}
+		if limit > 0 && fetched >= limit {
+			return names, listPage{truncated: true, nextToken: token}, nil
+		}
+		input.ContinuationToken = &token
+	}
+}
+
+// listBucketsHandler lists the exposed buckets, up to MAX_RESPONSE_ITEMS
+// (after the allowlist is applied); ?nextToken= resumes a truncated listing.
+// Results are cached per account for BUCKET_LIST_CACHE_TTL, reported in
+// X-Cache; ?nocache=true fetches a fresh listing. ?details=true adds each
+// bucket's region and tags.
+func listBucketsHandler(cl *awsClients, allow bucketAllowlist, live *liveConfig, cache *bucketListCache) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		settings := live.get()
+		limit, err := listLimit(c, settings.MaxResponseItems)
+		if err != nil {
+			respondError(c, http.StatusBadRequest, "bad_request", err.Error())
+			return
+		}
+		token := c.Query("nextToken")
+		key := fmt.Sprintf("%s\x00%d\x00%s", cl.account, limit, token)
+		entry, hit := bucketListEntry{}, false
+		if c.Query("nocache") != "true" {
+			entry, hit = cache.get(key)
+		}
+		if !hit {
+			entry.names, entry.page, err = listBucketNames(c.Request.Context(), cl, allow, limit, token)
+			if err != nil {
+				respondS3Error(c, err)
+				return
+			}
+			cache.put(key, entry)
+		}
+		if cache.enabled() {
+			status := "MISS"
+			if hit {
+				status = "HIT"
+			}
+			c.Header(cacheHeader, status)
+		}
+		names := entry.names
+		setListPage(c, entry.page)
+		if respondEmptyListing(c, len(names), "buckets") {
+			return
+		}
+		if c.Query("details") == "true" {
+			respondCacheable(c, settings.ListingMaxAge, "", bucketDetails(c.Request.Context(), cl, names))
+			return
+		}
+		respondCacheable(c, settings.ListingMaxAge, "", names)
+	}
+}
@@ -0,0 +1,94 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"slices"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+func TestListBucketsHandler(t *testing.T) {
+	tests := []struct {
+		name      string
+		buckets   []s3types.Bucket
+		err       error
+		want      []string
+		allowlist []string
+		status    int
+		code      string
+	}{
+		{
+			name:    "names",
+			buckets: []s3types.Bucket{{Name: aws.String("alpha")}, {Name: aws.String("beta")}},
+			want:    []string{"alpha", "beta"},
+		},
+		{
+			name:    "nil name skipped",
+			buckets: []s3types.Bucket{{Name: nil}, {Name: aws.String("beta")}},
+			want:    []string{"beta"},
+		},
+		{
+			name:      "allowlist",
+			buckets:   []s3types.Bucket{{Name: aws.String("alpha")}, {Name: aws.String("beta")}},
+			allowlist: []string{"beta"},
+			want:      []string{"beta"},
+		},
+		{
+			name: "empty",
+			want: []string{},
+		},
+		{name: "access denied", err: awsError("AccessDenied"), status: http.StatusForbidden, code: "access_denied"},
+		{name: "throttled", err: awsError("SlowDown"), status: http.StatusTooManyRequests, code: "throttled"},
+		{name: "other failure", err: errors.New("connection reset"), status: http.StatusInternalServerError, code: "internal"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := &fakeS3{listBuckets: func(context.Context, *s3.ListBucketsInput) (*s3.ListBucketsOutput, error) {
+				if tt.err != nil {
+					return nil, tt.err
+				}
+				return &s3.ListBucketsOutput{Buckets: tt.buckets}, nil
+			}}
+			cfg := testConfig(t)
+			cfg.BucketAllowlist = tt.allowlist
+			s := newTestServer(t, cfg, testClients(fake, &fakeSSM{}))
+
+			w := s.do(t, http.MethodGet, "/buckets", "")
+			if tt.status != 0 {
+				wantError(t, w, tt.status, tt.code)
+				return
+			}
+			var got []string
+			decodeData(t, w, &got)
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("buckets = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestListBucketsHandlerCachesListing(t *testing.T) {
+	fake := &fakeS3{listBuckets: func(context.Context, *s3.ListBucketsInput) (*s3.ListBucketsOutput, error) {
+		return &s3.ListBucketsOutput{Buckets: []s3types.Bucket{{Name: aws.String("alpha")}}}, nil
+	}}
+	s := newTestServer(t, testConfig(t), testClients(fake, &fakeSSM{}))
+
+	for i, want := range []string{"MISS", "HIT"} {
+		w := s.do(t, http.MethodGet, "/buckets", "")
+		if got := w.Header().Get(cacheHeader); got != want {
+			t.Errorf("request %d: %s = %q, want %q", i, cacheHeader, got, want)
+		}
+	}
+	if n := fake.count("ListBuckets"); n != 1 {
+		t.Errorf("ListBuckets calls = %d, want 1", n)
+	}
+	s.do(t, http.MethodGet, "/buckets?nocache=true", "")
+	if n := fake.count("ListBuckets"); n != 2 {
+		t.Errorf("ListBuckets calls after nocache = %d, want 2", n)
+	}
+}
@@ -0,0 +1,301 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	"github.com/gin-gonic/gin"
+)
+
+func cacheControl(maxAge time.Duration) string {
+	if maxAge <= 0 {
+		return "no-cache"
+	}
+	return fmt.Sprintf("private, max-age=%d", int(maxAge.Seconds()))
+}
+
+// weakETag derives a weak validator from the given parts. Weak because the
+// JSON rendering is not guaranteed to be byte-identical between versions.
+func weakETag(parts ...string) string {
+	h := sha256.New()
+	for _, p := range parts {
+		h.Write([]byte(p))
+		h.Write([]byte{0})
+	}
+	return `W/"` + hex.EncodeToString(h.Sum(nil))[:32] + `"`
+}
+
+// etagMatches implements the weak comparison If-None-Match asks for.
+func etagMatches(ifNoneMatch, etag string) bool {
+	if ifNoneMatch == "" {
+		return false
+	}
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+	return false
+}
+
+// respondCacheable writes a 200 with caching headers, or an empty 304 when
+// the client's copy (If-None-Match) is still current. An empty etag is
+// computed from the rendered data.
+func respondCacheable(c *gin.Context, maxAge time.Duration, etag string, data any) {
+	if etag == "" {
+		b, err := json.Marshal(data)
+		if err != nil {
+			loggerFrom(c.Request.Context()).Error("encode response failed", "err", err)
+			respondError(c, http.StatusInternalServerError, "internal", "failed to encode response")
+			return
+		}
+		etag = weakETag(c.Request.URL.RawQuery, string(b))
+	}
+	c.Header("Cache-Control", cacheControl(maxAge))
+	c.Header("ETag", etag)
+	if etagMatches(c.GetHeader("If-None-Match"), etag) {
+		c.Status(http.StatusNotModified)
+		return
+	}
+	respond(c, http.StatusOK, data)
+}
+
+// cacheHeader reports whether a response came from a server-side cache.
+const cacheHeader = "X-Cache"
+
+type bucketListEntry struct {
+	names   []string
+	page    listPage
+	expires time.Time
+}
+
+// bucketListCache keeps recent /buckets results for a short TTL, saving
+// ListBuckets calls for clients that poll it. A zero TTL disables it.
+type bucketListCache struct {
+	ttl time.Duration
+
+	mu      sync.Mutex
+	entries map[string]bucketListEntry
+}
+
+func newBucketListCache(ttl time.Duration) *bucketListCache {
+	return &bucketListCache{ttl: ttl, entries: map[string]bucketListEntry{}}
+}
+
+func (bc *bucketListCache) enabled() bool {
+	return bc.ttl > 0
+}
+
+func (bc *bucketListCache) get(key string) (bucketListEntry, bool) {
+	if !bc.enabled() {
+		return bucketListEntry{}, false
+	}
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+	entry, ok := bc.entries[key]
+	if !ok || time.Now().After(entry.expires) {
+		return bucketListEntry{}, false
+	}
+	return entry, true
+}
+
+// put stores entry under key, dropping any entries that have expired.
+func (bc *bucketListCache) put(key string, entry bucketListEntry) {
+	if !bc.enabled() {
+		return
+	}
+	now := time.Now()
+	entry.expires = now.Add(bc.ttl)
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+	for k, e := range bc.entries {
+		if now.After(e.expires) {
+			delete(bc.entries, k)
+		}
+	}
+	bc.entries[key] = entry
+}
+
+// flush drops every entry and returns how many there were.
+func (bc *bucketListCache) flush() int {
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+	n := len(bc.entries)
+	clear(bc.entries)
+	return n
+}
+
+type parameterCacheEntry struct {
+	out     *ssm.GetParameterOutput
+	fetched time.Time
+}
+
+// parameterListingEntry is a cached by-path read or listing: the
+// parameters fetched and where the listing resumes.
+type parameterListingEntry struct {
+	data    any
+	page    listPage
+	fetched time.Time
+}
+
+// parameterCache keeps single-parameter reads for PARAMETER_CACHE_TTL,
+// keyed by region, name and whether the value was decrypted, so dashboards polling
+// a few values don't spend GetParameter quota. By-path reads and listings
+// are kept alongside, keyed by region and query. A zero TTL disables it.
+type parameterCache struct {
+	ttl time.Duration
+
+	mu       sync.Mutex
+	entries  map[string]parameterCacheEntry
+	listings map[string]parameterListingEntry
+}
+
+func newParameterCache(ttl time.Duration) *parameterCache {
+	return &parameterCache{
+		ttl:      ttl,
+		entries:  map[string]parameterCacheEntry{},
+		listings: map[string]parameterListingEntry{},
+	}
+}
+
+func parameterCacheKey(region, name string, decrypt bool) string {
+	return region + "\x00" + name + "\x00" + strconv.FormatBool(decrypt)
+}
+
+// parameterListingKey keys a by-path read or listing by region, route and
+// query, normalized so parameter order doesn't matter and ?nocache= is
+// left out.
+func parameterListingKey(region, route string, query url.Values) string {
+	normalized := url.Values{}
+	for k, vs := range query {
+		if k != "nocache" {
+			normalized[k] = slices.Sorted(slices.Values(vs))
+		}
+	}
+	return region + "\x00" + route + "\x00" + normalized.Encode()
+}
+
+func (pc *parameterCache) enabled() bool {
+	return pc.ttl > 0
+}
+
+func (pc *parameterCache) get(key string) (parameterCacheEntry, bool) {
+	if !pc.enabled() {
+		return parameterCacheEntry{}, false
+	}
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+	entry, ok := pc.entries[key]
+	if !ok || time.Since(entry.fetched) >= pc.ttl {
+		return parameterCacheEntry{}, false
+	}
+	return entry, true
+}
+
+// put stores out under key, dropping any entries that have expired.
+func (pc *parameterCache) put(key string, out *ssm.GetParameterOutput) {
+	if !pc.enabled() {
+		return
+	}
+	now := time.Now()
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+	for k, e := range pc.entries {
+		if now.Sub(e.fetched) >= pc.ttl {
+			delete(pc.entries, k)
+		}
+	}
+	pc.entries[key] = parameterCacheEntry{out: out, fetched: now}
+}
+
+func (pc *parameterCache) getListing(key string) (parameterListingEntry, bool) {
+	if !pc.enabled() {
+		return parameterListingEntry{}, false
+	}
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+	entry, ok := pc.listings[key]
+	if !ok || time.Since(entry.fetched) >= pc.ttl {
+		return parameterListingEntry{}, false
+	}
+	return entry, true
+}
+
+// putListing stores a listing under key, dropping any listings that have
+// expired.
+func (pc *parameterCache) putListing(key string, data any, page listPage) {
+	if !pc.enabled() {
+		return
+	}
+	now := time.Now()
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+	for k, e := range pc.listings {
+		if now.Sub(e.fetched) >= pc.ttl {
+			delete(pc.listings, k)
+		}
+	}
+	pc.listings[key] = parameterListingEntry{data: data, page: page, fetched: now}
+}
+
+// setHeaders reports in X-Cache whether a response was served from the
+// cache, with its Age on a hit. It sets nothing while the cache is off.
+func (pc *parameterCache) setHeaders(c *gin.Context, hit bool, fetched time.Time) {
+	if !pc.enabled() {
+		return
+	}
+	status := "MISS"
+	if hit {
+		status = "HIT"
+		c.Header("Age", strconv.Itoa(int(time.Since(fetched).Seconds())))
+	}
+	c.Header(cacheHeader, status)
+}
+
+// flush drops every read and listing and returns how many of each there
+// were.
+func (pc *parameterCache) flush() (reads, listings int) {
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+	reads, listings = len(pc.entries), len(pc.listings)
+	clear(pc.entries)
+	clear(pc.listings)
+	return reads, listings
+}
+
+// invalidates flushes the cache once a write through this service has
+// changed parameters, so its own writes are never read back stale.
+func (pc *parameterCache) invalidates() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+		if c.Writer.Status() < http.StatusBadRequest {
+			pc.flush()
+		}
+	}
+}
+
+type cacheFlush struct {
+	Parameters int `json:"parameters"`
+	Listings   int `json:"listings"`
+	Buckets    int `json:"buckets"`
+}
+
+// flushCachesHandler empties the server-side caches, e.g. right after
+// rotating secrets, and reports how many entries each held.
+func flushCachesHandler(params *parameterCache, buckets *bucketListCache) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		reads, listings := params.flush()
+		respond(c, http.StatusOK, cacheFlush{Parameters: reads, Listings: listings, Buckets: buckets.flush()})
+	}
+}
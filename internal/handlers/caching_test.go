@@ -0,0 +1,394 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	ssmtypes "github.com/aws/aws-sdk-go-v2/service/ssm/types"
+)
+
+// versionedStore serves one parameter whose value changes with every
+// GetParameter call, so a test can tell a cached read from a fresh one.
+// By-path reads and listings likewise change with every call.
+func versionedStore() *fakeSSM {
+	var version atomic.Int64
+	return &fakeSSM{
+		getParameter: func(_ context.Context, in *ssm.GetParameterInput) (*ssm.GetParameterOutput, error) {
+			v := version.Add(1)
+			return &ssm.GetParameterOutput{Parameter: &ssmtypes.Parameter{
+				Name:    in.Name,
+				Value:   aws.String("v" + strconv.FormatInt(v, 10)),
+				Type:    ssmtypes.ParameterTypeString,
+				Version: v,
+			}}, nil
+		},
+		getParametersByPath: func(_ context.Context, in *ssm.GetParametersByPathInput) (*ssm.GetParametersByPathOutput, error) {
+			v := version.Add(1)
+			return &ssm.GetParametersByPathOutput{Parameters: []ssmtypes.Parameter{{
+				Name:    aws.String(aws.ToString(in.Path) + "/db"),
+				Value:   aws.String("v" + strconv.FormatInt(v, 10)),
+				Type:    ssmtypes.ParameterTypeString,
+				Version: v,
+			}}}, nil
+		},
+		describeParameters: func(context.Context, *ssm.DescribeParametersInput) (*ssm.DescribeParametersOutput, error) {
+			v := version.Add(1)
+			return &ssm.DescribeParametersOutput{Parameters: []ssmtypes.ParameterMetadata{
+				{Name: aws.String("/app/v" + strconv.FormatInt(v, 10))},
+			}}, nil
+		},
+		putParameter: func(context.Context, *ssm.PutParameterInput) (*ssm.PutParameterOutput, error) {
+			return &ssm.PutParameterOutput{Version: 1}, nil
+		},
+	}
+}
+
+func TestParameterCacheHeaders(t *testing.T) {
+	tests := []struct {
+		name    string
+		ttl     time.Duration
+		targets []string
+		cache   []string
+		values  []string
+		calls   int
+	}{
+		{
+			name:    "disabled",
+			targets: []string{"/parameters/app/db", "/parameters/app/db"},
+			cache:   []string{"", ""},
+			values:  []string{"v1", "v2"},
+			calls:   2,
+		},
+		{
+			name:    "hit",
+			ttl:     time.Minute,
+			targets: []string{"/parameters/app/db", "/parameters/app/db"},
+			cache:   []string{"MISS", "HIT"},
+			values:  []string{"v1", "v1"},
+			calls:   1,
+		},
+		{
+			name:    "nocache",
+			ttl:     time.Minute,
+			targets: []string{"/parameters/app/db", "/parameters/app/db?nocache=true", "/parameters/app/db"},
+			cache:   []string{"MISS", "MISS", "HIT"},
+			values:  []string{"v1", "v2", "v2"},
+			calls:   2,
+		},
+		{
+			name:    "keyed by decrypt",
+			ttl:     time.Minute,
+			targets: []string{"/parameters/app/db", "/parameters/app/db?decrypt=true", "/parameters/app/db"},
+			cache:   []string{"MISS", "MISS", "HIT"},
+			values:  []string{"v1", "v2", "v1"},
+			calls:   2,
+		},
+		{
+			name:    "keyed by name",
+			ttl:     time.Minute,
+			targets: []string{"/parameters/app/db", "/parameters/app/other"},
+			cache:   []string{"MISS", "MISS"},
+			values:  []string{"v1", "v2"},
+			calls:   2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := versionedStore()
+			cfg := testConfig(t)
+			cfg.ParameterCacheTTL = tt.ttl
+			s := newTestServer(t, cfg, testClients(&fakeS3{}, fake))
+
+			for i, target := range tt.targets {
+				w := s.do(t, http.MethodGet, target, "", apiKeyHeader, testDecryptKey)
+				var got string
+				decodeData(t, w, &got)
+				if got != tt.values[i] {
+					t.Errorf("%s: value = %q, want %q", target, got, tt.values[i])
+				}
+				if got := w.Header().Get(cacheHeader); got != tt.cache[i] {
+					t.Errorf("%s: %s = %q, want %q", target, cacheHeader, got, tt.cache[i])
+				}
+				if _, ok := w.Header()["Age"]; ok != (tt.cache[i] == "HIT") {
+					t.Errorf("%s: Age header present = %v on %q", target, ok, tt.cache[i])
+				}
+			}
+			if n := fake.count("GetParameter"); n != tt.calls {
+				t.Errorf("GetParameter calls = %d, want %d", n, tt.calls)
+			}
+		})
+	}
+}
+
+func TestParameterListingCache(t *testing.T) {
+	type step struct {
+		method string // GET when empty
+		target string
+		cache  string
+		value  string // the value the response carries, "" for a write
+	}
+	tests := []struct {
+		name  string
+		ttl   time.Duration
+		steps []step
+		op    string
+		calls int
+	}{
+		{
+			name:  "disabled",
+			steps: []step{{target: "/parameters", value: "v1"}, {target: "/parameters", value: "v2"}},
+			op:    "DescribeParameters",
+			calls: 2,
+		},
+		{
+			name:  "list hit",
+			ttl:   time.Minute,
+			steps: []step{{target: "/parameters?prefix=/app&type=String", cache: "MISS", value: "v1"}, {target: "/parameters?type=String&prefix=/app", cache: "HIT", value: "v1"}},
+			op:    "DescribeParameters",
+			calls: 1,
+		},
+		{
+			name:  "list keyed by query",
+			ttl:   time.Minute,
+			steps: []step{{target: "/parameters?prefix=/app", cache: "MISS", value: "v1"}, {target: "/parameters?prefix=/svc", cache: "MISS", value: "v2"}},
+			op:    "DescribeParameters",
+			calls: 2,
+		},
+		{
+			name: "list nocache",
+			ttl:  time.Minute,
+			steps: []step{
+				{target: "/parameters", cache: "MISS", value: "v1"},
+				{target: "/parameters?nocache=true", cache: "MISS", value: "v2"},
+				{target: "/parameters", cache: "HIT", value: "v2"},
+			},
+			op:    "DescribeParameters",
+			calls: 2,
+		},
+		{
+			name:  "by-path hit",
+			ttl:   time.Minute,
+			steps: []step{{target: "/parameters/by-path?path=/app", cache: "MISS", value: "v1"}, {target: "/parameters/by-path?path=/app", cache: "HIT", value: "v1"}},
+			op:    "GetParametersByPath",
+			calls: 1,
+		},
+		{
+			name: "by-path keyed by path and decrypt",
+			ttl:  time.Minute,
+			steps: []step{
+				{target: "/parameters/by-path?path=/app", cache: "MISS", value: "v1"},
+				{target: "/parameters/by-path?path=/svc", cache: "MISS", value: "v2"},
+				{target: "/parameters/by-path?path=/app&decrypt=true", cache: "MISS", value: "v3"},
+				{target: "/parameters/by-path?path=/app", cache: "HIT", value: "v1"},
+			},
+			op:    "GetParametersByPath",
+			calls: 3,
+		},
+		{
+			name: "by-path keyed by region",
+			ttl:  time.Minute,
+			steps: []step{
+				{target: "/parameters/by-path?path=/app", cache: "MISS", value: "v1"},
+				{target: "/parameters/by-path?path=/app&region=eu-west-1", cache: "MISS", value: "v2"},
+			},
+			op:    "GetParametersByPath",
+			calls: 2,
+		},
+		{
+			name: "write invalidates",
+			ttl:  time.Minute,
+			steps: []step{
+				{target: "/parameters/by-path?path=/app", cache: "MISS", value: "v1"},
+				{method: http.MethodPut, target: "/parameters/app/db"},
+				{target: "/parameters/by-path?path=/app", cache: "MISS", value: "v2"},
+			},
+			op:    "GetParametersByPath",
+			calls: 2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := versionedStore()
+			cfg := testConfig(t)
+			cfg.ParameterCacheTTL = tt.ttl
+			cfg.EnableWrites = true
+			cfg.AllowedRegions = []string{testRegion, "eu-west-1"}
+			s := newTestServer(t, cfg, testClients(&fakeS3{}, fake))
+
+			for _, st := range tt.steps {
+				if st.method != "" {
+					if w := s.do(t, st.method, st.target, `{"value": "v"}`, apiKeyHeader, testAdminKey); w.Code != http.StatusOK {
+						t.Fatalf("%s %s: status = %d: %s", st.method, st.target, w.Code, w.Body)
+					}
+					continue
+				}
+				w := s.do(t, http.MethodGet, st.target, "", apiKeyHeader, testDecryptKey)
+				if w.Code != http.StatusOK {
+					t.Fatalf("%s: status = %d: %s", st.target, w.Code, w.Body)
+				}
+				if got := w.Header().Get(cacheHeader); got != st.cache {
+					t.Errorf("%s: %s = %q, want %q", st.target, cacheHeader, got, st.cache)
+				}
+				if !strings.Contains(w.Body.String(), st.value+`"`) {
+					t.Errorf("%s: body = %s, want value %s", st.target, w.Body, st.value)
+				}
+			}
+			if n := fake.count(tt.op); n != tt.calls {
+				t.Errorf("%s calls = %d, want %d", tt.op, n, tt.calls)
+			}
+		})
+	}
+}
+
+func TestParameterCacheExpiry(t *testing.T) {
+	tests := []struct {
+		name  string
+		age   time.Duration
+		cache string
+		value string
+		want  string
+		calls int
+	}{
+		{name: "fresh", age: 90 * time.Second, cache: "HIT", value: "v1", want: "90", calls: 1},
+		{name: "stale refetched", age: 5 * time.Minute, cache: "MISS", value: "v2", calls: 2},
+		{name: "long expired", age: time.Hour, cache: "MISS", value: "v2", calls: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := versionedStore()
+			cache := newParameterCache(5 * time.Minute)
+			cfg := testConfig(t)
+			r := handlerRouter(http.MethodGet, "/parameters/*name", getParameterHandler(testClients(&fakeS3{}, fake),
+				newLiveConfig(cfg.tunables()), cache, false, nil))
+
+			serveRequest(t, r, http.MethodGet, "/parameters/app/db", "")
+			cache.mu.Lock()
+			for k, e := range cache.entries {
+				e.fetched = e.fetched.Add(-tt.age)
+				cache.entries[k] = e
+			}
+			cache.mu.Unlock()
+
+			w := serveRequest(t, r, http.MethodGet, "/parameters/app/db", "")
+			var got string
+			decodeData(t, w, &got)
+			if got != tt.value {
+				t.Errorf("value = %q, want %q", got, tt.value)
+			}
+			if got := w.Header().Get(cacheHeader); got != tt.cache {
+				t.Errorf("%s = %q, want %q", cacheHeader, got, tt.cache)
+			}
+			if got := w.Header().Get("Age"); got != tt.want {
+				t.Errorf("Age = %q, want %q", got, tt.want)
+			}
+			if n := fake.count("GetParameter"); n != tt.calls {
+				t.Errorf("GetParameter calls = %d, want %d", n, tt.calls)
+			}
+		})
+	}
+}
+
+func TestParameterCacheConcurrent(t *testing.T) {
+	fake := versionedStore()
+	cfg := testConfig(t)
+	cfg.ParameterCacheTTL = time.Minute
+	s := newTestServer(t, cfg, testClients(&fakeS3{}, fake))
+
+	const readers = 50
+	var wg sync.WaitGroup
+	codes := make([]int, readers)
+	for i := range readers {
+		wg.Go(func() {
+			target := "/parameters/app/db"
+			if i%2 == 1 {
+				target = "/parameters/app/other"
+			}
+			codes[i] = s.do(t, http.MethodGet, target, "").Code
+		})
+		if i%10 == 0 {
+			wg.Go(func() {
+				s.do(t, http.MethodDelete, "/cache", "", apiKeyHeader, testAdminKey)
+			})
+		}
+	}
+	wg.Wait()
+
+	for i, code := range codes {
+		if code != http.StatusOK {
+			t.Errorf("reader %d: status = %d, want 200", i, code)
+		}
+	}
+	if n := fake.count("GetParameter"); n < 2 || n > readers {
+		t.Errorf("GetParameter calls = %d, want between 2 and %d", n, readers)
+	}
+
+	// once the flushes are done both names are cached again
+	s.do(t, http.MethodGet, "/parameters/app/db", "")
+	s.do(t, http.MethodGet, "/parameters/app/other", "")
+	before := fake.count("GetParameter")
+	for range 10 {
+		if w := s.do(t, http.MethodGet, "/parameters/app/db", ""); w.Header().Get(cacheHeader) != "HIT" {
+			t.Fatalf("%s = %q after warm-up, want HIT", cacheHeader, w.Header().Get(cacheHeader))
+		}
+	}
+	if n := fake.count("GetParameter"); n != before {
+		t.Errorf("GetParameter calls = %d after warm-up, want %d", n, before)
+	}
+}
+
+func TestFlushCachesHandler(t *testing.T) {
+	tests := []struct {
+		name    string
+		header  []string
+		status  int
+		code    string
+		flushed cacheFlush
+	}{
+		{name: "flushed", header: []string{apiKeyHeader, testAdminKey}, flushed: cacheFlush{Parameters: 2, Listings: 2, Buckets: 1}},
+		{name: "missing key", status: http.StatusUnauthorized, code: "unauthorized"},
+		{name: "non-admin key", header: []string{apiKeyHeader, testDecryptKey}, status: http.StatusForbidden, code: "forbidden"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fakeSSM := versionedStore()
+			fakeS3 := &fakeS3{listBuckets: func(context.Context, *s3.ListBucketsInput) (*s3.ListBucketsOutput, error) {
+				return &s3.ListBucketsOutput{Buckets: []s3types.Bucket{{Name: aws.String("alpha")}}}, nil
+			}}
+			cfg := testConfig(t)
+			cfg.ParameterCacheTTL = time.Minute
+			s := newTestServer(t, cfg, testClients(fakeS3, fakeSSM))
+			warm := []string{"/parameters/app/db", "/parameters/app/other", "/parameters?prefix=/app", "/parameters/by-path?path=/app", "/buckets"}
+			for _, target := range warm {
+				s.do(t, http.MethodGet, target, "")
+			}
+
+			w := s.do(t, http.MethodDelete, "/cache", "", tt.header...)
+			want := "HIT"
+			if tt.status != 0 {
+				wantError(t, w, tt.status, tt.code)
+			} else {
+				var got cacheFlush
+				decodeData(t, w, &got)
+				if got != tt.flushed {
+					t.Errorf("flushed = %+v, want %+v", got, tt.flushed)
+				}
+				want = "MISS"
+			}
+			for _, target := range warm {
+				if got := s.do(t, http.MethodGet, target, "").Header().Get(cacheHeader); got != want {
+					t.Errorf("%s after flush: %s = %q, want %q", target, cacheHeader, got, want)
+				}
+			}
+		})
+	}
+}
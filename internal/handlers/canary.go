@@ -0,0 +1,67 @@
+package handlers
+
+import (
+	"context"
+	"log/slog"
+	"math/rand/v2"
+	"sync/atomic"
+	"time"
+)
+
+// canaryReportInterval is how often the observed canary split is logged.
+const canaryReportInterval = time.Minute
+
+// canaryVersion makes a share of responses report a different version in
+// the envelope, to test how clients react to a version change. Each request
+// is picked independently at random.
+type canaryVersion struct {
+	version string
+	percent int
+
+	served atomic.Int64
+	canary atomic.Int64
+}
+
+func newCanaryVersion(version string, percent int) *canaryVersion {
+	return &canaryVersion{version: version, percent: percent}
+}
+
+func (cv *canaryVersion) enabled() bool {
+	return cv != nil && cv.percent > 0
+}
+
+// pick returns the version one response should report.
+func (cv *canaryVersion) pick(version string) string {
+	if !cv.enabled() {
+		return version
+	}
+	cv.served.Add(1)
+	if rand.IntN(100) < cv.percent {
+		cv.canary.Add(1)
+		return cv.version
+	}
+	return version
+}
+
+// run logs the split observed since the previous report until ctx is
+// cancelled. Quiet intervals are skipped.
+func (cv *canaryVersion) run(ctx context.Context) {
+	if !cv.enabled() {
+		return
+	}
+	ticker := time.NewTicker(canaryReportInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			served, canary := cv.served.Swap(0), cv.canary.Swap(0)
+			if served == 0 {
+				continue
+			}
+			slog.Info("canary split", "version", cv.version, "served", served, "canary", canary,
+				"observedPercent", float64(canary)*100/float64(served), "targetPercent", cv.percent)
+		}
+	}
+}
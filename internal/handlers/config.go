@@ -0,0 +1,208 @@
+package handlers
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Config is the service configuration, read from the environment.
+type Config struct {
+	VERSION string `envconfig:"VERSION" required:"true"`
+	// ListenAddr is the address the API listens on.
+	ListenAddr string `envconfig:"LISTEN_ADDR" default:":8081"`
+	// ShutdownTimeout is how long in-flight requests get to finish after
+	// SIGINT or SIGTERM.
+	ShutdownTimeout time.Duration `envconfig:"SHUTDOWN_TIMEOUT" default:"30s"`
+	// TLSCertFile and TLSKeyFile, when both set, serve the API over TLS.
+	TLSCertFile string `envconfig:"TLS_CERT_FILE"`
+	TLSKeyFile  string `envconfig:"TLS_KEY_FILE"`
+	// Environment, when set, is echoed in every response so clients can tell
+	// prod from staging.
+	Environment string `envconfig:"ENVIRONMENT"`
+	// UserAgentName is sent as "<name>/<VERSION>" on every AWS SDK request
+	// so CloudTrail attributes the calls to this service.
+	UserAgentName string `envconfig:"USER_AGENT_NAME" default:"aux-kxc"`
+	// AWSCallTimeout bounds every AWS call other than object transfers,
+	// retries included; 0 leaves calls bounded only by the request.
+	AWSCallTimeout time.Duration `envconfig:"AWS_CALL_TIMEOUT" default:"0s"`
+	// AWSRetryMode is standard or adaptive; AWSMaxRetries and AWSMaxBackoff
+	// tune it.
+	AWSRetryMode  string        `envconfig:"AWS_RETRY_MODE" default:"standard"`
+	AWSMaxRetries int           `envconfig:"AWS_MAX_RETRIES" default:"2"`
+	AWSMaxBackoff time.Duration `envconfig:"AWS_MAX_BACKOFF" default:"20s"`
+	// MaxConcurrentAWSCalls caps the in-flight calls to each of S3 and SSM,
+	// and S3RPS and SSMRPS their calls a second, to stay under the AWS API
+	// limits; 0 disables a limit. A call that can't proceed within
+	// AWSCallLimitWait is refused with a 429.
+	MaxConcurrentAWSCalls int           `envconfig:"MAX_CONCURRENT_AWS_CALLS" default:"0"`
+	S3RPS                 float64       `envconfig:"S3_RPS" default:"0"`
+	SSMRPS                float64       `envconfig:"SSM_RPS" default:"0"`
+	AWSCallLimitWait      time.Duration `envconfig:"AWS_CALL_LIMIT_WAIT" default:"1s"`
+	// AllowedRegions are the regions ?region= and X-Region may send SSM
+	// calls to, besides the configured one; every region of the standard
+	// AWS partitions when empty.
+	AllowedRegions []string `envconfig:"ALLOWED_REGIONS"`
+	// AssumeRoleARN, when set, makes every AWS call as this role, e.g. one
+	// in another account; RoleSessionName names the sessions and
+	// AssumeRoleExternalID is passed when the role's trust policy needs one.
+	AssumeRoleARN        string `envconfig:"ASSUME_ROLE_ARN"`
+	RoleSessionName      string `envconfig:"ROLE_SESSION_NAME" default:"aux-kxc"`
+	AssumeRoleExternalID string `envconfig:"ASSUME_ROLE_EXTERNAL_ID" secret:"true"`
+	// StartupRetry is how long failed AWS client initialization is retried
+	// quietly, with exponential backoff, before each further attempt is
+	// logged as an error. Retries continue until one succeeds; the API
+	// answers 503 meanwhile.
+	StartupRetry time.Duration `envconfig:"STARTUP_RETRY" default:"2m"`
+	// AdminAPIKey unlocks the admin-only endpoints; they are closed when unset.
+	AdminAPIKey string `envconfig:"ADMIN_API_KEY" secret:"true"`
+	// APIKeys grants scopes to further API keys, as a JSON object of key to
+	// scopes, e.g. {"key-1": ["decrypt"]}. The admin key holds every scope.
+	APIKeys apiKeyScopes `envconfig:"API_KEYS" secret:"true"`
+	// AllowDecrypt honors ?decrypt=true at all; turn it off to run a
+	// variant of the service that never hands out secrets.
+	AllowDecrypt bool `envconfig:"ALLOW_DECRYPT" default:"true"`
+	// EnableWrites registers the parameter write routes (PUT and DELETE
+	// /parameters/*name, batch-set, copy-tree); without it they don't exist.
+	EnableWrites bool `envconfig:"ENABLE_WRITES"`
+	// MaxUploadSize caps the body of object uploads, in bytes.
+	MaxUploadSize int64 `envconfig:"MAX_UPLOAD_SIZE" default:"5368709120"`
+	// DefaultContentType is stored for uploads that send no Content-Type and
+	// whose key has no known extension.
+	DefaultContentType string `envconfig:"DEFAULT_CONTENT_TYPE" default:"application/octet-stream"`
+	// MaxEncodedObjectSize caps objects returned base64/hex-encoded in JSON.
+	MaxEncodedObjectSize int64 `envconfig:"MAX_ENCODED_OBJECT_SIZE" default:"10485760"`
+	// ArchiveMaxSize caps the total object bytes of a zip download and
+	// ArchiveTimeout bounds how long one may stream.
+	ArchiveMaxSize int64         `envconfig:"ARCHIVE_MAX_SIZE" default:"1073741824"`
+	ArchiveTimeout time.Duration `envconfig:"ARCHIVE_TIMEOUT" default:"5m"`
+	// PresignMaxExpiry caps the lifetime of presigned upload and download URLs.
+	PresignMaxExpiry time.Duration `envconfig:"PRESIGN_MAX_EXPIRY" default:"1h"`
+	// BucketAllowlist limits the exposed buckets; all buckets when empty.
+	BucketAllowlist []string `envconfig:"BUCKET_ALLOWLIST"`
+	// MaxResponseItems caps the items a listing returns; a client ?limit= can
+	// only lower it. Capped listings come back with truncated and nextToken.
+	// 0 disables the cap.
+	MaxResponseItems int `envconfig:"MAX_RESPONSE_ITEMS" default:"10000"`
+	// Cache-Control max-age advertised per endpoint type; 0 sends no-cache.
+	ListingMaxAge   time.Duration `envconfig:"LISTING_MAX_AGE" default:"0s"`
+	ParameterMaxAge time.Duration `envconfig:"PARAMETER_MAX_AGE" default:"0s"`
+	// ErrorVerbosity is "minimal" (sanitized errors) or "full", which adds
+	// the underlying AWS error code, message and request ID to error bodies.
+	ErrorVerbosity string `envconfig:"ERROR_VERBOSITY" default:"minimal"`
+	// ParameterWaitAttempts and ParameterWaitBackoff tune ?wait=true reads:
+	// the number of GetParameter tries and the initial delay between them.
+	ParameterWaitAttempts int           `envconfig:"PARAMETER_WAIT_ATTEMPTS" default:"4"`
+	ParameterWaitBackoff  time.Duration `envconfig:"PARAMETER_WAIT_BACKOFF" default:"200ms"`
+	// SlowRequestThreshold logs a WARN line for requests slower than this.
+	SlowRequestThreshold time.Duration `envconfig:"SLOW_REQUEST_THRESHOLD" default:"1s"`
+	// HeavyMaxConcurrent and LightMaxConcurrent cap in-flight requests for
+	// object streaming routes and for everything else respectively; a class
+	// at its cap answers 503. 0 means unlimited.
+	HeavyMaxConcurrent int `envconfig:"HEAVY_MAX_CONCURRENT"`
+	LightMaxConcurrent int `envconfig:"LIGHT_MAX_CONCURRENT"`
+	// HeavyQueueDepth lets that many heavy requests wait, for at most
+	// HeavyQueueTimeout, when the class is at its cap, taking turns by client
+	// IP. A full queue answers 429; 0 disables queueing.
+	HeavyQueueDepth   int           `envconfig:"HEAVY_QUEUE_DEPTH"`
+	HeavyQueueTimeout time.Duration `envconfig:"HEAVY_QUEUE_TIMEOUT" default:"10s"`
+	// OverloadThreshold sheds new requests of a capped class with a 503
+	// once its in-flight plus queued requests reach this multiple of the
+	// cap. 0 disables shedding.
+	OverloadThreshold float64 `envconfig:"OVERLOAD_THRESHOLD"`
+	// HealthCheckServices lists the services (s3, ssm) readiness requires;
+	// by default, every service that initialized at startup.
+	HealthCheckServices []string `envconfig:"HEALTH_CHECK_SERVICES"`
+	// LogLevel is the minimum level logged: debug, info, warn or error.
+	LogLevel string `envconfig:"LOG_LEVEL" default:"info"`
+	// LogFormat is json, for the log pipeline, or text for local runs.
+	LogFormat string `envconfig:"LOG_FORMAT" default:"json"`
+	// ReloadParameter optionally names an SSM parameter holding a JSON object
+	// of setting overrides applied at startup and by POST /admin/reload.
+	ReloadParameter string `envconfig:"RELOAD_PARAMETER"`
+	// CredentialCheckInterval is how often the watchdog re-validates the AWS
+	// credentials; readiness flips after CredentialCheckFailures in a row.
+	CredentialCheckInterval time.Duration `envconfig:"CREDENTIAL_CHECK_INTERVAL" default:"30s"`
+	CredentialCheckFailures int           `envconfig:"CREDENTIAL_CHECK_FAILURES" default:"3"`
+	// CredentialCheckTimeout bounds each re-validation, so a hung STS call
+	// counts as a failure instead of stalling the watchdog.
+	CredentialCheckTimeout time.Duration `envconfig:"CREDENTIAL_CHECK_TIMEOUT" default:"5s"`
+	// PprofEnabled mounts net/http/pprof under /debug/pprof: on PprofAddr
+	// when set (unauthenticated, keep it internal), otherwise on the main
+	// router behind admin auth.
+	PprofEnabled bool   `envconfig:"PPROF_ENABLED"`
+	PprofAddr    string `envconfig:"PPROF_ADDR"`
+	// AsyncEnabled defers expensive operations to an SQS-driven worker that
+	// stores results under AsyncResultsPrefix in AsyncResultsBucket.
+	AsyncEnabled       bool   `envconfig:"ASYNC_ENABLED"`
+	AsyncQueueURL      string `envconfig:"ASYNC_QUEUE_URL"`
+	AsyncResultsBucket string `envconfig:"ASYNC_RESULTS_BUCKET"`
+	AsyncResultsPrefix string `envconfig:"ASYNC_RESULTS_PREFIX" default:"aux-jobs/"`
+	// CanaryVersion is reported instead of VERSION in CanaryPercent percent
+	// of response envelopes, to test clients against a version change.
+	CanaryVersion string `envconfig:"CANARY_VERSION"`
+	CanaryPercent int    `envconfig:"CANARY_PERCENT" default:"0"`
+	// ParameterWatchInterval is how often GET /parameters/<name>/watch polls
+	// for a new version; at most ParameterMaxWatchers streams are open at
+	// once. 0 means unlimited.
+	ParameterWatchInterval time.Duration `envconfig:"PARAMETER_WATCH_INTERVAL" default:"5s"`
+	ParameterMaxWatchers   int           `envconfig:"PARAMETER_MAX_WATCHERS" default:"100"`
+	// BucketListCacheTTL is how long GET /buckets results are reused; 0
+	// disables the cache.
+	BucketListCacheTTL time.Duration `envconfig:"BUCKET_LIST_CACHE_TTL" default:"30s"`
+	// ParameterCacheTTL is how long parameter reads, by-path reads and
+	// listings are reused; 0 disables the cache. DELETE /cache empties it.
+	ParameterCacheTTL time.Duration `envconfig:"PARAMETER_CACHE_TTL" default:"0s"`
+	// InterpolationVars lists the server-side values (REGION, ENVIRONMENT,
+	// ACCOUNT) that ?interpolate=true may substitute into parameter values.
+	InterpolationVars []string `envconfig:"INTERPOLATION_VARS" default:"REGION,ENVIRONMENT,ACCOUNT"`
+	// AuditLog is where parameter reads are audited: "stdout", a file path,
+	// or empty to disable auditing.
+	AuditLog string `envconfig:"AUDIT_LOG"`
+}
+
+// Redacted returns the effective configuration keyed by environment variable,
+// with fields tagged secret masked, for logging at startup.
+func (cfg Config) Redacted() map[string]string {
+	out := map[string]string{}
+	v := reflect.ValueOf(cfg)
+	for i := 0; i < v.NumField(); i++ {
+		f := v.Type().Field(i)
+		value := fmt.Sprint(v.Field(i).Interface())
+		if f.Tag.Get("secret") == "true" && value != "" {
+			value = "[redacted]"
+		}
+		out[f.Tag.Get("envconfig")] = value
+	}
+	return out
+}
+
+// logConfig dumps the effective non-secret configuration in one line so
+// operators can confirm how an instance was set up.
+func logConfig(cfg Config, addr, region string) {
+	redacted := cfg.Redacted()
+	keys := make([]string, 0, len(redacted))
+	for k := range redacted {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	attrs := []any{"addr", addr, "gin_mode", gin.Mode(), "region", region}
+	for _, k := range keys {
+		attrs = append(attrs, k, redacted[k])
+	}
+	slog.Info("config", attrs...)
+}
+
+// EnvPrefix returns the ENV_PREFIX namespace for the configuration, e.g.
+// AUXKXC to read AUXKXC_VERSION. A prefixed variable takes precedence over
+// the plain one, which is still read as a fallback, so required settings
+// can come from either.
+func EnvPrefix() string {
+	return strings.TrimSuffix(os.Getenv("ENV_PREFIX"), "_")
+}
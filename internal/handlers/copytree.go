@@ -0,0 +1,175 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	ssmtypes "github.com/aws/aws-sdk-go-v2/service/ssm/types"
+	"github.com/gin-gonic/gin"
+)
+
+type copyTreeRequest struct {
+	Source    string `json:"source" binding:"required"`
+	Dest      string `json:"dest" binding:"required"`
+	Overwrite bool   `json:"overwrite"`
+	DryRun    bool   `json:"dryRun"`
+	// KMSKeyID re-encrypts SecureStrings under dest with this key instead of
+	// the account default.
+	KMSKeyID string `json:"kmsKeyId"`
+}
+
+// copyTreeResult reports one parameter. Status is "copied", "skipped" (dest
+// exists and overwrite is off), "failed", or with dryRun "planned". A dest
+// name that isn't a valid parameter name fails without a write, dryRun
+// included.
+type copyTreeResult struct {
+	Source  string    `json:"source"`
+	Dest    string    `json:"dest"`
+	Type    string    `json:"type"`
+	Status  string    `json:"status"`
+	Version int64     `json:"version,omitempty"`
+	Error   *apiError `json:"error,omitempty"`
+}
+
+type copyTreeResponse struct {
+	Source  string           `json:"source"`
+	Dest    string           `json:"dest"`
+	DryRun  bool             `json:"dryRun"`
+	Results []copyTreeResult `json:"results"`
+}
+
+// sourceParameters fetches every parameter below path, decrypted.
+func sourceParameters(ctx context.Context, cl *awsClients, path string) ([]ssmtypes.Parameter, error) {
+	var params []ssmtypes.Parameter
+	paginator := ssm.NewGetParametersByPathPaginator(cl.ssmFor(ctx), &ssm.GetParametersByPathInput{
+		Path:           aws.String(path),
+		Recursive:      aws.Bool(true),
+		WithDecryption: aws.Bool(true),
+	})
+	for paginator.HasMorePages() {
+		out, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+		params = append(params, out.Parameters...)
+	}
+	return params, nil
+}
+
+// copyTreeParametersHandler copies every parameter under source to the same
+// relative name under dest, e.g. to bootstrap an environment from another.
+// Types are kept and SecureStrings stay encrypted. Existing parameters are
+// skipped unless overwrite is set; dryRun only reports what would happen.
+// Only the value and type are copied, with the tier chosen from the value
+// size, not description, tags or policies. The response is 200 when no
+// parameter failed and 207 otherwise.
+func copyTreeParametersHandler(cl *awsClients) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req copyTreeRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			respondError(c, http.StatusBadRequest, "bad_request", `body must be {"source": "...", "dest": "...", "overwrite": bool, "dryRun": bool}`)
+			return
+		}
+		source := "/" + strings.Trim(req.Source, "/")
+		dest := "/" + strings.Trim(req.Dest, "/")
+		if source == "/" || dest == "/" {
+			respondError(c, http.StatusBadRequest, "bad_request", "source and dest must not be the root")
+			return
+		}
+		if err := checkWritableParameterName(dest); err != nil {
+			respondError(c, http.StatusBadRequest, "bad_request", "dest: "+err.Error())
+			return
+		}
+		// a dest inside source would be listed while it is being written
+		if source == dest || strings.HasPrefix(dest+"/", source+"/") || strings.HasPrefix(source+"/", dest+"/") {
+			respondError(c, http.StatusBadRequest, "bad_request", "source and dest must not overlap")
+			return
+		}
+		ctx := c.Request.Context()
+		logger := loggerFrom(ctx)
+
+		params, err := sourceParameters(ctx, cl, source)
+		if err != nil {
+			respondAWSError(c, err, http.StatusInternalServerError, "internal", "failed to list source parameters")
+			return
+		}
+		status := http.StatusOK
+		results := make([]copyTreeResult, len(params))
+		for i, p := range params {
+			results[i] = copyTreeResult{
+				Source: aws.ToString(p.Name),
+				Dest:   dest + strings.TrimPrefix(aws.ToString(p.Name), source),
+				Type:   string(p.Type),
+			}
+			// a rewritten name can still break SSM's rules, e.g. its length
+			if err := checkWritableParameterName(results[i].Dest); err != nil {
+				results[i].Status = "failed"
+				results[i].Error = &apiError{Code: "bad_request", Message: err.Error()}
+				status = http.StatusMultiStatus
+			}
+		}
+
+		var existing map[string]*priorParameter
+		if req.DryRun && !req.Overwrite {
+			var names []string
+			for _, r := range results {
+				if r.Status == "" {
+					names = append(names, r.Dest)
+				}
+			}
+			if existing, err = priorParameters(ctx, cl, names); err != nil {
+				respondAWSError(c, err, http.StatusInternalServerError, "internal", "failed to read dest parameters")
+				return
+			}
+		}
+
+		for i, p := range params {
+			r := &results[i]
+			if r.Status == "failed" {
+				continue
+			}
+			if req.DryRun {
+				r.Status = "planned"
+				if existing[r.Dest] != nil {
+					r.Status = "skipped"
+				}
+				continue
+			}
+			value := aws.ToString(p.Value)
+			tier := ssmtypes.ParameterTierStandard
+			if len(value) > maxStandardValueSize {
+				tier = ssmtypes.ParameterTierAdvanced
+			}
+			in := &ssm.PutParameterInput{
+				Name:      aws.String(r.Dest),
+				Value:     aws.String(value),
+				Type:      p.Type,
+				Tier:      tier,
+				Overwrite: aws.Bool(req.Overwrite),
+			}
+			if p.Type == ssmtypes.ParameterTypeSecureString && req.KMSKeyID != "" {
+				in.KeyId = aws.String(req.KMSKeyID)
+			}
+			out, err := cl.ssmFor(ctx).PutParameter(ctx, in)
+			if err != nil {
+				var exists *ssmtypes.ParameterAlreadyExists
+				if errors.As(err, &exists) {
+					r.Status = "skipped"
+					continue
+				}
+				logger.Warn("copy tree: put failed", "source", r.Source, "dest", r.Dest, "err", err)
+				r.Status = "failed"
+				r.Error = parameterItemError(err)
+				status = http.StatusMultiStatus
+				continue
+			}
+			r.Status = "copied"
+			r.Version = out.Version
+		}
+		respond(c, status, copyTreeResponse{Source: source, Dest: dest, DryRun: req.DryRun, Results: results})
+	}
+}
@@ -0,0 +1,103 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	ssmtypes "github.com/aws/aws-sdk-go-v2/service/ssm/types"
+)
+
+func TestCopyTreeDestNames(t *testing.T) {
+	// a source name that only fits under a short prefix
+	long := "/src/" + strings.Repeat("a", maxParameterNameLength-len("/src/"))
+	tests := []struct {
+		name   string
+		body   string
+		status int
+		want   map[string]string // dest name to result status
+		puts   int
+	}{
+		{
+			name:   "copied",
+			body:   `{"source": "/src", "dest": "/dst"}`,
+			status: http.StatusOK,
+			want:   map[string]string{"/dst/a": "copied", "/dst/b/c": "copied", "/dst/" + long[len("/src/"):]: "copied"},
+			puts:   3,
+		},
+		{
+			name:   "dest too long",
+			body:   `{"source": "/src", "dest": "/longer-dest"}`,
+			status: http.StatusMultiStatus,
+			want:   map[string]string{"/longer-dest/a": "copied", "/longer-dest/b/c": "copied", "/longer-dest/" + long[len("/src/"):]: "failed"},
+			puts:   2,
+		},
+		{
+			name:   "dest too long dry run",
+			body:   `{"source": "/src", "dest": "/longer-dest", "dryRun": true}`,
+			status: http.StatusMultiStatus,
+			want:   map[string]string{"/longer-dest/a": "planned", "/longer-dest/b/c": "planned", "/longer-dest/" + long[len("/src/"):]: "failed"},
+		},
+		{name: "selector in dest", body: `{"source": "/src", "dest": "/dst:3"}`, status: http.StatusBadRequest},
+		{name: "bad character in dest", body: `{"source": "/src", "dest": "/d st"}`, status: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := &fakeSSM{
+				getParametersByPath: func(context.Context, *ssm.GetParametersByPathInput) (*ssm.GetParametersByPathOutput, error) {
+					var params []ssmtypes.Parameter
+					for _, name := range []string{"/src/a", "/src/b/c", long} {
+						params = append(params, ssmtypes.Parameter{Name: aws.String(name), Value: aws.String("v"), Type: ssmtypes.ParameterTypeString})
+					}
+					return &ssm.GetParametersByPathOutput{Parameters: params}, nil
+				},
+				getParameters: func(_ context.Context, in *ssm.GetParametersInput) (*ssm.GetParametersOutput, error) {
+					for _, name := range in.Names {
+						if err := checkWritableParameterName(name); err != nil {
+							t.Errorf("GetParameters with invalid name %q", name)
+						}
+					}
+					return &ssm.GetParametersOutput{InvalidParameters: in.Names}, nil
+				},
+				putParameter: func(_ context.Context, in *ssm.PutParameterInput) (*ssm.PutParameterOutput, error) {
+					if err := checkWritableParameterName(aws.ToString(in.Name)); err != nil {
+						t.Errorf("PutParameter with invalid name %q", aws.ToString(in.Name))
+					}
+					return &ssm.PutParameterOutput{Version: 1}, nil
+				},
+			}
+			cfg := testConfig(t)
+			cfg.EnableWrites = true
+			s := newTestServer(t, cfg, testClients(&fakeS3{}, fake))
+
+			w := s.do(t, http.MethodPost, "/parameters/copy-tree", tt.body, apiKeyHeader, testAdminKey)
+			if tt.status == http.StatusBadRequest {
+				wantError(t, w, tt.status, "bad_request")
+				return
+			}
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d", w.Code, tt.status)
+			}
+			var res copyTreeResponse
+			decodeData(t, w, &res)
+			got := map[string]string{}
+			for _, r := range res.Results {
+				got[r.Dest] = r.Status
+			}
+			if len(got) != len(tt.want) {
+				t.Errorf("results = %v, want %v", got, tt.want)
+			}
+			for dest, want := range tt.want {
+				if got[dest] != want {
+					t.Errorf("%.40s...: status %q, want %q", dest, got[dest], want)
+				}
+			}
+			if n := fake.count("PutParameter"); n != tt.puts {
+				t.Errorf("PutParameter calls = %d, want %d", n, tt.puts)
+			}
+		})
+	}
+}
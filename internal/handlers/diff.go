@@ -0,0 +1,116 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	"github.com/gin-gonic/gin"
+)
+
+type changedParameter struct {
+	Name  string `json:"name"`
+	Left  string `json:"left,omitempty"`
+	Right string `json:"right,omitempty"`
+}
+
+type parameterDiff struct {
+	Left      string             `json:"left"`
+	Right     string             `json:"right"`
+	OnlyLeft  []string           `json:"onlyLeft"`
+	OnlyRight []string           `json:"onlyRight"`
+	Changed   []changedParameter `json:"changed"`
+}
+
+// parametersUnder returns the decrypted values below path keyed by name
+// relative to it, stopping after max parameters (0 means no cap) and
+// reporting whether it did.
+func parametersUnder(ctx context.Context, cl *awsClients, path string, max int) (map[string]string, bool, error) {
+	path = "/" + strings.Trim(path, "/")
+	values := map[string]string{}
+	paginator := ssm.NewGetParametersByPathPaginator(cl.ssmFor(ctx), &ssm.GetParametersByPathInput{
+		Path:           aws.String(path),
+		Recursive:      aws.Bool(true),
+		WithDecryption: aws.Bool(true),
+	})
+	for paginator.HasMorePages() {
+		out, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, false, err
+		}
+		for _, p := range out.Parameters {
+			if max > 0 && len(values) >= max {
+				return values, true, nil
+			}
+			values[strings.TrimPrefix(aws.ToString(p.Name), path)] = aws.ToString(p.Value)
+		}
+	}
+	return values, false, nil
+}
+
+// diffParametersHandler compares the hierarchies under ?left= and ?right=
+// by relative name, e.g. to spot drift between staging and prod. Values are
+// compared decrypted but only returned with ?decrypt=true, which needs the
+// decrypt scope. Each side is capped at MAX_RESPONSE_ITEMS parameters; a
+// capped side makes the diff incomplete, flagged with truncated.
+func diffParametersHandler(cl *awsClients, live *liveConfig, decryptEnabled bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		left, right := c.Query("left"), c.Query("right")
+		if left == "" || right == "" {
+			respondError(c, http.StatusBadRequest, "bad_request", "left and right are required")
+			return
+		}
+		showValues := c.Query("decrypt") == "true"
+		if showValues && !allowDecrypt(c, decryptEnabled) {
+			return
+		}
+		max := live.get().MaxResponseItems
+		leftValues, leftTruncated, err := parametersUnder(c.Request.Context(), cl, left, max)
+		if err != nil {
+			respondAWSError(c, err, http.StatusInternalServerError, "internal", "ssm request failed")
+			return
+		}
+		rightValues, rightTruncated, err := parametersUnder(c.Request.Context(), cl, right, max)
+		if err != nil {
+			respondAWSError(c, err, http.StatusInternalServerError, "internal", "ssm request failed")
+			return
+		}
+
+		diff := parameterDiff{
+			Left:      left,
+			Right:     right,
+			OnlyLeft:  []string{},
+			OnlyRight: []string{},
+			Changed:   []changedParameter{},
+		}
+		for name, lv := range leftValues {
+			rv, ok := rightValues[name]
+			switch {
+			case !ok:
+				diff.OnlyLeft = append(diff.OnlyLeft, name)
+			case lv != rv:
+				change := changedParameter{Name: name}
+				if showValues {
+					change.Left, change.Right = lv, rv
+				}
+				diff.Changed = append(diff.Changed, change)
+			}
+		}
+		for name := range rightValues {
+			if _, ok := leftValues[name]; !ok {
+				diff.OnlyRight = append(diff.OnlyRight, name)
+			}
+		}
+		slices.Sort(diff.OnlyLeft)
+		slices.Sort(diff.OnlyRight)
+		slices.SortFunc(diff.Changed, func(a, b changedParameter) int { return strings.Compare(a.Name, b.Name) })
+
+		if leftTruncated || rightTruncated {
+			setListPage(c, listPage{truncated: true})
+		}
+		respond(c, http.StatusOK, diff)
+	}
+}
@@ -0,0 +1,180 @@
+package handlers
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/aws/smithy-go"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	errorVerbosityMinimal = "minimal"
+	errorVerbosityFull    = "full"
+)
+
+type apiError struct {
+	Code    string        `json:"code"`
+	Message string        `json:"message"`
+	Details *errorDetails `json:"details,omitempty"`
+}
+
+// errorDetails exposes the underlying AWS failure; only sent when
+// ERROR_VERBOSITY is full.
+type errorDetails struct {
+	Service   string `json:"service,omitempty"`
+	Operation string `json:"operation,omitempty"`
+	AWSCode   string `json:"awsCode,omitempty"`
+	AWSError  string `json:"awsMessage,omitempty"`
+	RequestID string `json:"awsRequestId,omitempty"`
+}
+
+// errorResponse is the body of every non-2xx JSON reply, so clients can
+// parse failures the same way regardless of which endpoint produced them.
+type errorResponse struct {
+	Version     string   `json:"version"`
+	Environment string   `json:"environment,omitempty"`
+	Error       apiError `json:"error"`
+}
+
+func respondError(c *gin.Context, status int, code, message string) {
+	meta := metaFrom(c)
+	c.AbortWithStatusJSON(status, errorResponse{
+		Version:     meta.version,
+		Environment: meta.environment,
+		Error: apiError{
+			Code:    code,
+			Message: message,
+		},
+	})
+}
+
+// respondAWSError is the single exit for failed AWS calls: it logs the
+// error against the request and, when the error verbosity is full, attaches
+// the AWS error code, message, operation and request ID to the body. A call
+// that hit AWS_CALL_TIMEOUT is always reported as a 504, and one refused by
+// the AWS call limits as a 429.
+func respondAWSError(c *gin.Context, err error, status int, code, message string) {
+	if isCallTimeout(c.Request.Context(), err) {
+		status, code, message = http.StatusGatewayTimeout, "timeout", "aws call timed out"
+	}
+	if errors.Is(err, errAWSCallLimited) {
+		c.Header("Retry-After", "1")
+		status, code, message = http.StatusTooManyRequests, "throttled", "too many concurrent aws calls, retry later"
+	}
+	level := slog.LevelInfo
+	if status >= http.StatusInternalServerError {
+		level = slog.LevelError
+	}
+	loggerFrom(c.Request.Context()).Log(c.Request.Context(), level, "aws request failed",
+		"method", c.Request.Method, "path", c.Request.URL.Path, "status", status, "err", err)
+
+	meta := metaFrom(c)
+	body := errorResponse{
+		Version:     meta.version,
+		Environment: meta.environment,
+		Error: apiError{
+			Code:    code,
+			Message: message,
+		},
+	}
+	if meta.errorVerbosity == errorVerbosityFull {
+		body.Error.Details = awsErrorDetails(err)
+	}
+	c.AbortWithStatusJSON(status, body)
+}
+
+func awsErrorDetails(err error) *errorDetails {
+	var d errorDetails
+	var opErr *smithy.OperationError
+	if errors.As(err, &opErr) {
+		d.Service, d.Operation = opErr.Service(), opErr.Operation()
+	}
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) {
+		d.AWSCode, d.AWSError = apiErr.ErrorCode(), apiErr.ErrorMessage()
+	}
+	var respErr *awshttp.ResponseError
+	if errors.As(err, &respErr) {
+		d.RequestID = respErr.ServiceRequestID()
+	}
+	if d == (errorDetails{}) {
+		d.AWSError = err.Error()
+	}
+	return &d
+}
+
+func noRouteHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		respondError(c, http.StatusNotFound, "not_found", "no route for "+c.Request.URL.Path)
+	}
+}
+
+// noMethodHandler answers 405 with an Allow header listing the methods the
+// router does serve for the path. It reads r's routes per request, so it
+// sees every route registered after it.
+func noMethodHandler(r *gin.Engine) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var allowed []string
+		for _, route := range r.Routes() {
+			if routeMatches(route.Path, c.Request.URL.Path) && !slices.Contains(allowed, route.Method) {
+				allowed = append(allowed, route.Method)
+			}
+		}
+		sort.Strings(allowed)
+		c.Header("Allow", strings.Join(allowed, ", "))
+		respondError(c, http.StatusMethodNotAllowed, "method_not_allowed",
+			c.Request.Method+" is not allowed on "+c.Request.URL.Path)
+	}
+}
+
+// routeMatches reports whether path matches a gin route pattern, where
+// :name matches one segment and *name the rest of the path.
+func routeMatches(pattern, path string) bool {
+	ps, segs := strings.Split(pattern, "/"), strings.Split(path, "/")
+	for i, p := range ps {
+		if strings.HasPrefix(p, "*") {
+			return true
+		}
+		if i >= len(segs) || (!strings.HasPrefix(p, ":") && p != segs[i]) {
+			return false
+		}
+	}
+	return len(ps) == len(segs)
+}
+
+// isThrottled reports whether AWS refused err's call for its request rate,
+// by the error codes the SDK itself retries as throttling, plus SSM's
+// TooManyUpdates, or the AWS call limits refused it.
+func isThrottled(err error) bool {
+	code := apiErrorCode(err)
+	_, ok := retry.DefaultThrottleErrorCodes[code]
+	return ok || code == "TooManyUpdates" || errors.Is(err, errAWSCallLimited)
+}
+
+// respondThrottled answers 429 with a Retry-After hint when err is AWS
+// throttling, and reports whether it did.
+func respondThrottled(c *gin.Context, err error) bool {
+	if !isThrottled(err) {
+		return false
+	}
+	c.Header("Retry-After", "1")
+	respondAWSError(c, err, http.StatusTooManyRequests, "throttled", "aws is throttling requests, retry later")
+	return true
+}
+
+// apiErrorCode returns the AWS error code carried by err, or "" when err is
+// nil or not an AWS API error.
+func apiErrorCode(err error) string {
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.ErrorCode()
+	}
+	return ""
+}
@@ -0,0 +1,131 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/aws/smithy-go"
+	"github.com/gin-gonic/gin"
+)
+
+// respondWith serves respond(c, err) on a router carrying the envelope
+// metadata at verbosity.
+func respondWith(respond func(*gin.Context, error), err error, verbosity string) http.Handler {
+	return handlerRouter(http.MethodGet, "/x", func(c *gin.Context) {
+		c.Set(responseMetaKey, responseMeta{version: "test", environment: "staging", errorVerbosity: verbosity})
+		respond(c, err)
+	})
+}
+
+func TestAWSErrorMapping(t *testing.T) {
+	type mapping struct {
+		err    error
+		status int
+		code   string
+	}
+	common := []mapping{
+		{awsError("ThrottlingException"), http.StatusTooManyRequests, "throttled"},
+		{awsError("TooManyRequestsException"), http.StatusTooManyRequests, "throttled"},
+		{awsError("RequestLimitExceeded"), http.StatusTooManyRequests, "throttled"},
+		{awsError("SlowDown"), http.StatusTooManyRequests, "throttled"},
+		{errAWSCallLimited, http.StatusTooManyRequests, "throttled"},
+		{fmt.Errorf("get: %w", context.DeadlineExceeded), http.StatusGatewayTimeout, "timeout"},
+		{errors.New("connection reset"), http.StatusInternalServerError, "internal"},
+		{awsError("InternalError"), http.StatusInternalServerError, "internal"},
+	}
+	tests := []struct {
+		name     string
+		respond  func(*gin.Context, error)
+		mappings []mapping
+	}{
+		{
+			name:    "s3",
+			respond: respondS3Error,
+			mappings: []mapping{
+				{awsError("NoSuchBucket"), http.StatusNotFound, "not_found"},
+				{awsError("NotFound"), http.StatusNotFound, "not_found"},
+				{awsError("NoSuchKey"), http.StatusNotFound, "not_found"},
+				{awsError("AccessDenied"), http.StatusForbidden, "access_denied"},
+			},
+		},
+		{
+			name:    "parameter read",
+			respond: respondParameterReadError,
+			mappings: []mapping{
+				{awsError("ParameterNotFound"), http.StatusNotFound, "not_found"},
+				{awsError("ParameterVersionNotFound"), http.StatusNotFound, "not_found"},
+				{awsError("ValidationException"), http.StatusBadRequest, "bad_request"},
+				{awsError("AccessDeniedException"), http.StatusForbidden, "access_denied"},
+				{awsError("KMSAccessDeniedException"), http.StatusForbidden, "access_denied"},
+			},
+		},
+		{
+			name:    "parameter write",
+			respond: respondParameterWriteError,
+			mappings: []mapping{
+				{awsError("ParameterNotFound"), http.StatusNotFound, "not_found"},
+				{awsError("ParameterAlreadyExists"), http.StatusConflict, "conflict"},
+				{awsError("ValidationException"), http.StatusBadRequest, "bad_request"},
+				{awsError("HierarchyTypeMismatchException"), http.StatusBadRequest, "bad_request"},
+				{awsError("AccessDeniedException"), http.StatusForbidden, "access_denied"},
+				{awsError("ParameterLimitExceeded"), http.StatusTooManyRequests, "throttled"},
+				{awsError("TooManyUpdates"), http.StatusTooManyRequests, "throttled"},
+			},
+		},
+		{
+			name:    "parameter list",
+			respond: respondParameterListError,
+			mappings: []mapping{
+				{awsError("InvalidNextToken"), http.StatusBadRequest, "bad_request"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		for _, m := range append(tt.mappings, common...) {
+			t.Run(tt.name+"/"+m.err.Error(), func(t *testing.T) {
+				w := serveRequest(t, respondWith(tt.respond, m.err, errorVerbosityMinimal), http.MethodGet, "/x", "")
+				wantError(t, w, m.status, m.code)
+				e := decodeEnvelope(t, w)
+				if e.Version != "test" || e.Error.Message == "" || e.Error.Details != nil {
+					t.Errorf("body = %s, want version test, a message and no details", w.Body.String())
+				}
+				if retry := w.Header().Get("Retry-After"); (retry != "") != (m.status == http.StatusTooManyRequests) {
+					t.Errorf("Retry-After = %q with status %d", retry, m.status)
+				}
+			})
+		}
+	}
+}
+
+func TestAWSErrorVerbosity(t *testing.T) {
+	err := &smithy.OperationError{
+		ServiceID:     "SSM",
+		OperationName: "GetParameter",
+		Err:           &smithy.GenericAPIError{Code: "AccessDeniedException", Message: "not authorized to perform ssm:GetParameter"},
+	}
+	tests := []struct {
+		verbosity string
+		want      *errorDetails
+	}{
+		{verbosity: errorVerbosityMinimal},
+		{verbosity: errorVerbosityFull, want: &errorDetails{
+			Service:   "SSM",
+			Operation: "GetParameter",
+			AWSCode:   "AccessDeniedException",
+			AWSError:  "not authorized to perform ssm:GetParameter",
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.verbosity, func(t *testing.T) {
+			w := serveRequest(t, respondWith(respondParameterReadError, err, tt.verbosity), http.MethodGet, "/x", "")
+			wantError(t, w, http.StatusForbidden, "access_denied")
+			got := decodeEnvelope(t, w).Error.Details
+			if (got == nil) != (tt.want == nil) || (got != nil && *got != *tt.want) {
+				t.Errorf("details = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,221 @@
+package handlers
+
+import (
+	"context"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+)
+
+// callLog counts the operations a fake served.
+type callLog struct {
+	mu    sync.Mutex
+	calls map[string]int
+}
+
+func (l *callLog) record(op string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.calls == nil {
+		l.calls = map[string]int{}
+	}
+	l.calls[op]++
+}
+
+func (l *callLog) count(op string) int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.calls[op]
+}
+
+// fakeS3 stands in for an S3 client. Each method calls the function of the
+// same name; calling one a test left nil panics through the embedded nil
+// interface. HeadBucket, used for the bucket region lookup, succeeds by
+// default so buckets resolve to the configured region.
+type fakeS3 struct {
+	s3API
+	callLog
+
+	listBuckets   func(ctx context.Context, in *s3.ListBucketsInput) (*s3.ListBucketsOutput, error)
+	listObjectsV2 func(ctx context.Context, in *s3.ListObjectsV2Input) (*s3.ListObjectsV2Output, error)
+	headObject    func(ctx context.Context, in *s3.HeadObjectInput) (*s3.HeadObjectOutput, error)
+	getObject     func(ctx context.Context, in *s3.GetObjectInput) (*s3.GetObjectOutput, error)
+	putObject     func(ctx context.Context, in *s3.PutObjectInput) (*s3.PutObjectOutput, error)
+}
+
+func (f *fakeS3) HeadBucket(ctx context.Context, in *s3.HeadBucketInput, _ ...func(*s3.Options)) (*s3.HeadBucketOutput, error) {
+	f.record("HeadBucket")
+	return &s3.HeadBucketOutput{}, nil
+}
+
+func (f *fakeS3) ListBuckets(ctx context.Context, in *s3.ListBucketsInput, _ ...func(*s3.Options)) (*s3.ListBucketsOutput, error) {
+	f.record("ListBuckets")
+	if f.listBuckets == nil {
+		return f.s3API.ListBuckets(ctx, in)
+	}
+	return f.listBuckets(ctx, in)
+}
+
+func (f *fakeS3) ListObjectsV2(ctx context.Context, in *s3.ListObjectsV2Input, _ ...func(*s3.Options)) (*s3.ListObjectsV2Output, error) {
+	f.record("ListObjectsV2")
+	if f.listObjectsV2 == nil {
+		return f.s3API.ListObjectsV2(ctx, in)
+	}
+	return f.listObjectsV2(ctx, in)
+}
+
+func (f *fakeS3) HeadObject(ctx context.Context, in *s3.HeadObjectInput, _ ...func(*s3.Options)) (*s3.HeadObjectOutput, error) {
+	f.record("HeadObject")
+	if f.headObject == nil {
+		return f.s3API.HeadObject(ctx, in)
+	}
+	return f.headObject(ctx, in)
+}
+
+func (f *fakeS3) GetObject(ctx context.Context, in *s3.GetObjectInput, _ ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+	f.record("GetObject")
+	if f.getObject == nil {
+		return f.s3API.GetObject(ctx, in)
+	}
+	return f.getObject(ctx, in)
+}
+
+func (f *fakeS3) PutObject(ctx context.Context, in *s3.PutObjectInput, _ ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+	f.record("PutObject")
+	if f.putObject == nil {
+		return f.s3API.PutObject(ctx, in)
+	}
+	return f.putObject(ctx, in)
+}
+
+// fakeSSM stands in for an SSM client, like fakeS3.
+type fakeSSM struct {
+	ssmAPI
+	callLog
+
+	getParameter        func(ctx context.Context, in *ssm.GetParameterInput) (*ssm.GetParameterOutput, error)
+	getParameters       func(ctx context.Context, in *ssm.GetParametersInput) (*ssm.GetParametersOutput, error)
+	getParameterHistory func(ctx context.Context, in *ssm.GetParameterHistoryInput) (*ssm.GetParameterHistoryOutput, error)
+	getParametersByPath func(ctx context.Context, in *ssm.GetParametersByPathInput) (*ssm.GetParametersByPathOutput, error)
+	describeParameters  func(ctx context.Context, in *ssm.DescribeParametersInput) (*ssm.DescribeParametersOutput, error)
+	putParameter        func(ctx context.Context, in *ssm.PutParameterInput) (*ssm.PutParameterOutput, error)
+	deleteParameter     func(ctx context.Context, in *ssm.DeleteParameterInput) (*ssm.DeleteParameterOutput, error)
+	listTagsForResource func(ctx context.Context, in *ssm.ListTagsForResourceInput) (*ssm.ListTagsForResourceOutput, error)
+}
+
+func (f *fakeSSM) GetParameter(ctx context.Context, in *ssm.GetParameterInput, _ ...func(*ssm.Options)) (*ssm.GetParameterOutput, error) {
+	f.record("GetParameter")
+	if f.getParameter == nil {
+		return f.ssmAPI.GetParameter(ctx, in)
+	}
+	return f.getParameter(ctx, in)
+}
+
+func (f *fakeSSM) GetParameters(ctx context.Context, in *ssm.GetParametersInput, _ ...func(*ssm.Options)) (*ssm.GetParametersOutput, error) {
+	f.record("GetParameters")
+	if f.getParameters == nil {
+		return f.ssmAPI.GetParameters(ctx, in)
+	}
+	return f.getParameters(ctx, in)
+}
+
+func (f *fakeSSM) GetParameterHistory(ctx context.Context, in *ssm.GetParameterHistoryInput, _ ...func(*ssm.Options)) (*ssm.GetParameterHistoryOutput, error) {
+	f.record("GetParameterHistory")
+	if f.getParameterHistory == nil {
+		return f.ssmAPI.GetParameterHistory(ctx, in)
+	}
+	return f.getParameterHistory(ctx, in)
+}
+
+func (f *fakeSSM) GetParametersByPath(ctx context.Context, in *ssm.GetParametersByPathInput, _ ...func(*ssm.Options)) (*ssm.GetParametersByPathOutput, error) {
+	f.record("GetParametersByPath")
+	if f.getParametersByPath == nil {
+		return f.ssmAPI.GetParametersByPath(ctx, in)
+	}
+	return f.getParametersByPath(ctx, in)
+}
+
+func (f *fakeSSM) DescribeParameters(ctx context.Context, in *ssm.DescribeParametersInput, _ ...func(*ssm.Options)) (*ssm.DescribeParametersOutput, error) {
+	f.record("DescribeParameters")
+	if f.describeParameters == nil {
+		return f.ssmAPI.DescribeParameters(ctx, in)
+	}
+	return f.describeParameters(ctx, in)
+}
+
+func (f *fakeSSM) PutParameter(ctx context.Context, in *ssm.PutParameterInput, _ ...func(*ssm.Options)) (*ssm.PutParameterOutput, error) {
+	f.record("PutParameter")
+	if f.putParameter == nil {
+		return f.ssmAPI.PutParameter(ctx, in)
+	}
+	return f.putParameter(ctx, in)
+}
+
+func (f *fakeSSM) DeleteParameter(ctx context.Context, in *ssm.DeleteParameterInput, _ ...func(*ssm.Options)) (*ssm.DeleteParameterOutput, error) {
+	f.record("DeleteParameter")
+	if f.deleteParameter == nil {
+		return f.ssmAPI.DeleteParameter(ctx, in)
+	}
+	return f.deleteParameter(ctx, in)
+}
+
+func (f *fakeSSM) ListTagsForResource(ctx context.Context, in *ssm.ListTagsForResourceInput, _ ...func(*ssm.Options)) (*ssm.ListTagsForResourceOutput, error) {
+	f.record("ListTagsForResource")
+	if f.listTagsForResource == nil {
+		return f.ssmAPI.ListTagsForResource(ctx, in)
+	}
+	return f.listTagsForResource(ctx, in)
+}
+
+// fakeSTS answers GetCallerIdentity with err, or a fixed identity.
+type fakeSTS struct {
+	callLog
+	err error
+}
+
+func (f *fakeSTS) GetCallerIdentity(ctx context.Context, in *sts.GetCallerIdentityInput, _ ...func(*sts.Options)) (*sts.GetCallerIdentityOutput, error) {
+	f.record("GetCallerIdentity")
+	if f.err != nil {
+		return nil, f.err
+	}
+	return &sts.GetCallerIdentityOutput{Account: aws.String(testAccount), Arn: aws.String("arn:aws:iam::" + testAccount + ":role/test")}, nil
+}
+
+const (
+	testRegion  = "us-east-1"
+	testAccount = "123456789012"
+)
+
+// testPresigner signs with a real S3 client on static credentials, which
+// needs no network.
+func testPresigner() s3Presigner {
+	return s3.NewPresignClient(s3.New(s3.Options{
+		Region:      testRegion,
+		Credentials: credentials.NewStaticCredentialsProvider("AKIDTEST", "secret", ""),
+	}))
+}
+
+// testClients wires fakes into an awsClients as newAWSClients would, with
+// every region and bucket served by the same fakes.
+func testClients(s3c s3API, ssmc ssmAPI) *awsClients {
+	fallback := bucketClient{api: s3c, presign: testPresigner()}
+	cl := &awsClients{
+		s3:  s3c,
+		ssm: ssmc,
+		sts: &fakeSTS{},
+		regions: newS3Regions(testRegion, fallback, func(string) bucketClient {
+			return fallback
+		}),
+		ssmIn: newSSMRegions(testRegion, ssmc, func(string) ssmAPI {
+			return ssmc
+		}),
+		region:      testRegion,
+		account:     testAccount,
+		unavailable: map[string]error{},
+	}
+	return cl
+}
@@ -0,0 +1,181 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"sync/atomic"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/gin-gonic/gin"
+)
+
+type credentialStatus struct {
+	Ready     bool      `json:"ready"`
+	CheckedAt time.Time `json:"checkedAt"`
+	LastError string    `json:"lastError,omitempty"`
+}
+
+// credentialWatchdog re-validates the AWS credentials in the background so
+// readiness probes read a cached status instead of calling STS each time.
+type credentialWatchdog struct {
+	sts       stsAPI
+	interval  time.Duration
+	timeout   time.Duration // per STS call
+	threshold int           // consecutive failures before flipping to not-ready
+
+	status   atomic.Pointer[credentialStatus]
+	failures int // only touched by run
+}
+
+// newCredentialWatchdog starts out ready: newAWSClients has just validated
+// the credentials.
+func newCredentialWatchdog(client stsAPI, interval, timeout time.Duration, threshold int) *credentialWatchdog {
+	w := &credentialWatchdog{sts: client, interval: interval, timeout: timeout, threshold: max(threshold, 1)}
+	w.status.Store(&credentialStatus{Ready: true, CheckedAt: time.Now().UTC()})
+	return w
+}
+
+func (w *credentialWatchdog) current() credentialStatus {
+	return *w.status.Load()
+}
+
+// run checks the credentials every interval until ctx is cancelled. A zero
+// interval disables the watchdog.
+func (w *credentialWatchdog) run(ctx context.Context) {
+	if w.interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			w.check(ctx)
+		}
+	}
+}
+
+func (w *credentialWatchdog) check(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, w.timeout)
+	defer cancel()
+
+	prev := w.current()
+	next := credentialStatus{Ready: prev.Ready, CheckedAt: time.Now().UTC()}
+	if _, err := w.sts.GetCallerIdentity(ctx, &sts.GetCallerIdentityInput{}); err != nil {
+		w.failures++
+		next.LastError = err.Error()
+		if w.failures >= w.threshold {
+			next.Ready = false
+		}
+		slog.Warn("credential check failed", "failures", w.failures, "threshold", w.threshold, "err", err)
+	} else {
+		w.failures = 0
+		next.Ready = true
+	}
+	if prev.Ready != next.Ready {
+		slog.Info("credential readiness changed", "ready", next.Ready)
+	}
+	w.status.Store(&next)
+}
+
+// healthChecker aggregates the credential watchdog and the services this
+// deployment depends on into the readiness verdict.
+type healthChecker struct {
+	watchdog *credentialWatchdog
+	clients  *awsClients
+	critical []string
+}
+
+// newHealthChecker treats the listed services as critical, or every service
+// that initialized at startup when the list is empty, so a service that is
+// unavailable by design doesn't mark the instance unready.
+func newHealthChecker(w *credentialWatchdog, cl *awsClients, critical []string) (*healthChecker, error) {
+	if len(critical) == 0 {
+		for _, svc := range cl.services() {
+			if cl.available(svc) {
+				critical = append(critical, svc)
+			}
+		}
+	}
+	for _, svc := range critical {
+		if !slices.Contains(cl.services(), svc) {
+			return nil, fmt.Errorf("HEALTH_CHECK_SERVICES: unknown service %q", svc)
+		}
+	}
+	return &healthChecker{watchdog: w, clients: cl, critical: critical}, nil
+}
+
+type serviceHealth struct {
+	Critical  bool   `json:"critical"`
+	Available bool   `json:"available"`
+	Error     string `json:"error,omitempty"`
+}
+
+type healthReport struct {
+	Ready       bool                     `json:"ready"`
+	Credentials credentialStatus         `json:"credentials"`
+	Services    map[string]serviceHealth `json:"services"`
+}
+
+func (h *healthChecker) report() healthReport {
+	r := healthReport{Credentials: h.watchdog.current(), Services: map[string]serviceHealth{}}
+	r.Ready = r.Credentials.Ready
+	for _, svc := range h.clients.services() {
+		s := serviceHealth{Critical: slices.Contains(h.critical, svc), Available: h.clients.available(svc)}
+		if err := h.clients.unavailable[svc]; err != nil {
+			s.Error = err.Error()
+		}
+		if s.Critical && !s.Available {
+			r.Ready = false
+		}
+		r.Services[svc] = s
+	}
+	return r
+}
+
+// notReadyReason explains a failed readiness verdict.
+func (r healthReport) notReadyReason() string {
+	if !r.Credentials.Ready {
+		return "aws credentials failing: " + r.Credentials.LastError
+	}
+	for svc, s := range r.Services {
+		if s.Critical && !s.Available {
+			return "critical service " + svc + " is unavailable"
+		}
+	}
+	return ""
+}
+
+func readinessHandler(h *healthChecker) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		report := h.report()
+		if !report.Ready {
+			respondError(c, http.StatusServiceUnavailable, "not_ready", report.notReadyReason())
+			return
+		}
+		respond(c, http.StatusOK, report)
+	}
+}
+
+// healthHandler always returns the full report, with 503 when not ready, for
+// operators rather than probes.
+func healthHandler(h *healthChecker) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		report := h.report()
+		status := http.StatusOK
+		if !report.Ready {
+			status = http.StatusServiceUnavailable
+		}
+		respond(c, status, report)
+	}
+}
+
+func livenessHandler(c *gin.Context) {
+	c.Status(http.StatusOK)
+}
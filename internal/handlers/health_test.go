@@ -0,0 +1,125 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+)
+
+// hangingSTS never answers, until the call's context ends.
+type hangingSTS struct{}
+
+func (hangingSTS) GetCallerIdentity(ctx context.Context, _ *sts.GetCallerIdentityInput, _ ...func(*sts.Options)) (*sts.GetCallerIdentityOutput, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func TestReadinessCredentialChecks(t *testing.T) {
+	expired := errors.New("ExpiredToken: the security token included in the request is expired")
+	tests := []struct {
+		name      string
+		sts       stsAPI
+		threshold int
+		checks    int
+		ready     bool
+	}{
+		{name: "healthy", sts: &fakeSTS{}, threshold: 1, checks: 3, ready: true},
+		{name: "failing", sts: &fakeSTS{err: expired}, threshold: 1, checks: 1},
+		{name: "below threshold", sts: &fakeSTS{err: expired}, threshold: 3, checks: 2, ready: true},
+		{name: "at threshold", sts: &fakeSTS{err: expired}, threshold: 3, checks: 3},
+		{name: "hung call", sts: hangingSTS{}, threshold: 1, checks: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cl := testClients(&fakeS3{}, &fakeSSM{})
+			watchdog := newCredentialWatchdog(tt.sts, time.Minute, 10*time.Millisecond, tt.threshold)
+			health, err := newHealthChecker(watchdog, cl, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			r := handlerRouter(http.MethodGet, "/readyz", readinessHandler(health))
+
+			for range tt.checks {
+				watchdog.check(t.Context())
+			}
+			w := serveRequest(t, r, http.MethodGet, "/readyz", "")
+			if !tt.ready {
+				wantError(t, w, http.StatusServiceUnavailable, "not_ready")
+				return
+			}
+			if w.Code != http.StatusOK {
+				t.Errorf("status = %d, want 200; body %s", w.Code, w.Body.String())
+			}
+		})
+	}
+}
+
+// Probes read the status the watchdog cached rather than calling STS, and
+// pick up its next verdict.
+func TestReadinessCaching(t *testing.T) {
+	fake := &fakeSTS{}
+	cl := testClients(&fakeS3{}, &fakeSSM{})
+	watchdog := newCredentialWatchdog(fake, time.Minute, time.Second, 1)
+	health, err := newHealthChecker(watchdog, cl, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := handlerRouter(http.MethodGet, "/readyz", readinessHandler(health))
+
+	for range 5 {
+		if w := serveRequest(t, r, http.MethodGet, "/readyz", ""); w.Code != http.StatusOK {
+			t.Fatalf("status = %d, want 200", w.Code)
+		}
+	}
+	if n := fake.count("GetCallerIdentity"); n != 0 {
+		t.Errorf("GetCallerIdentity calls from probes = %d, want 0", n)
+	}
+
+	fake.err = errors.New("network down")
+	watchdog.check(t.Context())
+	for range 3 {
+		wantError(t, serveRequest(t, r, http.MethodGet, "/readyz", ""), http.StatusServiceUnavailable, "not_ready")
+	}
+	fake.err = nil
+	watchdog.check(t.Context())
+	if w := serveRequest(t, r, http.MethodGet, "/readyz", ""); w.Code != http.StatusOK {
+		t.Errorf("status after recovery = %d, want 200", w.Code)
+	}
+	if n := fake.count("GetCallerIdentity"); n != 2 {
+		t.Errorf("GetCallerIdentity calls = %d, want 2, one per check", n)
+	}
+}
+
+func TestReadinessCriticalServices(t *testing.T) {
+	tests := []struct {
+		name     string
+		critical []string
+		ready    bool
+	}{
+		{name: "default", ready: true}, // only the services that came up count
+		{name: "s3 only", critical: []string{serviceS3}, ready: true},
+		{name: "ssm required", critical: []string{serviceSSM}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cl := testClients(&fakeS3{}, &fakeSSM{})
+			cl.unavailable[serviceSSM] = errors.New("no access")
+			health, err := newHealthChecker(newCredentialWatchdog(&fakeSTS{}, 0, time.Second, 1), cl, tt.critical)
+			if err != nil {
+				t.Fatal(err)
+			}
+			w := serveRequest(t, handlerRouter(http.MethodGet, "/readyz", readinessHandler(health)), http.MethodGet, "/readyz", "")
+			if !tt.ready {
+				wantError(t, w, http.StatusServiceUnavailable, "not_ready")
+				return
+			}
+			if w.Code != http.StatusOK {
+				t.Errorf("status = %d, want 200", w.Code)
+			}
+		})
+	}
+}
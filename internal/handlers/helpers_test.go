@@ -0,0 +1,187 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/smithy-go"
+	"github.com/gin-gonic/gin"
+	"github.com/kelseyhightower/envconfig"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestMain(m *testing.M) {
+	gin.SetMode(gin.TestMode)
+	os.Exit(m.Run())
+}
+
+// testConfig is the configuration a deployment gets from the defaults, with
+// the admin and decrypt keys of the test requests.
+func testConfig(t *testing.T) Config {
+	t.Helper()
+	var cfg Config
+	t.Setenv("VERSION", "test")
+	if err := envconfig.Process("", &cfg); err != nil {
+		t.Fatal(err)
+	}
+	cfg.AdminAPIKey = testAdminKey
+	cfg.APIKeys = apiKeyScopes{testDecryptKey: {scopeDecrypt}}
+	return cfg
+}
+
+const (
+	testAdminKey   = "admin-key"
+	testDecryptKey = "decrypt-key"
+)
+
+// syncBuffer is a bytes.Buffer safe for the concurrent writes of loggers.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+// lines decodes the JSON lines written so far.
+func (b *syncBuffer) lines(t *testing.T) []map[string]any {
+	t.Helper()
+	var out []map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(b.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		var m map[string]any
+		if err := json.Unmarshal([]byte(line), &m); err != nil {
+			t.Fatalf("log line %q: %v", line, err)
+		}
+		out = append(out, m)
+	}
+	return out
+}
+
+// testServer is the full router over fakes, with the service log, the
+// audit trail and the metrics kept for inspection.
+type testServer struct {
+	router  *gin.Engine
+	clients *awsClients
+	metrics *metrics
+	log     *syncBuffer
+	audit   *syncBuffer
+}
+
+func newTestServer(t *testing.T, cfg Config, cl *awsClients) *testServer {
+	t.Helper()
+	live := newLiveConfig(cfg.tunables())
+	watchdog := newCredentialWatchdog(cl.sts, 0, time.Second, 1)
+	health, err := newHealthChecker(watchdog, cl, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &testServer{clients: cl, metrics: newMetrics(prometheus.NewRegistry()), log: &syncBuffer{}, audit: &syncBuffer{}}
+	audit := &auditLogger{logger: slog.New(slog.NewJSONHandler(s.audit, nil))}
+	s.router = buildRouter(cfg, slog.New(slog.NewJSONHandler(s.log, nil)), cl, live, health, nil,
+		newCanaryVersion("", 0), audit, s.metrics)
+	return s
+}
+
+func (s *testServer) do(t *testing.T, method, target, body string, header ...string) *httptest.ResponseRecorder {
+	t.Helper()
+	return serveRequest(t, s.router, method, target, body, header...)
+}
+
+// serveRequest sends one request through h; header holds name, value pairs.
+func serveRequest(t *testing.T, h http.Handler, method, target, body string, header ...string) *httptest.ResponseRecorder {
+	t.Helper()
+	var r io.Reader
+	if body != "" {
+		r = strings.NewReader(body)
+	}
+	req := httptest.NewRequest(method, target, r)
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	for i := 0; i+1 < len(header); i += 2 {
+		req.Header.Set(header[i], header[i+1])
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	return w
+}
+
+// handlerRouter serves h alone at route, behind the request ID and caller
+// identity middleware it relies on.
+func handlerRouter(method, route string, h gin.HandlerFunc) *gin.Engine {
+	r := gin.New()
+	r.Use(requestIDMiddleware(slog.New(slog.DiscardHandler)), identifyCaller(testAdminKey, apiKeyScopes{testDecryptKey: {scopeDecrypt}}))
+	r.Handle(method, route, h)
+	return r
+}
+
+// envelope is a decoded success or error body.
+type envelope struct {
+	Version   string              `json:"version"`
+	Region    string              `json:"region"`
+	Data      json.RawMessage     `json:"data"`
+	Truncated bool                `json:"truncated"`
+	NextToken string              `json:"nextToken"`
+	Filters   map[string][]string `json:"filters"`
+	Error     *apiError           `json:"error"`
+}
+
+func decodeEnvelope(t *testing.T, w *httptest.ResponseRecorder) envelope {
+	t.Helper()
+	var e envelope
+	if err := json.Unmarshal(w.Body.Bytes(), &e); err != nil {
+		t.Fatalf("decode %q: %v", w.Body.String(), err)
+	}
+	return e
+}
+
+// decodeData decodes the envelope's data into v, failing on an error body.
+func decodeData(t *testing.T, w *httptest.ResponseRecorder, v any) envelope {
+	t.Helper()
+	e := decodeEnvelope(t, w)
+	if e.Error != nil {
+		t.Fatalf("status %d, error %+v", w.Code, *e.Error)
+	}
+	if err := json.Unmarshal(e.Data, v); err != nil {
+		t.Fatalf("decode data %s: %v", e.Data, err)
+	}
+	return e
+}
+
+// wantError checks w is an error response with status and code.
+func wantError(t *testing.T, w *httptest.ResponseRecorder, status int, code string) {
+	t.Helper()
+	if w.Code != status {
+		t.Fatalf("status = %d, want %d; body %s", w.Code, status, w.Body.String())
+	}
+	e := decodeEnvelope(t, w)
+	if e.Error == nil || e.Error.Code != code {
+		t.Fatalf("error = %+v, want code %q", e.Error, code)
+	}
+}
+
+// awsError is an AWS API error with code, as the SDK returns them.
+func awsError(code string) error {
+	return &smithy.GenericAPIError{Code: code, Message: code + " (fake)"}
+}
@@ -0,0 +1,111 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	iamtypes "github.com/aws/aws-sdk-go-v2/service/iam/types"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/gin-gonic/gin"
+)
+
+type matchedStatement struct {
+	SourcePolicyID   string `json:"sourcePolicyId,omitempty"`
+	SourcePolicyType string `json:"sourcePolicyType,omitempty"`
+}
+
+type policySimulation struct {
+	Principal         string             `json:"principal"`
+	Action            string             `json:"action"`
+	Resource          string             `json:"resource"`
+	Decision          string             `json:"decision"`
+	Allowed           bool               `json:"allowed"`
+	MatchedStatements []matchedStatement `json:"matchedStatements"`
+	MissingContext    []string           `json:"missingContextValues,omitempty"`
+}
+
+// principalARN turns the caller identity into an ARN SimulatePrincipalPolicy
+// accepts: an assumed-role session ARN is mapped back to its role. Role paths
+// are not part of the session ARN, so roles with a non-root path won't
+// resolve.
+func principalARN(callerARN string) (string, error) {
+	parts := strings.SplitN(callerARN, ":", 6)
+	if len(parts) != 6 {
+		return "", fmt.Errorf("unexpected caller ARN %q", callerARN)
+	}
+	if parts[2] != "sts" {
+		return callerARN, nil
+	}
+	resource := strings.Split(parts[5], "/")
+	if len(resource) < 2 || resource[0] != "assumed-role" {
+		return "", fmt.Errorf("cannot simulate policies for %q", callerARN)
+	}
+	return fmt.Sprintf("%s:%s:iam::%s:role/%s", parts[0], parts[1], parts[4], resource[1]), nil
+}
+
+// iamCanHandler reports whether this service's own identity may perform
+// ?action= on ?resource= (default "*"), using IAM policy simulation, to help
+// diagnose AccessDenied errors.
+func iamCanHandler(cl *awsClients) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		action := c.Query("action")
+		if action == "" {
+			respondError(c, http.StatusBadRequest, "bad_request", "action is required")
+			return
+		}
+		resource := c.DefaultQuery("resource", "*")
+
+		identity, err := cl.sts.GetCallerIdentity(c.Request.Context(), &sts.GetCallerIdentityInput{})
+		if err != nil {
+			respondAWSError(c, err, http.StatusInternalServerError, "internal", "sts request failed")
+			return
+		}
+		principal, err := principalARN(aws.ToString(identity.Arn))
+		if err != nil {
+			respondError(c, http.StatusUnprocessableEntity, "unprocessable", err.Error())
+			return
+		}
+
+		out, err := cl.iam.SimulatePrincipalPolicy(c.Request.Context(), &iam.SimulatePrincipalPolicyInput{
+			PolicySourceArn: aws.String(principal),
+			ActionNames:     []string{action},
+			ResourceArns:    []string{resource},
+		})
+		if err != nil {
+			switch apiErrorCode(err) {
+			case "InvalidInput":
+				respondAWSError(c, err, http.StatusBadRequest, "bad_request", "invalid action or resource")
+			case "NoSuchEntity":
+				respondAWSError(c, err, http.StatusNotFound, "not_found", "principal not found")
+			case "AccessDenied":
+				respondAWSError(c, err, http.StatusForbidden, "access_denied", "policy simulation denied")
+			default:
+				respondAWSError(c, err, http.StatusInternalServerError, "internal", "iam request failed")
+			}
+			return
+		}
+
+		sim := policySimulation{
+			Principal:         principal,
+			Action:            action,
+			Resource:          resource,
+			MatchedStatements: []matchedStatement{},
+		}
+		if len(out.EvaluationResults) > 0 {
+			r := out.EvaluationResults[0]
+			sim.Decision = string(r.EvalDecision)
+			sim.Allowed = r.EvalDecision == iamtypes.PolicyEvaluationDecisionTypeAllowed
+			for _, s := range r.MatchedStatements {
+				sim.MatchedStatements = append(sim.MatchedStatements, matchedStatement{
+					SourcePolicyID:   aws.ToString(s.SourcePolicyId),
+					SourcePolicyType: string(s.SourcePolicyType),
+				})
+			}
+			sim.MissingContext = r.MissingContextValues
+		}
+		respond(c, http.StatusOK, sim)
+	}
+}
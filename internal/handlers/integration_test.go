@@ -0,0 +1,214 @@
+//go:build integration
+
+package handlers
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	ssmtypes "github.com/aws/aws-sdk-go-v2/service/ssm/types"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/testcontainers/testcontainers-go"
+	"github.com/testcontainers/testcontainers-go/wait"
+)
+
+// The integration suite runs the service against LocalStack, catching SDK
+// wiring that the fakes can't. It needs Docker and skips without it:
+//
+//	go test -tags integration ./internal/handlers -run Integration
+
+const localStackImage = "localstack/localstack:4"
+
+// startLocalStack runs LocalStack and points the AWS SDK at it through
+// AWS_ENDPOINT_URL, as an operator would.
+func startLocalStack(t *testing.T) {
+	t.Helper()
+	testcontainers.SkipIfProviderIsNotHealthy(t)
+	ctr, err := testcontainers.Run(t.Context(), localStackImage,
+		testcontainers.WithExposedPorts("4566/tcp"),
+		testcontainers.WithEnv(map[string]string{"SERVICES": "s3,ssm,sts"}),
+		testcontainers.WithWaitStrategy(wait.ForHTTP("/_localstack/health").WithPort("4566/tcp")),
+	)
+	testcontainers.CleanupContainer(t, ctr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	host, err := ctr.Host(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if host == "localhost" {
+		// an IP endpoint makes S3 use path-style addressing, which
+		// LocalStack serves without wildcard DNS
+		host = "127.0.0.1"
+	}
+	port, err := ctr.MappedPort(t.Context(), "4566/tcp")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("AWS_ENDPOINT_URL", "http://"+net.JoinHostPort(host, port.Port()))
+	t.Setenv("AWS_REGION", testRegion)
+	t.Setenv("AWS_ACCESS_KEY_ID", "test")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "test")
+	t.Setenv("AWS_SESSION_TOKEN", "")
+	t.Setenv("AWS_EC2_METADATA_DISABLED", "true")
+}
+
+// seedLocalStack creates a bucket holding one object and a parameter.
+func seedLocalStack(t *testing.T) {
+	t.Helper()
+	ctx := t.Context()
+	cfg, err := config.LoadDefaultConfig(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s3c := s3.NewFromConfig(cfg)
+	if _, err := s3c.CreateBucket(ctx, &s3.CreateBucketInput{Bucket: aws.String("reports")}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s3c.PutObject(ctx, &s3.PutObjectInput{
+		Bucket: aws.String("reports"),
+		Key:    aws.String("2024/q1 sales.csv"),
+		Body:   strings.NewReader("region,total\neu,42\n"),
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ssm.NewFromConfig(cfg).PutParameter(ctx, &ssm.PutParameterInput{
+		Name:  aws.String("/app/db/host"),
+		Value: aws.String("db.internal"),
+		Type:  ssmtypes.ParameterTypeString,
+	}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// liveGet fetches target from srv, failing unless it answers 200.
+func liveGet(t *testing.T, srv *httptest.Server, target string) []byte {
+	t.Helper()
+	return liveCall(t, srv, http.MethodGet, target, "", http.StatusOK)
+}
+
+// liveCall sends an admin request to srv over HTTP, failing unless it
+// answers status, and returns the body.
+func liveCall(t *testing.T, srv *httptest.Server, method, target, body string, status int) []byte {
+	t.Helper()
+	req, err := http.NewRequestWithContext(t.Context(), method, srv.URL+target, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(apiKeyHeader, testAdminKey)
+	resp, err := srv.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != status {
+		t.Fatalf("%s %s: status = %d, want %d: %s", method, target, resp.StatusCode, status, b)
+	}
+	return b
+}
+
+// decodeBody decodes the data of an envelope read off the wire.
+func decodeBody(t *testing.T, b []byte, v any) {
+	t.Helper()
+	w := httptest.NewRecorder()
+	w.Body.Write(b)
+	decodeData(t, w, v)
+}
+
+func TestIntegrationLocalStack(t *testing.T) {
+	startLocalStack(t)
+	seedLocalStack(t)
+
+	cfg := testConfig(t)
+	cfg.EnableWrites = true
+	cl, err := newAWSClients(t.Context(), cfg, newMetrics(prometheus.NewRegistry()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cl.unavailable) != 0 {
+		t.Fatalf("services unavailable against LocalStack: %v", cl.unavailable)
+	}
+	srv := httptest.NewServer(newTestServer(t, cfg, cl).router)
+	t.Cleanup(srv.Close)
+
+	t.Run("buckets", func(t *testing.T) {
+		b := liveGet(t, srv, "/buckets")
+		var names []string
+		decodeBody(t, b, &names)
+		if !slices.Contains(names, "reports") {
+			t.Errorf("buckets = %q, want reports", names)
+		}
+	})
+
+	t.Run("objects", func(t *testing.T) {
+		b := liveGet(t, srv, "/buckets/reports/objects?prefix=2024/")
+		var listing objectListing
+		decodeBody(t, b, &listing)
+		if len(listing.Objects) != 1 || listing.Objects[0].Key != "2024/q1 sales.csv" {
+			t.Errorf("objects = %+v, want 2024/q1 sales.csv", listing.Objects)
+		}
+
+		body := liveGet(t, srv, "/buckets/reports/objects/2024/q1%20sales.csv")
+		if string(body) != "region,total\neu,42\n" {
+			t.Errorf("object body = %q", body)
+		}
+	})
+
+	t.Run("upload", func(t *testing.T) {
+		liveCall(t, srv, http.MethodPut, "/buckets/reports/objects/notes/upload.txt", "uploaded", http.StatusCreated)
+		if body := liveGet(t, srv, "/buckets/reports/objects/notes/upload.txt"); string(body) != "uploaded" {
+			t.Errorf("uploaded body = %q", body)
+		}
+	})
+
+	t.Run("presign", func(t *testing.T) {
+		b := liveGet(t, srv, "/buckets/reports/objects/2024/q1%20sales.csv/presign?expires=60")
+		var presigned presignedRequest
+		decodeBody(t, b, &presigned)
+		resp, err := http.Get(presigned.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		if resp.StatusCode != http.StatusOK || string(body) != "region,total\neu,42\n" {
+			t.Errorf("presigned GET = %d %q", resp.StatusCode, body)
+		}
+	})
+
+	t.Run("parameters", func(t *testing.T) {
+		b := liveGet(t, srv, "/parameters/app/db/host")
+		var value string
+		decodeBody(t, b, &value)
+		if value != "db.internal" {
+			t.Errorf("value = %q, want db.internal", value)
+		}
+
+		liveCall(t, srv, http.MethodPut, "/parameters/app/db/port", `{"value":"5432"}`, http.StatusOK)
+		liveCall(t, srv, http.MethodPut, "/parameters/app/db/port", `{"value":"5433"}`, http.StatusConflict)
+		b = liveGet(t, srv, "/parameters?prefix=/app/db/")
+		var names []string
+		decodeBody(t, b, &names)
+		slices.Sort(names)
+		if !slices.Equal(names, []string{"/app/db/host", "/app/db/port"}) {
+			t.Errorf("names = %q, want /app/db/host and /app/db/port", names)
+		}
+		liveCall(t, srv, http.MethodGet, "/parameters/app/db/missing", "", http.StatusNotFound)
+	})
+}
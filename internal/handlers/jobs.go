@@ -0,0 +1,229 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/gin-gonic/gin"
+)
+
+const jobTypeBucketSize = "bucket-size"
+
+// job is the SQS message body of an operation deferred to the worker.
+type job struct {
+	ID     string `json:"id"`
+	Type   string `json:"type"`
+	Bucket string `json:"bucket"`
+	Prefix string `json:"prefix,omitempty"`
+}
+
+type jobResult struct {
+	ID          string    `json:"id"`
+	Type        string    `json:"type"`
+	Status      string    `json:"status"` // "done" or "failed"
+	Result      any       `json:"result,omitempty"`
+	Error       string    `json:"error,omitempty"`
+	CompletedAt time.Time `json:"completedAt"`
+}
+
+type jobAccepted struct {
+	ID     string `json:"id"`
+	Status string `json:"status"`
+}
+
+type bucketSize struct {
+	Bucket  string `json:"bucket"`
+	Prefix  string `json:"prefix,omitempty"`
+	Objects int64  `json:"objects"`
+	Bytes   int64  `json:"bytes"`
+}
+
+func computeBucketSize(ctx context.Context, client s3API, bucket, prefix string) (bucketSize, error) {
+	size := bucketSize{Bucket: bucket, Prefix: prefix}
+	input := &s3.ListObjectsV2Input{Bucket: aws.String(bucket)}
+	if prefix != "" {
+		input.Prefix = aws.String(prefix)
+	}
+	paginator := s3.NewListObjectsV2Paginator(client, input)
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return size, err
+		}
+		for _, o := range page.Contents {
+			size.Objects++
+			size.Bytes += aws.ToInt64(o.Size)
+		}
+	}
+	return size, nil
+}
+
+// jobQueue hands expensive operations to a background worker through SQS;
+// the worker writes each result as JSON into the results bucket.
+type jobQueue struct {
+	sqs           sqsAPI
+	s3            s3API // results bucket
+	regions       *s3Regions
+	queueURL      string
+	resultsBucket string
+	resultsPrefix string
+}
+
+func (q *jobQueue) resultKey(id string) string {
+	return q.resultsPrefix + id + ".json"
+}
+
+func (q *jobQueue) enqueue(ctx context.Context, j job) error {
+	body, err := json.Marshal(j)
+	if err != nil {
+		return err
+	}
+	_, err = q.sqs.SendMessage(ctx, &sqs.SendMessageInput{
+		QueueUrl:    aws.String(q.queueURL),
+		MessageBody: aws.String(string(body)),
+	})
+	return err
+}
+
+// run consumes the queue until ctx is cancelled. Messages are only deleted
+// once their result is stored, so a failed write is retried on redelivery.
+func (q *jobQueue) run(ctx context.Context) {
+	for ctx.Err() == nil {
+		out, err := q.sqs.ReceiveMessage(ctx, &sqs.ReceiveMessageInput{
+			QueueUrl:            aws.String(q.queueURL),
+			MaxNumberOfMessages: 1,
+			WaitTimeSeconds:     20,
+		})
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			slog.Error("job queue receive failed", "err", err)
+			select {
+			case <-ctx.Done():
+			case <-time.After(5 * time.Second):
+			}
+			continue
+		}
+		for _, msg := range out.Messages {
+			var j job
+			if err := json.Unmarshal([]byte(aws.ToString(msg.Body)), &j); err != nil || j.ID == "" {
+				slog.Warn("job queue: dropping malformed message", "messageId", aws.ToString(msg.MessageId))
+				q.delete(ctx, msg.ReceiptHandle)
+				continue
+			}
+			if err := q.store(ctx, q.process(ctx, j)); err != nil {
+				slog.Error("job result store failed", "job", j.ID, "err", err)
+				continue
+			}
+			q.delete(ctx, msg.ReceiptHandle)
+		}
+	}
+}
+
+func (q *jobQueue) process(ctx context.Context, j job) jobResult {
+	res := jobResult{ID: j.ID, Type: j.Type, Status: "done"}
+	var err error
+	switch j.Type {
+	case jobTypeBucketSize:
+		res.Result, err = computeBucketSize(ctx, q.regions.client(ctx, j.Bucket).api, j.Bucket, j.Prefix)
+	default:
+		err = fmt.Errorf("unknown job type %q", j.Type)
+	}
+	if err != nil {
+		res.Status = "failed"
+		res.Error = err.Error()
+		res.Result = nil
+	}
+	res.CompletedAt = time.Now().UTC()
+	return res
+}
+
+func (q *jobQueue) store(ctx context.Context, res jobResult) error {
+	body, err := json.Marshal(res)
+	if err != nil {
+		return err
+	}
+	_, err = q.s3.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:      aws.String(q.resultsBucket),
+		Key:         aws.String(q.resultKey(res.ID)),
+		Body:        bytes.NewReader(body),
+		ContentType: aws.String("application/json"),
+	})
+	return err
+}
+
+func (q *jobQueue) delete(ctx context.Context, receipt *string) {
+	if _, err := q.sqs.DeleteMessage(ctx, &sqs.DeleteMessageInput{
+		QueueUrl:      aws.String(q.queueURL),
+		ReceiptHandle: receipt,
+	}); err != nil {
+		slog.Error("job queue delete failed", "err", err)
+	}
+}
+
+// bucketSizeHandler totals the objects under an optional prefix. With async
+// enabled the listing is deferred to the worker and the client gets a job ID
+// to poll at /jobs/:id.
+func bucketSizeHandler(cl *awsClients, queue *jobQueue) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		bucket, prefix := c.Param("bucket"), c.Query("prefix")
+		if queue == nil {
+			size, err := computeBucketSize(c.Request.Context(), cl.bucketS3(c.Request.Context(), bucket), bucket, prefix)
+			if err != nil {
+				respondS3Error(c, err)
+				return
+			}
+			respond(c, http.StatusOK, size)
+			return
+		}
+
+		j := job{ID: newRequestID(), Type: jobTypeBucketSize, Bucket: bucket, Prefix: prefix}
+		if err := queue.enqueue(c.Request.Context(), j); err != nil {
+			respondAWSError(c, err, http.StatusInternalServerError, "internal", "failed to enqueue job")
+			return
+		}
+		c.Header("Location", "/jobs/"+j.ID)
+		respond(c, http.StatusAccepted, jobAccepted{ID: j.ID, Status: "queued"})
+	}
+}
+
+func jobResultHandler(queue *jobQueue) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.Param("id")
+		if _, err := hex.DecodeString(id); err != nil || len(id) != 32 {
+			respondError(c, http.StatusBadRequest, "bad_request", "malformed job id")
+			return
+		}
+		out, err := queue.s3.GetObject(c.Request.Context(), &s3.GetObjectInput{
+			Bucket: aws.String(queue.resultsBucket),
+			Key:    aws.String(queue.resultKey(id)),
+		})
+		if apiErrorCode(err) == "NoSuchKey" {
+			respondError(c, http.StatusNotFound, "not_found", "no result for job yet")
+			return
+		}
+		if err != nil {
+			respondS3Error(c, err)
+			return
+		}
+		defer func() { _ = out.Body.Close() }()
+
+		var res jobResult
+		if err := json.NewDecoder(out.Body).Decode(&res); err != nil {
+			loggerFrom(c.Request.Context()).Error("decode job result failed", "job", id, "err", err)
+			respondError(c, http.StatusInternalServerError, "internal", "corrupt job result")
+			return
+		}
+		respond(c, http.StatusOK, res)
+	}
+}
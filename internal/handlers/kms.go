@@ -0,0 +1,115 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// maxKMSPlaintext is the largest plaintext KMS Encrypt accepts.
+	maxKMSPlaintext = 4096
+	maxKMSBody      = 16 << 10
+)
+
+// Binary fields travel base64-encoded, which encoding/json does for []byte.
+type kmsEncryptRequest struct {
+	KeyID     string `json:"keyId" binding:"required"`
+	Plaintext []byte `json:"plaintext" binding:"required"`
+}
+
+type kmsEncryptResult struct {
+	KeyID      string `json:"keyId"`
+	Ciphertext []byte `json:"ciphertext"`
+}
+
+type kmsDecryptRequest struct {
+	Ciphertext []byte `json:"ciphertext" binding:"required"`
+}
+
+type kmsDecryptResult struct {
+	KeyID     string `json:"keyId"`
+	Plaintext []byte `json:"plaintext"`
+}
+
+// respondKMSError maps KMS failures; AWS errors never carry the payload.
+func respondKMSError(c *gin.Context, err error) {
+	switch apiErrorCode(err) {
+	case "InvalidCiphertextException", "IncorrectKeyException", "InvalidKeyUsageException":
+		respondAWSError(c, err, http.StatusBadRequest, "bad_request", "ciphertext or key usage is invalid")
+	case "AccessDeniedException":
+		respondAWSError(c, err, http.StatusForbidden, "access_denied", "access to key denied")
+	case "NotFoundException":
+		respondAWSError(c, err, http.StatusNotFound, "not_found", "key not found")
+	case "DisabledException", "KMSInvalidStateException":
+		respondAWSError(c, err, http.StatusConflict, "conflict", "key is not usable in its current state")
+	default:
+		respondAWSError(c, err, http.StatusInternalServerError, "internal", "kms request failed")
+	}
+}
+
+func bindKMSRequest(c *gin.Context, req any) bool {
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxKMSBody)
+	if err := c.ShouldBindJSON(req); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			respondError(c, http.StatusRequestEntityTooLarge, "too_large", "request body too large")
+			return false
+		}
+		respondError(c, http.StatusBadRequest, "bad_request", "invalid request body")
+		return false
+	}
+	return true
+}
+
+func kmsEncryptHandler(cl *awsClients) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req kmsEncryptRequest
+		if !bindKMSRequest(c, &req) {
+			return
+		}
+		if len(req.Plaintext) > maxKMSPlaintext {
+			respondError(c, http.StatusRequestEntityTooLarge, "too_large",
+				fmt.Sprintf("plaintext exceeds the %d byte KMS limit", maxKMSPlaintext))
+			return
+		}
+
+		out, err := cl.kms.Encrypt(c.Request.Context(), &kms.EncryptInput{
+			KeyId:     aws.String(req.KeyID),
+			Plaintext: req.Plaintext,
+		})
+		if err != nil {
+			respondKMSError(c, err)
+			return
+		}
+		respond(c, http.StatusOK, kmsEncryptResult{
+			KeyID:      aws.ToString(out.KeyId),
+			Ciphertext: out.CiphertextBlob,
+		})
+	}
+}
+
+func kmsDecryptHandler(cl *awsClients) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req kmsDecryptRequest
+		if !bindKMSRequest(c, &req) {
+			return
+		}
+
+		out, err := cl.kms.Decrypt(c.Request.Context(), &kms.DecryptInput{
+			CiphertextBlob: req.Ciphertext,
+		})
+		if err != nil {
+			respondKMSError(c, err)
+			return
+		}
+		respond(c, http.StatusOK, kmsDecryptResult{
+			KeyID:     aws.ToString(out.KeyId),
+			Plaintext: out.Plaintext,
+		})
+	}
+}
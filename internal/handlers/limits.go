@@ -0,0 +1,202 @@
+package handlers
+
+import (
+	"math"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// overloadHeader tells a client why it was turned away, so it can tell
+// backpressure apart from a failure.
+const overloadHeader = "X-Overload"
+
+// concurrencyLimit caps the in-flight requests of one endpoint class. By
+// default a saturated class answers 503 at once; with a queue, requests wait
+// for a slot instead, served round-robin across client IPs so one client
+// cannot monopolize the class, and in arrival order per client.
+type concurrencyLimit struct {
+	class string
+	max   int // <= 0 when unlimited
+
+	queueDepth   int
+	queueTimeout time.Duration
+	// shedAt is the load, in-flight plus queued requests, from which new
+	// requests are refused outright; 0 disables shedding.
+	shedAt int
+
+	// inFlightGauge and queuedGauge track inFlight and queued; rejected
+	// counts turned-away requests by reason.
+	inFlightGauge prometheus.Gauge
+	queuedGauge   prometheus.Gauge
+	rejected      *prometheus.CounterVec
+
+	mu       sync.Mutex
+	inFlight int
+	queued   int
+	waiting  map[string][]*slotWaiter // by client IP
+	turns    []string                 // client IPs with waiters, next first
+}
+
+type slotWaiter struct {
+	client  string
+	ready   chan struct{}
+	granted bool
+}
+
+// newConcurrencyLimit allows max concurrent requests of class, exporting its
+// load to m; max <= 0 disables the limit.
+func newConcurrencyLimit(class string, max int, m *metrics) *concurrencyLimit {
+	return &concurrencyLimit{
+		class:         class,
+		max:           max,
+		inFlightGauge: m.limitInFlight.WithLabelValues(class),
+		queuedGauge:   m.limitQueued.WithLabelValues(class),
+		rejected:      m.limitRejected.MustCurryWith(prometheus.Labels{"class": class}),
+		waiting:       map[string][]*slotWaiter{},
+	}
+}
+
+// withQueue lets up to depth requests wait up to timeout for a slot. A full
+// queue answers 429 and a wait that times out 503.
+func (l *concurrencyLimit) withQueue(depth int, timeout time.Duration) *concurrencyLimit {
+	l.queueDepth, l.queueTimeout = depth, timeout
+	return l
+}
+
+// withShedding refuses new requests with a 503 once in-flight plus queued
+// requests reach threshold times the concurrency cap, e.g. 1.5 sheds once
+// the queue holds half as many requests as may run. threshold <= 0
+// disables it.
+func (l *concurrencyLimit) withShedding(threshold float64) *concurrencyLimit {
+	if threshold > 0 {
+		l.shedAt = max(1, int(math.Ceil(threshold*float64(l.max))))
+	}
+	return l
+}
+
+// overloaded answers a request the class can't take, with reason in
+// X-Overload.
+func (l *concurrencyLimit) overloaded(c *gin.Context, status int, reason, message string) {
+	l.rejected.WithLabelValues(reason).Inc()
+	c.Header("Retry-After", "1")
+	c.Header(overloadHeader, reason)
+	respondError(c, status, "overloaded", message)
+}
+
+// wrap holds a slot while h runs. Unlike middleware it also works inside
+// the per-action chains of a catch-all route.
+func (l *concurrencyLimit) wrap(h gin.HandlerFunc) gin.HandlerFunc {
+	if l.max <= 0 {
+		return h
+	}
+	return func(c *gin.Context) {
+		if !l.acquire(c) {
+			return
+		}
+		defer l.release()
+		h(c)
+	}
+}
+
+// middleware holds a slot for the rest of the handler chain.
+func (l *concurrencyLimit) middleware() gin.HandlerFunc {
+	return l.wrap(func(c *gin.Context) { c.Next() })
+}
+
+// acquire takes a slot, queueing for one if allowed, and responds itself
+// when it can't get one.
+func (l *concurrencyLimit) acquire(c *gin.Context) bool {
+	l.mu.Lock()
+	if l.shedAt > 0 && l.inFlight+l.queued >= l.shedAt {
+		l.mu.Unlock()
+		l.overloaded(c, http.StatusServiceUnavailable, "load_threshold", l.class+" requests are being shed under load")
+		return false
+	}
+	if l.inFlight < l.max && l.queued == 0 {
+		l.inFlight++
+		l.inFlightGauge.Inc()
+		l.mu.Unlock()
+		return true
+	}
+	if l.queued >= l.queueDepth {
+		l.mu.Unlock()
+		if l.queueDepth == 0 {
+			l.overloaded(c, http.StatusServiceUnavailable, "at_capacity", "too many concurrent "+l.class+" requests")
+		} else {
+			l.overloaded(c, http.StatusTooManyRequests, "queue_full", "the "+l.class+" request queue is full")
+		}
+		return false
+	}
+	w := &slotWaiter{client: c.ClientIP(), ready: make(chan struct{})}
+	if len(l.waiting[w.client]) == 0 {
+		l.turns = append(l.turns, w.client)
+	}
+	l.waiting[w.client] = append(l.waiting[w.client], w)
+	l.queued++
+	l.queuedGauge.Inc()
+	l.mu.Unlock()
+
+	timer := time.NewTimer(l.queueTimeout)
+	defer timer.Stop()
+	select {
+	case <-w.ready:
+		return true
+	case <-timer.C:
+	case <-c.Request.Context().Done():
+	}
+
+	l.mu.Lock()
+	if w.granted {
+		// the slot was handed over just as the wait ended; use it
+		l.mu.Unlock()
+		return true
+	}
+	l.dropWaiter(w)
+	l.mu.Unlock()
+	l.overloaded(c, http.StatusServiceUnavailable, "queue_timeout", "timed out waiting for a "+l.class+" request slot")
+	return false
+}
+
+// release hands the slot to the next waiter, taking clients in turn, or
+// frees it when nobody is waiting.
+func (l *concurrencyLimit) release() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(l.turns) == 0 {
+		l.inFlight--
+		l.inFlightGauge.Dec()
+		return
+	}
+	client := l.turns[0]
+	l.turns = l.turns[1:]
+	queue := l.waiting[client]
+	next := queue[0]
+	if len(queue) > 1 {
+		l.waiting[client] = queue[1:]
+		l.turns = append(l.turns, client)
+	} else {
+		delete(l.waiting, client)
+	}
+	l.queued--
+	l.queuedGauge.Dec()
+	next.granted = true
+	close(next.ready)
+}
+
+// dropWaiter removes a waiter that gave up. l.mu must be held.
+func (l *concurrencyLimit) dropWaiter(w *slotWaiter) {
+	queue := slices.DeleteFunc(l.waiting[w.client], func(o *slotWaiter) bool { return o == w })
+	if len(queue) > 0 {
+		l.waiting[w.client] = queue
+	} else {
+		delete(l.waiting, w.client)
+		l.turns = slices.DeleteFunc(l.turns, func(ip string) bool { return ip == w.client })
+	}
+	l.queued--
+	l.queuedGauge.Dec()
+}
@@ -0,0 +1,103 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// blockingLimit serves l.wrap over a handler that holds its slot until
+// release is closed.
+func blockingLimit(l *concurrencyLimit) (h http.Handler, release chan struct{}) {
+	release = make(chan struct{})
+	return handlerRouter(http.MethodGet, "/x", l.wrap(func(c *gin.Context) {
+		<-release
+		c.Status(http.StatusNoContent)
+	})), release
+}
+
+// startRequest sends a request in the background; its recorder is on the
+// channel once it completes.
+func startRequest(t *testing.T, h http.Handler) <-chan *httptest.ResponseRecorder {
+	done := make(chan *httptest.ResponseRecorder, 1)
+	go func() { done <- serveRequest(t, h, http.MethodGet, "/x", "") }()
+	return done
+}
+
+// eventually waits for cond, failing after a second.
+func eventually(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	for deadline := time.Now().Add(time.Second); !cond(); time.Sleep(time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+	}
+}
+
+func TestConcurrencyLimitMetrics(t *testing.T) {
+	tests := []struct {
+		name         string
+		queueDepth   int
+		queueTimeout time.Duration
+		shed         float64
+		queued       int // requests left waiting behind the first
+		status       int
+		reason       string
+	}{
+		{name: "at capacity", status: http.StatusServiceUnavailable, reason: "at_capacity"},
+		{
+			name:       "queue full",
+			queueDepth: 1, queueTimeout: time.Minute, queued: 1,
+			status: http.StatusTooManyRequests, reason: "queue_full",
+		},
+		{
+			name:       "queue timeout",
+			queueDepth: 1, queueTimeout: 10 * time.Millisecond,
+			status: http.StatusServiceUnavailable, reason: "queue_timeout",
+		},
+		{name: "shed", shed: 1, status: http.StatusServiceUnavailable, reason: "load_threshold"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newMetrics(prometheus.NewRegistry())
+			l := newConcurrencyLimit("heavy", 1, m).withQueue(tt.queueDepth, tt.queueTimeout).withShedding(tt.shed)
+			inFlight, queued := m.limitInFlight.WithLabelValues(l.class), m.limitQueued.WithLabelValues(l.class)
+			h, release := blockingLimit(l)
+
+			first := startRequest(t, h)
+			eventually(t, "the first request to take the slot", func() bool { return testutil.ToFloat64(inFlight) == 1 })
+			var waiting []<-chan *httptest.ResponseRecorder
+			for i := range tt.queued {
+				waiting = append(waiting, startRequest(t, h))
+				eventually(t, "a request to queue", func() bool { return testutil.ToFloat64(queued) == float64(i+1) })
+			}
+
+			w := serveRequest(t, h, http.MethodGet, "/x", "")
+			wantError(t, w, tt.status, "overloaded")
+			if got := w.Header().Get(overloadHeader); got != tt.reason {
+				t.Errorf("%s = %q, want %q", overloadHeader, got, tt.reason)
+			}
+			if got := testutil.ToFloat64(m.limitRejected.WithLabelValues(l.class, tt.reason)); got != 1 {
+				t.Errorf("rejected{reason=%q} = %v, want 1", tt.reason, got)
+			}
+			if testutil.ToFloat64(queued) != float64(tt.queued) {
+				t.Errorf("queued = %v, want %d", testutil.ToFloat64(queued), tt.queued)
+			}
+
+			close(release)
+			for _, done := range append(waiting, first) {
+				if w := <-done; w.Code != http.StatusNoContent {
+					t.Errorf("admitted request: status = %d, want 204", w.Code)
+				}
+			}
+			if testutil.ToFloat64(inFlight) != 0 || testutil.ToFloat64(queued) != 0 {
+				t.Errorf("after release: in flight %v, queued %v, want 0 and 0", testutil.ToFloat64(inFlight), testutil.ToFloat64(queued))
+			}
+		})
+	}
+}
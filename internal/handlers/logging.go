@@ -0,0 +1,158 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/aws/smithy-go/middleware"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+	"github.com/gin-gonic/gin"
+)
+
+const requestIDHeader = "X-Request-ID"
+
+// logLevel is the minimum level of the service logger. It is a LevelVar so
+// POST /admin/reload can change LOG_LEVEL on a running instance.
+var logLevel slog.LevelVar
+
+// NewLogger builds the service logger, writing JSON lines for the log
+// pipeline or, with LOG_FORMAT=text, key=value lines for local runs. main
+// also installs it as the slog default, which the standard log package and
+// gin's debug output go through.
+func NewLogger(format string) (*slog.Logger, error) {
+	opts := &slog.HandlerOptions{Level: &logLevel}
+	switch format {
+	case "json":
+		return slog.New(slog.NewJSONHandler(os.Stderr, opts)), nil
+	case "text":
+		return slog.New(slog.NewTextHandler(os.Stderr, opts)), nil
+	}
+	return nil, fmt.Errorf("LOG_FORMAT must be json or text, got %q", format)
+}
+
+// parseLogLevel accepts debug, info, warn or error.
+func parseLogLevel(s string) (slog.Level, error) {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(s)); err != nil {
+		return level, fmt.Errorf("LOG_LEVEL must be debug, info, warn or error, got %q", s)
+	}
+	return level, nil
+}
+
+type requestIDKey struct{}
+
+type loggerKey struct{}
+
+// requestIDFrom returns the correlation ID stored on ctx, or "".
+func requestIDFrom(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// validRequestID accepts caller-supplied IDs that are short and printable, so
+// they can be echoed into headers and log lines safely.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 128 {
+		return false
+	}
+	for _, r := range id {
+		if r < 0x21 || r > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+// loggerFrom returns the request-scoped logger stored on ctx, falling back to
+// the default logger outside of a request.
+func loggerFrom(ctx context.Context) *slog.Logger {
+	if l, ok := ctx.Value(loggerKey{}).(*slog.Logger); ok {
+		return l
+	}
+	return slog.Default()
+}
+
+// requestIDMiddleware reuses the caller's X-Request-ID or generates one,
+// echoes it back and stores it on the request context, along with a logger
+// tagged with it, for handlers, log lines and outgoing AWS calls.
+func requestIDMiddleware(logger *slog.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(requestIDHeader)
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+		c.Set("requestID", id)
+		c.Header(requestIDHeader, id)
+		ctx := context.WithValue(c.Request.Context(), requestIDKey{}, id)
+		ctx = context.WithValue(ctx, loggerKey{}, logger.With("req", id))
+		c.Request = c.Request.WithContext(ctx)
+		c.Next()
+	}
+}
+
+// accessLogger logs one line per request through the request-scoped logger,
+// so it carries the same request ID as the handler's own log lines. It must
+// run after requestIDMiddleware.
+func accessLogger() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		path := c.Request.URL.Path
+		c.Next()
+		attrs := []any{
+			"method", c.Request.Method,
+			"path", path,
+			"status", c.Writer.Status(),
+			"latency", time.Since(start),
+			"clientIp", c.ClientIP(),
+			"bytes", max(c.Writer.Size(), 0),
+		}
+		if len(c.Errors) > 0 {
+			attrs = append(attrs, "errors", c.Errors.String())
+		}
+		loggerFrom(c.Request.Context()).Info("request", attrs...)
+	}
+}
+
+// addRequestIDUserAgent appends the request ID to the User-Agent of AWS SDK
+// calls made on behalf of an HTTP request, which is the one free-form field
+// that reaches CloudTrail.
+func addRequestIDUserAgent(stack *middleware.Stack) error {
+	return stack.Build.Add(middleware.BuildMiddlewareFunc("auxRequestID",
+		func(ctx context.Context, in middleware.BuildInput, next middleware.BuildHandler) (
+			middleware.BuildOutput, middleware.Metadata, error,
+		) {
+			if id := requestIDFrom(ctx); id != "" {
+				if req, ok := in.Request.(*smithyhttp.Request); ok {
+					ua := req.Header.Get("User-Agent")
+					req.Header.Set("User-Agent", ua+" req/"+id)
+				}
+			}
+			return next.HandleBuild(ctx, in)
+		}), middleware.After)
+}
+
+// slowRequestLogger emits a dedicated warning for requests slower than
+// SLOW_REQUEST_THRESHOLD, separate from the access log so alerting can key
+// off it. A zero threshold disables it.
+func slowRequestLogger(live *liveConfig) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+		threshold := live.get().SlowRequestThreshold
+		if latency := time.Since(start); threshold > 0 && latency > threshold {
+			loggerFrom(c.Request.Context()).Warn("slow request",
+				"method", c.Request.Method, "path", c.Request.URL.Path, "status", c.Writer.Status(), "latency", latency)
+		}
+	}
+}
@@ -0,0 +1,169 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+var generatedRequestID = regexp.MustCompile(`^[0-9a-f]{32}$`)
+
+// linesWithMsg returns the log lines whose message is msg.
+func linesWithMsg(lines []map[string]any, msg string) []map[string]any {
+	var out []map[string]any
+	for _, l := range lines {
+		if l["msg"] == msg {
+			out = append(out, l)
+		}
+	}
+	return out
+}
+
+func TestRequestLogging(t *testing.T) {
+	tests := []struct {
+		name     string
+		header   []string
+		err      error
+		id       string // "" for a generated one
+		status   int
+		errLevel string // level of the handler's error line, "" for none
+	}{
+		{name: "generated id", status: http.StatusOK},
+		{name: "caller id", header: []string{requestIDHeader, "abc-123"}, id: "abc-123", status: http.StatusOK},
+		{name: "invalid caller id", header: []string{requestIDHeader, "has space"}, status: http.StatusOK},
+		{
+			name:     "handler error",
+			header:   []string{requestIDHeader, "trace-500"},
+			err:      errors.New("connection reset"),
+			id:       "trace-500",
+			status:   http.StatusInternalServerError,
+			errLevel: "ERROR",
+		},
+		{
+			name:     "client error",
+			err:      awsError("AccessDenied"),
+			status:   http.StatusForbidden,
+			errLevel: "INFO",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := &fakeS3{listBuckets: func(context.Context, *s3.ListBucketsInput) (*s3.ListBucketsOutput, error) {
+				if tt.err != nil {
+					return nil, tt.err
+				}
+				return &s3.ListBucketsOutput{}, nil
+			}}
+			s := newTestServer(t, testConfig(t), testClients(fake, &fakeSSM{}))
+
+			w := s.do(t, http.MethodGet, "/buckets", "", tt.header...)
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.status, w.Body)
+			}
+			id := w.Header().Get(requestIDHeader)
+			if tt.id != "" && id != tt.id {
+				t.Errorf("%s = %q, want %q", requestIDHeader, id, tt.id)
+			}
+			if tt.id == "" && !generatedRequestID.MatchString(id) {
+				t.Errorf("%s = %q, want a generated ID", requestIDHeader, id)
+			}
+
+			lines := s.log.lines(t)
+			access := linesWithMsg(lines, "request")
+			if len(access) != 1 {
+				t.Fatalf("access lines = %d, want 1: %v", len(access), lines)
+			}
+			line := access[0]
+			want := map[string]any{
+				"level":    "INFO",
+				"req":      id,
+				"method":   http.MethodGet,
+				"path":     "/buckets",
+				"status":   float64(tt.status),
+				"clientIp": "192.0.2.1",
+			}
+			for k, v := range want {
+				if line[k] != v {
+					t.Errorf("access line %s = %v, want %v", k, line[k], v)
+				}
+			}
+			for _, k := range []string{"time", "latency", "bytes"} {
+				if _, ok := line[k]; !ok {
+					t.Errorf("access line has no %s: %v", k, line)
+				}
+			}
+
+			failed := linesWithMsg(lines, "aws request failed")
+			if tt.errLevel == "" {
+				if len(failed) != 0 {
+					t.Errorf("error lines = %v, want none", failed)
+				}
+				return
+			}
+			if len(failed) != 1 {
+				t.Fatalf("error lines = %d, want 1: %v", len(failed), lines)
+			}
+			if got := failed[0]["req"]; got != id {
+				t.Errorf("error line req = %v, want %q", got, id)
+			}
+			if got := failed[0]["level"]; got != tt.errLevel {
+				t.Errorf("error line level = %v, want %s", got, tt.errLevel)
+			}
+			if got := failed[0]["err"]; got != tt.err.Error() {
+				t.Errorf("error line err = %v, want %q", got, tt.err.Error())
+			}
+		})
+	}
+}
+
+func TestRequestLoggingRejectedRegion(t *testing.T) {
+	s := newTestServer(t, testConfig(t), testClients(&fakeS3{}, &fakeSSM{}))
+
+	w := s.do(t, http.MethodGet, "/buckets?region=xx-fake-9", "", requestIDHeader, "trace-400")
+	wantError(t, w, http.StatusBadRequest, "bad_request")
+
+	lines := s.log.lines(t)
+	access := linesWithMsg(lines, "request")
+	if len(access) != 1 {
+		t.Fatalf("access lines = %d, want 1: %v", len(access), lines)
+	}
+	if got := access[0]["req"]; got != "trace-400" {
+		t.Errorf("access line req = %v, want trace-400", got)
+	}
+	if got := access[0]["status"]; got != float64(http.StatusBadRequest) {
+		t.Errorf("access line status = %v, want %d", got, http.StatusBadRequest)
+	}
+}
+
+func TestNewLogger(t *testing.T) {
+	tests := []struct {
+		format string
+		want   string
+	}{
+		{format: "json", want: "*slog.JSONHandler"},
+		{format: "text", want: "*slog.TextHandler"},
+		{format: "console"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			logger, err := NewLogger(tt.format)
+			if tt.want == "" {
+				if err == nil {
+					t.Errorf("NewLogger(%q): no error", tt.format)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := fmt.Sprintf("%T", logger.Handler()); got != tt.want {
+				t.Errorf("handler = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
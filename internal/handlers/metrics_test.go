@@ -0,0 +1,152 @@
+package handlers
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/smithy-go/middleware"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func bucketsServer(t *testing.T) *testServer {
+	t.Helper()
+	fake := &fakeS3{listBuckets: func(context.Context, *s3.ListBucketsInput) (*s3.ListBucketsOutput, error) {
+		return &s3.ListBucketsOutput{}, nil
+	}}
+	return newTestServer(t, testConfig(t), testClients(fake, &fakeSSM{}))
+}
+
+func TestMetricsSnapshot(t *testing.T) {
+	tests := []struct {
+		name    string
+		target  string
+		want    []string
+		notWant []string
+	}{
+		{
+			name:   "everything",
+			target: "/metrics/snapshot",
+			want:   []string{`http_requests_total{method="GET",route="/buckets",status="200"} 1`, "# TYPE go_goroutines gauge"},
+		},
+		{
+			name:    "prefix",
+			target:  "/metrics/snapshot?prefix=http_",
+			want:    []string{"# TYPE http_requests counter", "# TYPE http_request_duration_seconds histogram"},
+			notWant: []string{"go_goroutines", "process_", "aws_calls"},
+		},
+		{
+			name:    "no match",
+			target:  "/metrics/snapshot?prefix=nothing_",
+			notWant: []string{"# TYPE"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := bucketsServer(t)
+			s.do(t, http.MethodGet, "/buckets", "")
+
+			w := s.do(t, http.MethodGet, tt.target, "")
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d, want 200", w.Code)
+			}
+			if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "application/openmetrics-text") {
+				t.Errorf("Content-Type = %q, want application/openmetrics-text", ct)
+			}
+			body := w.Body.String()
+			if !strings.HasSuffix(body, "# EOF\n") {
+				t.Errorf("snapshot does not end with # EOF:\n%s", body)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(body, want) {
+					t.Errorf("snapshot lacks %q:\n%s", want, body)
+				}
+			}
+			for _, notWant := range tt.notWant {
+				if strings.Contains(body, notWant) {
+					t.Errorf("snapshot has %q:\n%s", notWant, body)
+				}
+			}
+		})
+	}
+}
+
+func TestMetricsScrape(t *testing.T) {
+	s := bucketsServer(t)
+	s.do(t, http.MethodGet, "/buckets", "")
+	s.do(t, http.MethodGet, "/livez", "")
+
+	w := s.do(t, http.MethodGet, "/metrics", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", w.Code)
+	}
+	body := w.Body.String()
+	for _, want := range []string{
+		`http_requests_total{method="GET",route="/buckets",status="200"} 1`,
+		`http_request_duration_seconds_count{method="GET",route="/buckets"} 1`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("scrape lacks %q", want)
+		}
+	}
+	for _, route := range []string{`route="/livez"`, `route="/metrics"`} {
+		if strings.Contains(body, route) {
+			t.Errorf("scrape has %s, which is left out of the request metrics", route)
+		}
+	}
+}
+
+// instrumentAWS records calls made by real SDK clients, here against a
+// local S3 stand-in.
+func TestInstrumentAWS(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		body    string
+		outcome string
+	}{
+		{name: "success", status: http.StatusOK, body: `<ListAllMyBucketsResult></ListAllMyBucketsResult>`, outcome: "success"},
+		{
+			name:    "error",
+			status:  http.StatusForbidden,
+			body:    `<Error><Code>AccessDenied</Code><Message>denied</Message></Error>`,
+			outcome: "error",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				w.WriteHeader(tt.status)
+				io.WriteString(w, tt.body)
+			}))
+			defer srv.Close()
+			m := newMetrics(prometheus.NewRegistry())
+			client := s3.New(s3.Options{
+				Region:           testRegion,
+				BaseEndpoint:     aws.String(srv.URL),
+				UsePathStyle:     true,
+				Credentials:      credentials.NewStaticCredentialsProvider("AKIDTEST", "secret", ""),
+				RetryMaxAttempts: 1,
+				APIOptions:       []func(*middleware.Stack) error{m.instrumentAWS},
+			})
+
+			_, err := client.ListBuckets(t.Context(), &s3.ListBucketsInput{})
+			if (err != nil) != (tt.outcome == "error") {
+				t.Fatalf("ListBuckets err = %v", err)
+			}
+			if got := testutil.ToFloat64(m.awsCalls.WithLabelValues("s3", "ListBuckets", tt.outcome)); got != 1 {
+				t.Errorf("aws_calls_total{outcome=%q} = %v, want 1", tt.outcome, got)
+			}
+			if n := testutil.CollectAndCount(m.awsCallDuration, "aws_call_duration_seconds"); n != 1 {
+				t.Errorf("aws_call_duration_seconds series = %d, want 1", n)
+			}
+		})
+	}
+}
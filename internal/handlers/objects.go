@@ -0,0 +1,770 @@
+package handlers
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+	"github.com/gin-gonic/gin"
+	"golang.org/x/sync/errgroup"
+)
+
+type objectSummary struct {
+	Key          string     `json:"key"`
+	Size         int64      `json:"size"`
+	LastModified *time.Time `json:"lastModified,omitempty"`
+}
+
+type objectListing struct {
+	Objects []objectSummary `json:"objects"`
+	// Prefixes holds the folder-like common prefixes when a delimiter is set.
+	Prefixes  []string `json:"prefixes"`
+	NextToken string   `json:"nextToken,omitempty"`
+	// EncodingType is "url" when keys and prefixes are URL-encoded.
+	EncodingType string `json:"encodingType,omitempty"`
+}
+
+type objectListOptions struct {
+	sortBy  string // "", "size" or "lastModified"
+	desc    bool
+	minSize int64
+	maxSize int64 // negative means no upper bound
+	all     bool
+}
+
+func parseObjectListOptions(c *gin.Context) (objectListOptions, error) {
+	opts := objectListOptions{maxSize: -1}
+
+	switch s := c.Query("sort"); s {
+	case "", "size", "lastModified":
+		opts.sortBy = s
+	default:
+		return opts, errors.New("sort must be size or lastModified")
+	}
+
+	switch o := c.DefaultQuery("order", "asc"); o {
+	case "asc":
+	case "desc":
+		opts.desc = true
+	default:
+		return opts, errors.New("order must be asc or desc")
+	}
+
+	var err error
+	if v := c.Query("minSize"); v != "" {
+		if opts.minSize, err = strconv.ParseInt(v, 10, 64); err != nil || opts.minSize < 0 {
+			return opts, errors.New("minSize must be a non-negative integer")
+		}
+	}
+	if v := c.Query("maxSize"); v != "" {
+		if opts.maxSize, err = strconv.ParseInt(v, 10, 64); err != nil || opts.maxSize < 0 {
+			return opts, errors.New("maxSize must be a non-negative integer")
+		}
+	}
+	opts.all = c.Query("all") == "true"
+	return opts, nil
+}
+
+func (o objectListOptions) matches(obj objectSummary) bool {
+	if obj.Size < o.minSize {
+		return false
+	}
+	return o.maxSize < 0 || obj.Size <= o.maxSize
+}
+
+func (o objectListOptions) sort(objs []objectSummary) {
+	var less func(a, b objectSummary) bool
+	switch o.sortBy {
+	case "size":
+		less = func(a, b objectSummary) bool { return a.Size < b.Size }
+	case "lastModified":
+		less = func(a, b objectSummary) bool {
+			return aws.ToTime(a.LastModified).Before(aws.ToTime(b.LastModified))
+		}
+	default:
+		if !o.desc {
+			return // S3 already returns keys in ascending lexical order
+		}
+		less = func(a, b objectSummary) bool { return a.Key < b.Key }
+	}
+	sort.SliceStable(objs, func(i, j int) bool {
+		if o.desc {
+			return less(objs[j], objs[i])
+		}
+		return less(objs[i], objs[j])
+	})
+}
+
+// listObjectsHandler lists the objects of a bucket, optionally under a prefix.
+// With ?delimiter=/ keys are grouped S3-style and the "folders" below the
+// prefix come back in prefixes instead of objects.
+//
+// ListObjectsV2 returns keys in lexical order, so sort/order and the
+// minSize/maxSize filters are applied server-side to the fetched window only:
+// a single page (resumable via nextToken) unless the client passes all=true
+// to fetch the full listing before sorting. Either way at most MAX_RESPONSE_ITEMS keys
+// are fetched, lowered by ?limit=; an all=true listing cut short by the cap
+// is marked truncated.
+//
+// ?encoding-type=url has S3 URL-encode keys and prefixes, so keys with
+// control characters or invalid UTF-8 survive the JSON response; they come
+// back encoded, flagged by encodingType, and decode with standard form
+// unescaping (e.g. url.QueryUnescape). ?decodeKeys=true decodes them here
+// instead, for keys that are valid UTF-8 but awkward in URLs.
+func listObjectsHandler(cl *awsClients, live *liveConfig) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		settings := live.get()
+		opts, err := parseObjectListOptions(c)
+		if err != nil {
+			respondError(c, http.StatusBadRequest, "bad_request", err.Error())
+			return
+		}
+		limit, err := listLimit(c, settings.MaxResponseItems)
+		if err != nil {
+			respondError(c, http.StatusBadRequest, "bad_request", err.Error())
+			return
+		}
+
+		input := &s3.ListObjectsV2Input{
+			Bucket: aws.String(c.Param("bucket")),
+		}
+		if prefix := c.Query("prefix"); prefix != "" {
+			input.Prefix = &prefix
+		}
+		if delimiter := c.Query("delimiter"); delimiter != "" {
+			input.Delimiter = &delimiter
+		}
+		if token := c.Query("nextToken"); token != "" {
+			input.ContinuationToken = &token
+		}
+		encoded, decode := false, c.Query("decodeKeys") == "true"
+		switch c.Query("encoding-type") {
+		case "":
+		case "url":
+			input.EncodingType = s3types.EncodingTypeUrl
+			encoded = true
+		default:
+			respondError(c, http.StatusBadRequest, "bad_request", "encoding-type must be url")
+			return
+		}
+		keyOf := func(s *string) (string, error) {
+			if !encoded || !decode {
+				return aws.ToString(s), nil
+			}
+			return url.QueryUnescape(aws.ToString(s))
+		}
+
+		client := cl.bucketS3(c.Request.Context(), c.Param("bucket"))
+		listing := objectListing{Objects: []objectSummary{}, Prefixes: []string{}}
+		if encoded && !decode {
+			listing.EncodingType = "url"
+		}
+		fetched := 0
+		for {
+			input.MaxKeys = aws.Int32(pageSize(limit, fetched, 1000))
+			page, err := client.ListObjectsV2(c.Request.Context(), input)
+			if err != nil {
+				respondS3Error(c, err)
+				return
+			}
+			fetched += len(page.Contents) + len(page.CommonPrefixes)
+			for _, o := range page.Contents {
+				key, err := keyOf(o.Key)
+				if err != nil {
+					respondError(c, http.StatusBadGateway, "upstream", "s3 returned a malformed encoded key")
+					return
+				}
+				obj := objectSummary{
+					Key:          key,
+					Size:         aws.ToInt64(o.Size),
+					LastModified: o.LastModified,
+				}
+				if opts.matches(obj) {
+					listing.Objects = append(listing.Objects, obj)
+				}
+			}
+			for _, p := range page.CommonPrefixes {
+				prefix, err := keyOf(p.Prefix)
+				if err != nil {
+					respondError(c, http.StatusBadGateway, "upstream", "s3 returned a malformed encoded prefix")
+					return
+				}
+				listing.Prefixes = append(listing.Prefixes, prefix)
+			}
+			token := aws.ToString(page.NextContinuationToken)
+			if token == "" {
+				break
+			}
+			if !opts.all {
+				listing.NextToken = token
+				break
+			}
+			if limit > 0 && fetched >= limit {
+				listing.NextToken = token
+				setListPage(c, listPage{truncated: true, nextToken: token})
+				break
+			}
+			input.ContinuationToken = &token
+		}
+		opts.sort(listing.Objects)
+		if respondEmptyListing(c, len(listing.Objects)+len(listing.Prefixes), "objects") {
+			return
+		}
+
+		respondCacheable(c, settings.ListingMaxAge, "", listing)
+	}
+}
+
+type uploadResult struct {
+	Bucket string `json:"bucket"`
+	Key    string `json:"key"`
+	ETag   string `json:"etag"`
+}
+
+// objectKey returns the object key captured by a /objects/*key route.
+func objectKey(c *gin.Context) string {
+	return strings.TrimPrefix(c.Param("key"), "/")
+}
+
+// uploadContentType is the Content-Type stored with an upload: the one the
+// client sent, else the one the key's extension implies, else fallback.
+func uploadContentType(key, supplied, fallback string) string {
+	if supplied != "" {
+		return supplied
+	}
+	if ct := mime.TypeByExtension(path.Ext(key)); ct != "" {
+		return ct
+	}
+	return fallback
+}
+
+// putObjectHandler streams the request body to S3 without buffering it in
+// memory; the uploader switches to multipart for large bodies and aborts the
+// upload if the client disconnects midway. Without a Content-Type header the
+// type is inferred from the key's extension, falling back to defaultType.
+func putObjectHandler(cl *awsClients, maxSize int64, defaultType string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := objectKey(c)
+		if key == "" {
+			respondError(c, http.StatusBadRequest, "bad_request", "object key is required")
+			return
+		}
+		if c.Request.ContentLength > maxSize {
+			respondError(c, http.StatusRequestEntityTooLarge, "too_large",
+				fmt.Sprintf("body exceeds the %d byte upload limit", maxSize))
+			return
+		}
+
+		input := &s3.PutObjectInput{
+			Bucket:      aws.String(c.Param("bucket")),
+			Key:         aws.String(key),
+			Body:        http.MaxBytesReader(c.Writer, c.Request.Body, maxSize),
+			ContentType: aws.String(uploadContentType(key, c.ContentType(), defaultType)),
+		}
+		uploadObject(c, cl, maxSize, input)
+	}
+}
+
+// uploadObject runs the upload and writes the response, mapping an exceeded
+// body limit to 413.
+func uploadObject(c *gin.Context, cl *awsClients, maxSize int64, input *s3.PutObjectInput) {
+	uploader := manager.NewUploader(cl.bucketS3(c.Request.Context(), *input.Bucket))
+	out, err := uploader.Upload(c.Request.Context(), input)
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		switch {
+		case errors.As(err, &tooLarge):
+			respondError(c, http.StatusRequestEntityTooLarge, "too_large",
+				fmt.Sprintf("body exceeds the %d byte upload limit", maxSize))
+		case c.Request.Context().Err() != nil:
+			loggerFrom(c.Request.Context()).Info("upload aborted", "err", err)
+			c.Abort() // client went away, nobody to answer
+		default:
+			respondS3Error(c, err)
+		}
+		return
+	}
+
+	respond(c, http.StatusCreated, uploadResult{
+		Bucket: *input.Bucket,
+		Key:    *input.Key,
+		ETag:   aws.ToString(out.ETag),
+	})
+}
+
+// formUploadHandler accepts a multipart/form-data upload with a "file" field
+// and an optional "key" field, streaming the file part straight to S3. The
+// uploaded filename is the key unless a "key" field precedes the file part.
+// The content type comes from the file part as for putObjectHandler.
+func formUploadHandler(cl *awsClients, maxSize int64, defaultType string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.ContentLength > maxSize {
+			respondError(c, http.StatusRequestEntityTooLarge, "too_large",
+				fmt.Sprintf("body exceeds the %d byte upload limit", maxSize))
+			return
+		}
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxSize)
+		reader, err := c.Request.MultipartReader()
+		if err != nil {
+			respondError(c, http.StatusBadRequest, "bad_request", "expected a multipart/form-data body")
+			return
+		}
+
+		var key string
+		for {
+			part, err := reader.NextPart()
+			if err == io.EOF {
+				respondError(c, http.StatusBadRequest, "bad_request", `missing "file" form field`)
+				return
+			}
+			if err != nil {
+				var tooLarge *http.MaxBytesError
+				if errors.As(err, &tooLarge) {
+					respondError(c, http.StatusRequestEntityTooLarge, "too_large",
+						fmt.Sprintf("body exceeds the %d byte upload limit", maxSize))
+					return
+				}
+				respondError(c, http.StatusBadRequest, "bad_request", "malformed multipart body")
+				return
+			}
+
+			switch part.FormName() {
+			case "key":
+				b, err := io.ReadAll(io.LimitReader(part, 1025))
+				if err != nil || len(b) > 1024 {
+					respondError(c, http.StatusBadRequest, "bad_request", "key must be at most 1024 bytes")
+					return
+				}
+				key = strings.TrimPrefix(string(b), "/")
+			case "file":
+				if key == "" {
+					key = part.FileName()
+				}
+				if key == "" {
+					respondError(c, http.StatusBadRequest, "bad_request", "no key given and file has no name")
+					return
+				}
+				input := &s3.PutObjectInput{
+					Bucket:      aws.String(c.Param("bucket")),
+					Key:         aws.String(key),
+					Body:        part,
+					ContentType: aws.String(uploadContentType(key, part.Header.Get("Content-Type"), defaultType)),
+				}
+				uploadObject(c, cl, maxSize, input)
+				return
+			}
+		}
+	}
+}
+
+type encodedObject struct {
+	Key         string `json:"key"`
+	ContentType string `json:"contentType,omitempty"`
+	Size        int64  `json:"size"`
+	Encoding    string `json:"encoding"`
+	Content     string `json:"content"`
+}
+
+// sseCustomerKeyHeader carries the base64 AES-256 key of an SSE-C object.
+const sseCustomerKeyHeader = "X-SSE-Customer-Key"
+
+// applySSECustomerKey sets the SSE-C parameters on input from the request's
+// X-SSE-Customer-Key header, if any. The key is passed through to S3 and
+// never logged.
+func applySSECustomerKey(c *gin.Context, input *s3.GetObjectInput) error {
+	encoded := c.GetHeader(sseCustomerKeyHeader)
+	if encoded == "" {
+		return nil
+	}
+	key, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil || len(key) != 32 {
+		return errors.New(sseCustomerKeyHeader + " must be a base64-encoded 32-byte key")
+	}
+	sum := md5.Sum(key)
+	input.SSECustomerAlgorithm = aws.String("AES256")
+	input.SSECustomerKey = aws.String(encoded)
+	input.SSECustomerKeyMD5 = aws.String(base64.StdEncoding.EncodeToString(sum[:]))
+	return nil
+}
+
+// isSSECustomerKeyError reports whether S3 refused a read because the object
+// is SSE-C encrypted and the right key wasn't supplied.
+func isSSECustomerKeyError(err error) bool {
+	var apiErr smithy.APIError
+	return errors.As(err, &apiErr) && apiErr.ErrorCode() == "InvalidRequest" &&
+		strings.Contains(apiErr.ErrorMessage(), "Server Side Encryption")
+}
+
+// getObjectHandler streams an object's bytes to the client, honouring a
+// single-range Range header with a 206 for resumable downloads and seeking.
+// With ?encoding=base64|hex the content is instead embedded in the JSON
+// envelope, which inflates it by 4/3 or 2x respectively; such responses are
+// capped at maxEncodedSize bytes of object data and ignore Range.
+// ?expectETag= only serves the object, or the requested range of it, while
+// its ETag matches, answering 412 otherwise; the check is part of the
+// GetObject call, so the object can't change between check and read.
+// Objects encrypted with a customer key (SSE-C) are read by passing that key
+// in X-SSE-Customer-Key.
+func getObjectHandler(cl *awsClients, maxEncodedSize int64) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := objectKey(c)
+		if key == "" {
+			respondError(c, http.StatusBadRequest, "bad_request", "object key is required")
+			return
+		}
+		encoding := c.Query("encoding")
+		switch encoding {
+		case "", "base64", "hex":
+		default:
+			respondError(c, http.StatusBadRequest, "bad_request", "encoding must be base64 or hex")
+			return
+		}
+
+		input := &s3.GetObjectInput{
+			Bucket: aws.String(c.Param("bucket")),
+			Key:    aws.String(key),
+		}
+		if r := c.GetHeader("Range"); r != "" && encoding == "" {
+			if !validByteRange(r) {
+				respondError(c, http.StatusRequestedRangeNotSatisfiable, "range_not_satisfiable",
+					"Range must be a single bytes=start-end, bytes=start- or bytes=-suffix range")
+				return
+			}
+			input.Range = aws.String(r)
+		}
+		if etag := c.Query("expectETag"); etag != "" {
+			if !strings.HasPrefix(etag, `"`) {
+				etag = `"` + etag + `"`
+			}
+			input.IfMatch = aws.String(etag)
+		}
+		if err := applySSECustomerKey(c, input); err != nil {
+			respondError(c, http.StatusBadRequest, "bad_request", err.Error())
+			return
+		}
+		out, err := cl.bucketS3(c.Request.Context(), *input.Bucket).GetObject(c.Request.Context(), input)
+		switch apiErrorCode(err) {
+		case "InvalidRange":
+			respondAWSError(c, err, http.StatusRequestedRangeNotSatisfiable, "range_not_satisfiable",
+				"range is outside the object")
+			return
+		case "PreconditionFailed":
+			respondAWSError(c, err, http.StatusPreconditionFailed, "precondition_failed",
+				"object ETag does not match expectETag")
+			return
+		}
+		if isSSECustomerKeyError(err) {
+			respondAWSError(c, err, http.StatusBadRequest, "bad_request",
+				"object is encrypted with a customer key; supply it in the "+sseCustomerKeyHeader+" header")
+			return
+		}
+		if err != nil {
+			respondS3Error(c, err)
+			return
+		}
+		defer func() { _ = out.Body.Close() }()
+
+		contentType := aws.ToString(out.ContentType)
+		size := aws.ToInt64(out.ContentLength)
+
+		if encoding == "" {
+			status := http.StatusOK
+			headers := map[string]string{"Accept-Ranges": "bytes"}
+			if out.ContentRange != nil {
+				status = http.StatusPartialContent
+				headers["Content-Range"] = *out.ContentRange
+			}
+			if out.ETag != nil {
+				headers["ETag"] = *out.ETag
+			}
+			if out.LastModified != nil {
+				headers["Last-Modified"] = out.LastModified.UTC().Format(http.TimeFormat)
+			}
+			if contentType == "" {
+				contentType = "application/octet-stream"
+			}
+			c.DataFromReader(status, size, contentType, out.Body, headers)
+			return
+		}
+
+		if size > maxEncodedSize {
+			respondError(c, http.StatusRequestEntityTooLarge, "too_large",
+				fmt.Sprintf("object exceeds the %d byte limit for encoded responses", maxEncodedSize))
+			return
+		}
+		data, err := io.ReadAll(io.LimitReader(out.Body, maxEncodedSize+1))
+		if err != nil {
+			loggerFrom(c.Request.Context()).Error("read object failed", "key", key, "err", err)
+			respondError(c, http.StatusBadGateway, "upstream", "failed to read object")
+			return
+		}
+		if int64(len(data)) > maxEncodedSize {
+			respondError(c, http.StatusRequestEntityTooLarge, "too_large",
+				fmt.Sprintf("object exceeds the %d byte limit for encoded responses", maxEncodedSize))
+			return
+		}
+
+		obj := encodedObject{
+			Key:         key,
+			ContentType: contentType,
+			Size:        int64(len(data)),
+			Encoding:    encoding,
+		}
+		if encoding == "hex" {
+			obj.Content = hex.EncodeToString(data)
+		} else {
+			obj.Content = base64.StdEncoding.EncodeToString(data)
+		}
+		respond(c, http.StatusOK, obj)
+	}
+}
+
+// validByteRange accepts the single byte ranges S3 supports: bytes=start-end,
+// bytes=start- and bytes=-suffix.
+func validByteRange(r string) bool {
+	spec, ok := strings.CutPrefix(r, "bytes=")
+	if !ok {
+		return false
+	}
+	first, last, ok := strings.Cut(spec, "-")
+	if !ok || (first == "" && last == "") {
+		return false
+	}
+	var start, end int64
+	var err error
+	if first != "" {
+		if start, err = strconv.ParseInt(first, 10, 64); err != nil || start < 0 {
+			return false
+		}
+	}
+	if last != "" {
+		if end, err = strconv.ParseInt(last, 10, 64); err != nil || end < 0 {
+			return false
+		}
+		if first != "" && end < start {
+			return false
+		}
+	}
+	return true
+}
+
+const (
+	maxMetadataKeys       = 1000
+	headObjectConcurrency = 16
+)
+
+type objectMetadataRequest struct {
+	Keys []string `json:"keys" binding:"required"`
+}
+
+type objectMetadata struct {
+	Size         int64             `json:"size"`
+	ContentType  string            `json:"contentType,omitempty"`
+	ETag         string            `json:"etag,omitempty"`
+	LastModified *time.Time        `json:"lastModified,omitempty"`
+	StorageClass string            `json:"storageClass,omitempty"`
+	Metadata     map[string]string `json:"metadata,omitempty"`
+}
+
+// objectMetadataResult is either the metadata or the error for one key.
+type objectMetadataResult struct {
+	*objectMetadata
+	Error *apiError `json:"error,omitempty"`
+}
+
+// batchObjectMetadataHandler HEADs many objects concurrently and reports
+// each key's metadata or error individually, so one missing key doesn't fail
+// the batch.
+func batchObjectMetadataHandler(cl *awsClients) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req objectMetadataRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			respondError(c, http.StatusBadRequest, "bad_request", `body must be {"keys": [...]}`)
+			return
+		}
+		if len(req.Keys) == 0 || len(req.Keys) > maxMetadataKeys {
+			respondError(c, http.StatusBadRequest, "bad_request",
+				fmt.Sprintf("keys must hold between 1 and %d entries", maxMetadataKeys))
+			return
+		}
+
+		bucket := c.Param("bucket")
+		results := make([]objectMetadataResult, len(req.Keys))
+		g, ctx := errgroup.WithContext(c.Request.Context())
+		g.SetLimit(headObjectConcurrency)
+		for i, key := range req.Keys {
+			g.Go(func() error {
+				results[i] = headObject(ctx, cl, bucket, key)
+				return nil
+			})
+		}
+		_ = g.Wait() // per-key errors are reported in the results
+
+		data := make(map[string]objectMetadataResult, len(req.Keys))
+		for i, key := range req.Keys {
+			data[key] = results[i]
+		}
+		respond(c, http.StatusOK, data)
+	}
+}
+
+func headObject(ctx context.Context, cl *awsClients, bucket, key string) objectMetadataResult {
+	out, err := cl.bucketS3(ctx, bucket).HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		loggerFrom(ctx).Warn("head object failed", "key", key, "err", err)
+		switch apiErrorCode(err) {
+		case "NotFound", "NoSuchKey":
+			return objectMetadataResult{Error: &apiError{Code: "not_found", Message: "object not found"}}
+		case "AccessDenied", "Forbidden":
+			return objectMetadataResult{Error: &apiError{Code: "access_denied", Message: "access to object denied"}}
+		}
+		if ctx.Err() != nil {
+			return objectMetadataResult{Error: &apiError{Code: "timeout", Message: "request cancelled"}}
+		}
+		return objectMetadataResult{Error: &apiError{Code: "internal", Message: "s3 request failed"}}
+	}
+	return objectMetadataResult{objectMetadata: &objectMetadata{
+		Size:         aws.ToInt64(out.ContentLength),
+		ContentType:  aws.ToString(out.ContentType),
+		ETag:         aws.ToString(out.ETag),
+		LastModified: out.LastModified,
+		StorageClass: string(out.StorageClass),
+		Metadata:     out.Metadata,
+	}}
+}
+
+// objectActions serves a /objects/*key route. gin cannot route anything
+// after a catch-all, so actions on a single object (/objects/<key>/<action>)
+// are dispatched on the trailing segment here; each action runs its own
+// handler chain against the key with the action suffix stripped. Any other
+// key goes to fallback. An object whose key ends in an action name is
+// reached with ?literal=true, which sends the whole key to fallback.
+func objectActions(fallback gin.HandlerFunc, actions map[string]gin.HandlersChain) gin.HandlerFunc {
+	return trailingActions("key", fallback, actions)
+}
+
+// trailingActions dispatches the catch-all param on its last segment, as
+// described for objectActions. The chains run inside the route's last
+// handler, so c.Next does nothing there: middleware that must wrap a
+// handler has to be applied as a wrapper instead.
+func trailingActions(param string, fallback gin.HandlerFunc, actions map[string]gin.HandlersChain) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := strings.TrimPrefix(c.Param(param), "/")
+		i := strings.LastIndex(key, "/")
+		chain, ok := actions[key[i+1:]]
+		if i <= 0 || !ok || literalPath(c) {
+			fallback(c)
+			return
+		}
+		for j := range c.Params {
+			if c.Params[j].Key == param {
+				c.Params[j].Value = "/" + key[:i]
+			}
+		}
+		for _, h := range chain {
+			if h(c); c.IsAborted() {
+				return
+			}
+		}
+	}
+}
+
+// literalPath reports whether the request asked, with ?literal=true, for its
+// catch-all path to be taken as a plain name or key, so one that collides
+// with an action or a fixed endpoint stays addressable.
+func literalPath(c *gin.Context) bool {
+	return c.Query("literal") == "true"
+}
+
+// exactKey serves h at /objects/<key> only, keeping a fixed sub-path like
+// /objects/metadata next to the per-object actions.
+func exactKey(key string, h gin.HandlerFunc) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if objectKey(c) != key || literalPath(c) {
+			noRouteHandler()(c)
+			return
+		}
+		h(c)
+	}
+}
+
+type moveObjectRequest struct {
+	DestKey    string `json:"destKey" binding:"required"`
+	DestBucket string `json:"destBucket"`
+}
+
+// moveObjectHandler renames an object. S3 has no native rename, so this is a
+// CopyObject followed by a DeleteObject of the source, which only happens
+// once the copy has succeeded; a failed copy leaves the source untouched.
+// The caller must pass ?confirm=true since the source key goes away.
+func moveObjectHandler(cl *awsClients, allow bucketAllowlist) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		bucket, key := c.Param("bucket"), objectKey(c)
+		if c.Query("confirm") != "true" {
+			respondError(c, http.StatusBadRequest, "bad_request", "moving an object deletes the source; pass confirm=true")
+			return
+		}
+		var req moveObjectRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			respondError(c, http.StatusBadRequest, "bad_request", `body must be {"destKey": "...", "destBucket": "..."}`)
+			return
+		}
+		destBucket := req.DestBucket
+		if destBucket == "" {
+			destBucket = bucket
+		}
+		if !allow.allows(destBucket) {
+			respondError(c, http.StatusForbidden, "forbidden", "destination bucket is not exposed by this service")
+			return
+		}
+		if destBucket == bucket && req.DestKey == key {
+			respondError(c, http.StatusBadRequest, "bad_request", "destination is the same as the source")
+			return
+		}
+
+		source := (&url.URL{Path: bucket + "/" + key}).EscapedPath()
+		out, err := cl.bucketS3(c.Request.Context(), destBucket).CopyObject(c.Request.Context(), &s3.CopyObjectInput{
+			Bucket:     aws.String(destBucket),
+			Key:        aws.String(req.DestKey),
+			CopySource: aws.String(source),
+		})
+		if err != nil {
+			respondS3Error(c, err)
+			return
+		}
+		if _, err := cl.bucketS3(c.Request.Context(), bucket).DeleteObject(c.Request.Context(), &s3.DeleteObjectInput{
+			Bucket: aws.String(bucket),
+			Key:    aws.String(key),
+		}); err != nil {
+			respondAWSError(c, err, http.StatusInternalServerError, "internal",
+				"object copied to "+destBucket+"/"+req.DestKey+" but the source could not be deleted")
+			return
+		}
+
+		var etag string
+		if out.CopyObjectResult != nil {
+			etag = aws.ToString(out.CopyObjectResult.ETag)
+		}
+		respond(c, http.StatusOK, uploadResult{Bucket: destBucket, Key: req.DestKey, ETag: etag})
+	}
+}
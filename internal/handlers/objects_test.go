@@ -0,0 +1,86 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+func TestUploadContentType(t *testing.T) {
+	const fallback = "application/octet-stream"
+	tests := []struct {
+		key      string
+		supplied string
+		want     string
+	}{
+		{key: "index.html", want: "text/html; charset=utf-8"},
+		{key: "site/styles/main.css", want: "text/css; charset=utf-8"},
+		{key: "data.json", want: "application/json"},
+		{key: "logo.png", want: "image/png"},
+		{key: "photo.jpg", want: "image/jpeg"},
+		{key: "photo.JPEG", want: "image/jpeg"},
+		{key: "anim.gif", want: "image/gif"},
+		{key: "icon.svg", want: "image/svg+xml"},
+		{key: "image.webp", want: "image/webp"},
+		{key: "report.pdf", want: "application/pdf"},
+		{key: "no-extension", want: fallback},
+		{key: "dir.d/no-extension", want: fallback},
+		{key: "archive.unknownext", want: fallback},
+		{key: "logo.png", supplied: "application/x-custom", want: "application/x-custom"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.key+" "+tt.supplied, func(t *testing.T) {
+			if got := uploadContentType(tt.key, tt.supplied, fallback); got != tt.want {
+				t.Errorf("uploadContentType(%q, %q) = %q, want %q", tt.key, tt.supplied, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPutObjectContentType(t *testing.T) {
+	tests := []struct {
+		name     string
+		key      string
+		header   string
+		fallback string
+		want     string
+	}{
+		{name: "inferred", key: "site/index.html", want: "text/html; charset=utf-8"},
+		{name: "client header", key: "site/index.html", header: "text/plain", want: "text/plain"},
+		{name: "fallback", key: "blob", want: "application/octet-stream"},
+		{name: "configured fallback", key: "blob", fallback: "binary/x-aux", want: "binary/x-aux"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got string
+			fake := &fakeS3{putObject: func(_ context.Context, in *s3.PutObjectInput) (*s3.PutObjectOutput, error) {
+				got = aws.ToString(in.ContentType)
+				return &s3.PutObjectOutput{ETag: aws.String(`"etag"`)}, nil
+			}}
+			cfg := testConfig(t)
+			if tt.fallback != "" {
+				cfg.DefaultContentType = tt.fallback
+			}
+			s := newTestServer(t, cfg, testClients(fake, &fakeSSM{}))
+
+			req := httptest.NewRequest(http.MethodPut, "/buckets/b/objects/"+tt.key, strings.NewReader("<p>hi</p>"))
+			req.Header.Set(apiKeyHeader, testAdminKey)
+			if tt.header != "" {
+				req.Header.Set("Content-Type", tt.header)
+			}
+			w := httptest.NewRecorder()
+			s.router.ServeHTTP(w, req)
+			if w.Code != http.StatusCreated {
+				t.Fatalf("status = %d, want 201; body %s", w.Code, w.Body.String())
+			}
+			if got != tt.want {
+				t.Errorf("stored Content-Type = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,80 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+const listPageKey = "listPage"
+
+// listPage is the continuation state of a listing that stopped early; respond
+// surfaces it as truncated/nextToken in the envelope.
+type listPage struct {
+	truncated bool
+	nextToken string
+}
+
+func setListPage(c *gin.Context, page listPage) {
+	c.Set(listPageKey, page)
+}
+
+func listPageFrom(c *gin.Context) listPage {
+	v, _ := c.Get(listPageKey)
+	page, _ := v.(listPage)
+	return page
+}
+
+const listFiltersKey = "listFilters"
+
+// setListFilters records the filters a listing applied; respond echoes them
+// in the envelope.
+func setListFilters(c *gin.Context, filters map[string][]string) {
+	c.Set(listFiltersKey, filters)
+}
+
+func listFiltersFrom(c *gin.Context) map[string][]string {
+	v, _ := c.Get(listFiltersKey)
+	filters, _ := v.(map[string][]string)
+	return filters
+}
+
+// listLimit returns how many items a listing may return. MAX_RESPONSE_ITEMS
+// is the ceiling: a client ?limit= can lower it but never raise it. 0 means
+// no limit.
+func listLimit(c *gin.Context, max int) (int, error) {
+	v := c.Query("limit")
+	if v == "" {
+		return max, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n <= 0 {
+		return 0, errors.New("limit must be a positive integer")
+	}
+	if max > 0 && n > max {
+		return max, nil
+	}
+	return n, nil
+}
+
+// pageSize bounds the next API page by the items still allowed under limit,
+// given n already fetched and the API's own maximum page size.
+func pageSize(limit, n, apiMax int) int32 {
+	if limit <= 0 || limit-n > apiMax {
+		return int32(apiMax)
+	}
+	return int32(limit - n)
+}
+
+// respondEmptyListing answers 404 for a listing with no results when the
+// client opted in with ?emptyAs404=true, and reports whether it did. Without
+// the flag an empty listing is a 200 with an empty array.
+func respondEmptyListing(c *gin.Context, n int, what string) bool {
+	if n > 0 || c.Query("emptyAs404") != "true" {
+		return false
+	}
+	respondError(c, http.StatusNotFound, "not_found", "no "+what+" found")
+	return true
+}
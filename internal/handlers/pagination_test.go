@@ -0,0 +1,304 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	ssmtypes "github.com/aws/aws-sdk-go-v2/service/ssm/types"
+)
+
+// pagedNames serves pages[i] for token "" (i == 0) or "page-<i>", with the
+// token of the next page, none after the last. A nil final token and an
+// empty final page are both how AWS ends listings.
+type pagedNames struct {
+	pages [][]string
+	// cancel, when set, is called once the page at cancelAfter is served.
+	cancel      context.CancelFunc
+	cancelAfter int
+}
+
+func (p pagedNames) page(ctx context.Context, token *string) ([]string, *string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, nil, err // the SDK fails calls on a cancelled context
+	}
+	i := 0
+	if t := aws.ToString(token); t != "" {
+		n, err := strconv.Atoi(t[len("page-"):])
+		if err != nil || n >= len(p.pages) {
+			return nil, nil, fmt.Errorf("unexpected token %q", t)
+		}
+		i = n
+	}
+	if p.cancel != nil && i == p.cancelAfter {
+		p.cancel()
+	}
+	if len(p.pages) == 0 {
+		return nil, nil, nil
+	}
+	var next *string
+	if i+1 < len(p.pages) {
+		next = aws.String("page-" + strconv.Itoa(i+1))
+	}
+	return p.pages[i], next, nil
+}
+
+var paginationCases = []struct {
+	name  string
+	pages [][]string
+	want  []string
+}{
+	{name: "no pages", pages: nil, want: []string{}},
+	{name: "one empty page", pages: [][]string{{}}, want: []string{}},
+	{name: "one page", pages: [][]string{{"a", "b"}}, want: []string{"a", "b"}},
+	{name: "several pages", pages: [][]string{{"a", "b"}, {"c"}, {"d", "e"}}, want: []string{"a", "b", "c", "d", "e"}},
+	{name: "empty final page", pages: [][]string{{"a"}, {"b"}, {}}, want: []string{"a", "b"}},
+	{name: "empty middle page", pages: [][]string{{"a"}, {}, {"b"}}, want: []string{"a", "b"}},
+}
+
+func bucketPages(p pagedNames) *fakeS3 {
+	return &fakeS3{listBuckets: func(ctx context.Context, in *s3.ListBucketsInput) (*s3.ListBucketsOutput, error) {
+		names, next, err := p.page(ctx, in.ContinuationToken)
+		if err != nil {
+			return nil, err
+		}
+		out := &s3.ListBucketsOutput{ContinuationToken: next}
+		for _, n := range names {
+			out.Buckets = append(out.Buckets, s3types.Bucket{Name: aws.String(n)})
+		}
+		return out, nil
+	}}
+}
+
+func parameterPages(p pagedNames) *fakeSSM {
+	return &fakeSSM{describeParameters: func(ctx context.Context, in *ssm.DescribeParametersInput) (*ssm.DescribeParametersOutput, error) {
+		names, next, err := p.page(ctx, in.NextToken)
+		if err != nil {
+			return nil, err
+		}
+		out := &ssm.DescribeParametersOutput{NextToken: next}
+		for _, n := range names {
+			out.Parameters = append(out.Parameters, ssmtypes.ParameterMetadata{Name: aws.String(n)})
+		}
+		return out, nil
+	}}
+}
+
+func objectPages(p pagedNames) *fakeS3 {
+	return &fakeS3{listObjectsV2: func(ctx context.Context, in *s3.ListObjectsV2Input) (*s3.ListObjectsV2Output, error) {
+		keys, next, err := p.page(ctx, in.ContinuationToken)
+		if err != nil {
+			return nil, err
+		}
+		out := &s3.ListObjectsV2Output{NextContinuationToken: next}
+		for _, k := range keys {
+			out.Contents = append(out.Contents, s3types.Object{Key: aws.String(k), Size: aws.Int64(1)})
+		}
+		return out, nil
+	}}
+}
+
+func TestListBucketNamesPagination(t *testing.T) {
+	for _, tt := range paginationCases {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := bucketPages(pagedNames{pages: tt.pages})
+			got, page, err := listBucketNames(t.Context(), testClients(fake, nil), nil, 0, "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(got, tt.want) || page.truncated {
+				t.Errorf("got %q (truncated %v), want %q", got, page.truncated, tt.want)
+			}
+			if n, want := fake.count("ListBuckets"), max(len(tt.pages), 1); n != want {
+				t.Errorf("ListBuckets calls = %d, want %d", n, want)
+			}
+		})
+	}
+}
+
+func TestDescribeParametersPagination(t *testing.T) {
+	for _, tt := range paginationCases {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := parameterPages(pagedNames{pages: tt.pages})
+			metadata, page, err := describeParameters(t.Context(), testClients(nil, fake), nil, 0, "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, m := range metadata {
+				got = append(got, aws.ToString(m.Name))
+			}
+			if !slices.Equal(got, tt.want) || page.truncated {
+				t.Errorf("got %q (truncated %v), want %q", got, page.truncated, tt.want)
+			}
+			if n, want := fake.count("DescribeParameters"), max(len(tt.pages), 1); n != want {
+				t.Errorf("DescribeParameters calls = %d, want %d", n, want)
+			}
+		})
+	}
+}
+
+func TestListObjectsPagination(t *testing.T) {
+	for _, tt := range paginationCases {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := objectPages(pagedNames{pages: tt.pages})
+			s := newTestServer(t, testConfig(t), testClients(fake, &fakeSSM{}))
+
+			var listing objectListing
+			decodeData(t, s.do(t, http.MethodGet, "/buckets/b/objects?all=true", ""), &listing)
+			got := []string{}
+			for _, o := range listing.Objects {
+				got = append(got, o.Key)
+			}
+			if !slices.Equal(got, tt.want) || listing.NextToken != "" {
+				t.Errorf("got %q (next %q), want %q", got, listing.NextToken, tt.want)
+			}
+		})
+	}
+}
+
+// A limit stops each listing mid-way with a token that resumes it.
+func TestPaginationLimitResumes(t *testing.T) {
+	pages := pagedNames{pages: [][]string{{"a", "b"}, {"c", "d"}, {"e"}}}
+	cl := testClients(bucketPages(pages), parameterPages(pages))
+
+	names, page, err := listBucketNames(t.Context(), cl, nil, 2, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(names, []string{"a", "b"}) || !page.truncated || page.nextToken != "page-1" {
+		t.Fatalf("first buckets page = %q, %+v", names, page)
+	}
+	names, page, err = listBucketNames(t.Context(), cl, nil, 10, page.nextToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(names, []string{"c", "d", "e"}) || page.truncated {
+		t.Fatalf("resumed buckets = %q, %+v", names, page)
+	}
+
+	s := newTestServer(t, testConfig(t), cl)
+	e := decodeData(t, s.do(t, http.MethodGet, "/parameters?limit=3", ""), &names)
+	if !slices.Equal(names, []string{"a", "b", "c", "d"}) || !e.Truncated || e.NextToken != "page-2" {
+		t.Fatalf("first parameters page = %q, truncated %v, next %q", names, e.Truncated, e.NextToken)
+	}
+	e = decodeData(t, s.do(t, http.MethodGet, "/parameters?nextToken="+e.NextToken, ""), &names)
+	if !slices.Equal(names, []string{"e"}) || e.Truncated {
+		t.Fatalf("resumed parameters = %q, truncated %v", names, e.Truncated)
+	}
+}
+
+// Cancelling the request mid-listing stops the loop at the next call.
+func TestPaginationStopsOnCancel(t *testing.T) {
+	pages := [][]string{{"a"}, {"b"}, {"c"}, {"d"}}
+
+	ctx, cancel := context.WithCancel(t.Context())
+	buckets := bucketPages(pagedNames{pages: pages, cancel: cancel, cancelAfter: 1})
+	if _, _, err := listBucketNames(ctx, testClients(buckets, nil), nil, 0, ""); !errors.Is(err, context.Canceled) {
+		t.Errorf("listBucketNames err = %v, want context.Canceled", err)
+	}
+	if n := buckets.count("ListBuckets"); n != 3 {
+		t.Errorf("ListBuckets calls = %d, want 3", n)
+	}
+
+	ctx, cancel = context.WithCancel(t.Context())
+	params := parameterPages(pagedNames{pages: pages, cancel: cancel, cancelAfter: 1})
+	if _, _, err := describeParameters(ctx, testClients(nil, params), nil, 0, ""); !errors.Is(err, context.Canceled) {
+		t.Errorf("describeParameters err = %v, want context.Canceled", err)
+	}
+	if n := params.count("DescribeParameters"); n != 3 {
+		t.Errorf("DescribeParameters calls = %d, want 3", n)
+	}
+}
+
+// A client pages through /parameters itself with max_results and
+// next_token, or the older limit and nextToken.
+func TestListParametersClientPaging(t *testing.T) {
+	for _, q := range []struct{ size, token string }{{"max_results", "next_token"}, {"limit", "nextToken"}} {
+		t.Run(q.size, func(t *testing.T) {
+			fake := parameterPages(pagedNames{pages: [][]string{{"a", "b"}, {"c", "d"}, {"e"}}})
+			s := newTestServer(t, testConfig(t), testClients(nil, fake))
+
+			var got [][]string
+			target := "/parameters?" + q.size + "=2"
+			for range 4 {
+				var names []string
+				e := decodeData(t, s.do(t, http.MethodGet, target, ""), &names)
+				got = append(got, names)
+				if !e.Truncated {
+					break
+				}
+				target = "/parameters?" + q.size + "=2&" + q.token + "=" + e.NextToken
+			}
+			if want := [][]string{{"a", "b"}, {"c", "d"}, {"e"}}; !slices.EqualFunc(got, want, slices.Equal) {
+				t.Errorf("pages = %q, want %q", got, want)
+			}
+			if n := fake.count("DescribeParameters"); n != 3 {
+				t.Errorf("DescribeParameters calls = %d, want 3", n)
+			}
+		})
+	}
+}
+
+func TestListParametersMaxResults(t *testing.T) {
+	tests := []struct {
+		query string
+		want  int32 // the MaxResults sent to SSM, 0 for a 400
+	}{
+		{query: "", want: 50},
+		{query: "?max_results=1", want: 1},
+		{query: "?max_results=50", want: 50},
+		{query: "?limit=500", want: 50},
+		{query: "?max_results=51"},
+		{query: "?max_results=0"},
+		{query: "?max_results=-3"},
+		{query: "?max_results=ten"},
+		{query: "?limit=0"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			var got int32
+			fake := &fakeSSM{describeParameters: func(_ context.Context, in *ssm.DescribeParametersInput) (*ssm.DescribeParametersOutput, error) {
+				got = aws.ToInt32(in.MaxResults)
+				return &ssm.DescribeParametersOutput{}, nil
+			}}
+			s := newTestServer(t, testConfig(t), testClients(nil, fake))
+
+			w := s.do(t, http.MethodGet, "/parameters"+tt.query, "")
+			if tt.want == 0 {
+				wantError(t, w, http.StatusBadRequest, "bad_request")
+				if n := fake.count("DescribeParameters"); n != 0 {
+					t.Errorf("DescribeParameters calls = %d, want 0", n)
+				}
+				return
+			}
+			if w.Code != http.StatusOK || got != tt.want {
+				t.Errorf("status %d, MaxResults %d; want 200, %d", w.Code, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestListParametersBadToken(t *testing.T) {
+	for _, param := range []string{"next_token", "nextToken"} {
+		t.Run(param, func(t *testing.T) {
+			fake := &fakeSSM{describeParameters: func(_ context.Context, in *ssm.DescribeParametersInput) (*ssm.DescribeParametersOutput, error) {
+				if aws.ToString(in.NextToken) != "garbage" {
+					t.Errorf("NextToken = %q, want garbage", aws.ToString(in.NextToken))
+				}
+				return nil, awsError("InvalidNextToken")
+			}}
+			s := newTestServer(t, testConfig(t), testClients(nil, fake))
+
+			wantError(t, s.do(t, http.MethodGet, "/parameters?"+param+"=garbage", ""), http.StatusBadRequest, "bad_request")
+		})
+	}
+}
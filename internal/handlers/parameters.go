@@ -0,0 +1,1254 @@
+package handlers
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	ssmtypes "github.com/aws/aws-sdk-go-v2/service/ssm/types"
+	"github.com/gin-gonic/gin"
+	"golang.org/x/sync/errgroup"
+	"golang.org/x/sync/singleflight"
+)
+
+const (
+	ifVersionHeader        = "If-Version"
+	parameterVersionHeader = "X-Parameter-Version"
+	// parameterTypeHeader tells a client whether it got a SecureString, and
+	// so whether the value is plaintext only because it asked to decrypt.
+	parameterTypeHeader = "X-Parameter-Type"
+)
+
+// tagFilters turns ?tag=key:value (or ?tag=key for "has tag") query params
+// into DescribeParameters filters.
+func tagFilters(tags []string) ([]ssmtypes.ParameterStringFilter, error) {
+	var filters []ssmtypes.ParameterStringFilter
+	for _, t := range tags {
+		key, value, hasValue := strings.Cut(t, ":")
+		if key == "" || (hasValue && value == "") {
+			return nil, errors.New("tag filter must be key or key:value")
+		}
+		if !hasValue {
+			filters = append(filters, ssmtypes.ParameterStringFilter{
+				Key:    aws.String("tag-key"),
+				Values: []string{key},
+			})
+			continue
+		}
+		filters = append(filters, ssmtypes.ParameterStringFilter{
+			Key:    aws.String("tag:" + key),
+			Values: []string{value},
+		})
+	}
+	return filters, nil
+}
+
+// stripNamePrefix removes prefix from every name, failing when a name
+// doesn't start with it so clients never get a mix of relative and absolute
+// names.
+func stripNamePrefix(names []string, prefix string) ([]string, error) {
+	stripped := make([]string, len(names))
+	for i, n := range names {
+		rel, ok := strings.CutPrefix(n, prefix)
+		if !ok {
+			return nil, fmt.Errorf("stripPrefix %q is not a prefix of %q", prefix, n)
+		}
+		stripped[i] = rel
+	}
+	return stripped, nil
+}
+
+// parameterListFilters builds the DescribeParameters filters of a listing
+// from ?path=, ?prefix= (name begins with), ?type= and ?tag=, returning them
+// with the query values applied, for echoing back. Each rejected filter is
+// named in the error.
+func parameterListFilters(c *gin.Context) ([]ssmtypes.ParameterStringFilter, map[string][]string, error) {
+	applied := map[string][]string{}
+	tags := c.QueryArray("tag")
+	filters, err := tagFilters(tags)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(tags) > 0 {
+		applied["tag"] = tags
+	}
+	if path := c.Query("path"); path != "" {
+		filters = append(filters, pathFilter(path))
+		applied["path"] = []string{path}
+	}
+	if prefix := c.Query("prefix"); prefix != "" {
+		filters = append(filters, ssmtypes.ParameterStringFilter{
+			Key:    aws.String("Name"),
+			Option: aws.String("BeginsWith"),
+			Values: []string{prefix},
+		})
+		applied["prefix"] = []string{prefix}
+	}
+	if typ := c.Query("type"); typ != "" {
+		switch ssmtypes.ParameterType(typ) {
+		case ssmtypes.ParameterTypeString, ssmtypes.ParameterTypeStringList, ssmtypes.ParameterTypeSecureString:
+		default:
+			return nil, nil, errors.New("type filter must be String, StringList or SecureString")
+		}
+		filters = append(filters, ssmtypes.ParameterStringFilter{
+			Key:    aws.String("Type"),
+			Option: aws.String("Equals"),
+			Values: []string{typ},
+		})
+		applied["type"] = []string{typ}
+	}
+	return filters, applied, nil
+}
+
+// pathFilter matches the parameters anywhere below path.
+func pathFilter(path string) ssmtypes.ParameterStringFilter {
+	return ssmtypes.ParameterStringFilter{
+		Key:    aws.String("Path"),
+		Option: aws.String("Recursive"),
+		Values: []string{path},
+	}
+}
+
+// maxDescribeParametersResults is the largest page DescribeParameters serves.
+const maxDescribeParametersResults = 50
+
+// describeParameters follows DescribeParameters pages from token until limit
+// parameters have been fetched, returning their metadata and where to
+// resume.
+func describeParameters(ctx context.Context, cl *awsClients, filters []ssmtypes.ParameterStringFilter, limit int, token string) ([]ssmtypes.ParameterMetadata, listPage, error) {
+	input := &ssm.DescribeParametersInput{ParameterFilters: filters}
+	if token != "" {
+		input.NextToken = &token
+	}
+	metadata := []ssmtypes.ParameterMetadata{}
+	for {
+		input.MaxResults = aws.Int32(pageSize(limit, len(metadata), maxDescribeParametersResults))
+		out, err := cl.ssmFor(ctx).DescribeParameters(ctx, input)
+		if err != nil {
+			return nil, listPage{}, err
+		}
+		metadata = append(metadata, out.Parameters...)
+		token := aws.ToString(out.NextToken)
+		if token == "" {
+			return metadata, listPage{}, nil
+		}
+		if limit > 0 && len(metadata) >= limit {
+			return metadata, listPage{truncated: true, nextToken: token}, nil
+		}
+		input.NextToken = &token
+	}
+}
+
+// respondParameterListError reports a failed parameter listing. A ?nextToken=
+// SSM doesn't accept, garbled or from another query, is the client's fault.
+func respondParameterListError(c *gin.Context, err error) {
+	if respondThrottled(c, err) {
+		return
+	}
+	if apiErrorCode(err) == "InvalidNextToken" {
+		respondAWSError(c, err, http.StatusBadRequest, "bad_request", "nextToken is invalid or expired")
+		return
+	}
+	respondAWSError(c, err, http.StatusInternalServerError, "internal", "ssm request failed")
+}
+
+type parameterStatus struct {
+	Path         string             `json:"path"`
+	Count        int                `json:"count"`
+	Encrypted    int                `json:"encrypted"`
+	LastModified *time.Time         `json:"lastModified,omitempty"`
+	Parameters   []parameterSummary `json:"parameters"`
+}
+
+// parameterStatusHandler summarizes the parameters under ?path= from
+// DescribeParameters alone: name, type, version and modification time of
+// each, plus how many are encrypted and when the tree last changed. No
+// values are read, so it needs no decrypt permission. Pages are capped at
+// MAX_RESPONSE_ITEMS and resume with ?nextToken=; the totals cover the
+// returned page.
+func parameterStatusHandler(cl *awsClients, live *liveConfig) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		settings := live.get()
+		path := c.Query("path")
+		if path == "" {
+			respondError(c, http.StatusBadRequest, "bad_request", "path is required")
+			return
+		}
+		limit, err := listLimit(c, settings.MaxResponseItems)
+		if err != nil {
+			respondError(c, http.StatusBadRequest, "bad_request", err.Error())
+			return
+		}
+		metadata, page, err := describeParameters(c.Request.Context(), cl,
+			[]ssmtypes.ParameterStringFilter{pathFilter(path)}, limit, c.Query("nextToken"))
+		if err != nil {
+			respondParameterListError(c, err)
+			return
+		}
+		setListPage(c, page)
+
+		names := make([]string, len(metadata))
+		status := parameterStatus{Path: path, Count: len(metadata)}
+		for i, p := range metadata {
+			names[i] = aws.ToString(p.Name)
+			if p.Type == ssmtypes.ParameterTypeSecureString {
+				status.Encrypted++
+			}
+			if p.LastModifiedDate != nil && (status.LastModified == nil || p.LastModifiedDate.After(*status.LastModified)) {
+				status.LastModified = p.LastModifiedDate
+			}
+		}
+		status.Parameters = parameterSummaries(metadata, names)
+		respondCacheable(c, settings.ListingMaxAge, "", status)
+	}
+}
+
+type parameterVersion struct {
+	Version          int64      `json:"version"`
+	Value            string     `json:"value"`
+	Type             string     `json:"type"`
+	LastModifiedDate *time.Time `json:"lastModifiedDate,omitempty"`
+	LastModifiedUser string     `json:"lastModifiedUser,omitempty"`
+	Labels           []string   `json:"labels"`
+}
+
+// parameterHistoryHandler lists a parameter's versions, newest first, with
+// who changed it and when. SSM keeps at most 100 versions, so the whole
+// history is fetched and ?limit= (capped at MAX_RESPONSE_ITEMS) trims it,
+// flagged as truncated. Values are decrypted only with ?decrypt=true, gated
+// like single reads.
+func parameterHistoryHandler(cl *awsClients, live *liveConfig, decryptEnabled bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		settings := live.get()
+		name := parameterName(c)
+		if err := checkParameterName(name); err != nil {
+			respondError(c, http.StatusBadRequest, "bad_request", err.Error())
+			return
+		}
+		limit, err := listLimit(c, settings.MaxResponseItems)
+		if err != nil {
+			respondError(c, http.StatusBadRequest, "bad_request", err.Error())
+			return
+		}
+		decrypt := c.Query("decrypt") == "true"
+		if decrypt && !allowDecrypt(c, decryptEnabled) {
+			return
+		}
+		ctx := c.Request.Context()
+		versions := []parameterVersion{}
+		paginator := ssm.NewGetParameterHistoryPaginator(cl.ssmFor(ctx), &ssm.GetParameterHistoryInput{
+			Name:           aws.String(name),
+			WithDecryption: aws.Bool(decrypt),
+		})
+		for paginator.HasMorePages() {
+			out, err := paginator.NextPage(ctx)
+			if err != nil {
+				respondParameterReadError(c, err)
+				return
+			}
+			for _, h := range out.Parameters {
+				labels := h.Labels
+				if labels == nil {
+					labels = []string{}
+				}
+				versions = append(versions, parameterVersion{
+					Version:          h.Version,
+					Value:            aws.ToString(h.Value),
+					Type:             string(h.Type),
+					LastModifiedDate: h.LastModifiedDate,
+					LastModifiedUser: aws.ToString(h.LastModifiedUser),
+					Labels:           labels,
+				})
+			}
+		}
+		slices.Reverse(versions) // SSM returns the oldest first
+		if limit > 0 && len(versions) > limit {
+			versions = versions[:limit]
+			setListPage(c, listPage{truncated: true})
+		}
+		respond(c, http.StatusOK, versions)
+	}
+}
+
+type pathParameter struct {
+	Value   string `json:"value"`
+	Type    string `json:"type"`
+	Version int64  `json:"version"`
+}
+
+// parametersByPathHandler reads the parameters under ?path= with their
+// values, keyed by name; ?recursive=true descends the whole subtree rather
+// than only direct children. SecureStrings stay encrypted unless
+// ?decrypt=true, which is gated like single reads. GetParametersByPath pages
+// are followed up to MAX_RESPONSE_ITEMS and resume with ?nextToken=. Reads
+// are cached like single ones, keyed by region and query.
+func parametersByPathHandler(cl *awsClients, live *liveConfig, cache *parameterCache, decryptEnabled bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		settings := live.get()
+		path := c.Query("path")
+		if !strings.HasPrefix(path, "/") {
+			respondError(c, http.StatusBadRequest, "bad_request", "path must start with /")
+			return
+		}
+		limit, err := listLimit(c, settings.MaxResponseItems)
+		if err != nil {
+			respondError(c, http.StatusBadRequest, "bad_request", err.Error())
+			return
+		}
+		decrypt := c.Query("decrypt") == "true"
+		if decrypt && !allowDecrypt(c, decryptEnabled) {
+			return
+		}
+		key := parameterListingKey(requestRegion(c.Request.Context()), "by-path", c.Request.URL.Query())
+		entry, hit := parameterListingEntry{}, false
+		if c.Query("nocache") != "true" {
+			entry, hit = cache.getListing(key)
+		}
+		params, page := map[string]pathParameter{}, entry.page
+		if hit {
+			params = entry.data.(map[string]pathParameter)
+		} else {
+			input := &ssm.GetParametersByPathInput{
+				Path:           aws.String(path),
+				Recursive:      aws.Bool(c.Query("recursive") == "true"),
+				WithDecryption: aws.Bool(decrypt),
+			}
+			if token := c.Query("nextToken"); token != "" {
+				input.NextToken = aws.String(token)
+			}
+			for {
+				input.MaxResults = aws.Int32(pageSize(limit, len(params), 10))
+				out, err := cl.ssmFor(c.Request.Context()).GetParametersByPath(c.Request.Context(), input)
+				if err != nil {
+					respondParameterListError(c, err)
+					return
+				}
+				for _, p := range out.Parameters {
+					params[aws.ToString(p.Name)] = pathParameter{Value: aws.ToString(p.Value), Type: string(p.Type), Version: p.Version}
+				}
+				token := aws.ToString(out.NextToken)
+				if token == "" {
+					break
+				}
+				if limit > 0 && len(params) >= limit {
+					page = listPage{truncated: true, nextToken: token}
+					break
+				}
+				input.NextToken = &token
+			}
+			cache.putListing(key, params, page)
+		}
+		cache.setHeaders(c, hit, entry.fetched)
+		setListPage(c, page)
+		if respondEmptyListing(c, len(params), "parameters") {
+			return
+		}
+		respondCacheable(c, settings.ListingMaxAge, "", params)
+	}
+}
+
+type parameterSummary struct {
+	Name             string     `json:"name"`
+	Type             string     `json:"type"`
+	DataType         string     `json:"dataType,omitempty"`
+	Tier             string     `json:"tier,omitempty"`
+	Version          int64      `json:"version"`
+	LastModifiedDate *time.Time `json:"lastModifiedDate,omitempty"`
+	LastModifiedUser string     `json:"lastModifiedUser,omitempty"`
+	Description      string     `json:"description,omitempty"`
+	KeyID            string     `json:"keyId,omitempty"`
+}
+
+// parameterSummaries renders DescribeParameters metadata for verbose
+// listings, under names, which may have had a prefix stripped.
+func parameterSummaries(metadata []ssmtypes.ParameterMetadata, names []string) []parameterSummary {
+	summaries := make([]parameterSummary, len(metadata))
+	for i, p := range metadata {
+		summaries[i] = parameterSummary{
+			Name:             names[i],
+			Type:             string(p.Type),
+			DataType:         aws.ToString(p.DataType),
+			Tier:             string(p.Tier),
+			Version:          p.Version,
+			LastModifiedDate: p.LastModifiedDate,
+			LastModifiedUser: aws.ToString(p.LastModifiedUser),
+			Description:      aws.ToString(p.Description),
+			KeyID:            aws.ToString(p.KeyId),
+		}
+	}
+	return summaries
+}
+
+// parameterName returns the parameter a /parameters/*name route addresses.
+// A single segment is a plain name (/parameters/db is "db"), several
+// segments are a hierarchical path (/parameters/app/prod/db is
+// "/app/prod/db"), and a leading double slash or %2F marks a one-level
+// path (/parameters//db is "/db").
+func parameterName(c *gin.Context) string {
+	name := strings.TrimPrefix(c.Param("name"), "/")
+	if strings.Contains(name, "/") && !strings.HasPrefix(name, "/") {
+		name = "/" + name
+	}
+	return name
+}
+
+// parameterNamePattern is the character set SSM allows in parameter names,
+// optionally followed by a :version or :label selector.
+var parameterNamePattern = regexp.MustCompile(`^[A-Za-z0-9_.\-/]+(:[A-Za-z0-9_.\-]+)?$`)
+
+// maxParameterNameLength is SSM's limit on a fully qualified name.
+const maxParameterNameLength = 1011
+
+// checkParameterName rejects names SSM could never hold, so they answer 400
+// rather than looking like a missing parameter.
+func checkParameterName(name string) error {
+	switch {
+	case name == "":
+		return errors.New("parameter name is required")
+	case len(name) > maxParameterNameLength:
+		return fmt.Errorf("parameter name is over %d characters", maxParameterNameLength)
+	case !parameterNamePattern.MatchString(name):
+		return errors.New("parameter name may only contain letters, digits and _.-/")
+	case strings.Contains(name, "//") || strings.HasSuffix(name, "/"):
+		return errors.New("parameter name has an empty path segment")
+	}
+	return nil
+}
+
+// checkWritableParameterName is checkParameterName for writes, which can't
+// target a :version or :label selector.
+func checkWritableParameterName(name string) error {
+	if err := checkParameterName(name); err != nil {
+		return err
+	}
+	if strings.Contains(name, ":") {
+		return errors.New("parameter name may not carry a version or label selector")
+	}
+	return nil
+}
+
+// respondParameterReadError reports a failed single-parameter read: 404 for
+// a missing parameter, 400 for a name SSM rejects, 403 when access is denied,
+// 429 when throttled and 500 otherwise.
+func respondParameterReadError(c *gin.Context, err error) {
+	if respondThrottled(c, err) {
+		return
+	}
+	switch apiErrorCode(err) {
+	case "ParameterNotFound", "ParameterVersionNotFound":
+		respondAWSError(c, err, http.StatusNotFound, "not_found", "parameter not found")
+	case "ValidationException":
+		respondAWSError(c, err, http.StatusBadRequest, "bad_request", "ssm rejected the parameter name")
+	case "AccessDeniedException", "KMSAccessDeniedException":
+		respondAWSError(c, err, http.StatusForbidden, "access_denied", "access to parameter or its KMS key denied")
+	default:
+		respondAWSError(c, err, http.StatusInternalServerError, "internal", "ssm request failed")
+	}
+}
+
+// exactName serves h at /parameters/<name> and everything else with
+// fallback, for a fixed endpoint like /parameters/diff inside the catch-all.
+// A parameter with that name is read with ?literal=true.
+func exactName(name string, h, fallback gin.HandlerFunc) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if parameterName(c) == name && !literalPath(c) {
+			h(c)
+			return
+		}
+		fallback(c)
+	}
+}
+
+func parameterTagsHandler(cl *awsClients) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		name := parameterName(c)
+		if err := checkParameterName(name); err != nil {
+			respondError(c, http.StatusBadRequest, "bad_request", err.Error())
+			return
+		}
+		out, err := cl.ssmFor(c.Request.Context()).ListTagsForResource(c.Request.Context(), &ssm.ListTagsForResourceInput{
+			ResourceType: ssmtypes.ResourceTypeForTaggingParameter,
+			ResourceId:   aws.String(name),
+		})
+		if err != nil {
+			if apiErrorCode(err) == "InvalidResourceId" {
+				respondAWSError(c, err, http.StatusNotFound, "not_found", "parameter not found")
+				return
+			}
+			respondParameterReadError(c, err)
+			return
+		}
+
+		tags := make(map[string]string, len(out.TagList))
+		for _, t := range out.TagList {
+			tags[aws.ToString(t.Key)] = aws.ToString(t.Value)
+		}
+		respond(c, http.StatusOK, tags)
+	}
+}
+
+// defaultSSMKey is the AWS managed key SSM encrypts SecureString parameters
+// with when no KeyId was given.
+const defaultSSMKey = "alias/aws/ssm"
+
+type parameterEncryption struct {
+	Name       string `json:"name"`
+	Type       string `json:"type"`
+	Encrypted  bool   `json:"encrypted"`
+	KeyID      string `json:"keyId,omitempty"`
+	DefaultKey bool   `json:"defaultKey"`
+}
+
+// parameterEncryptionHandler reports which KMS key encrypts a SecureString
+// parameter, so owners can check it uses the intended CMK. Parameters without
+// a custom key report alias/aws/ssm with defaultKey set.
+func parameterEncryptionHandler(cl *awsClients) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		name := parameterName(c)
+		if err := checkParameterName(name); err != nil {
+			respondError(c, http.StatusBadRequest, "bad_request", err.Error())
+			return
+		}
+		out, err := cl.ssmFor(c.Request.Context()).DescribeParameters(c.Request.Context(), &ssm.DescribeParametersInput{
+			ParameterFilters: []ssmtypes.ParameterStringFilter{{
+				Key:    aws.String("Name"),
+				Option: aws.String("Equals"),
+				Values: []string{name},
+			}},
+		})
+		if err != nil {
+			respondParameterReadError(c, err)
+			return
+		}
+		if len(out.Parameters) == 0 {
+			respondError(c, http.StatusNotFound, "not_found", "parameter not found")
+			return
+		}
+
+		p := out.Parameters[0]
+		enc := parameterEncryption{Name: aws.ToString(p.Name), Type: string(p.Type)}
+		if p.Type == ssmtypes.ParameterTypeSecureString {
+			enc.Encrypted = true
+			enc.KeyID = aws.ToString(p.KeyId)
+			if enc.KeyID == "" || enc.KeyID == defaultSSMKey {
+				enc.KeyID, enc.DefaultKey = defaultSSMKey, true
+			}
+		}
+		respond(c, http.StatusOK, enc)
+	}
+}
+
+const sharedReadTimeout = 30 * time.Second
+
+// parameterReader collapses concurrent identical GetParameter calls into one,
+// so a burst of requests for the same parameter costs a single SSM call
+// instead of getting throttled.
+type parameterReader struct {
+	cl    *awsClients
+	group singleflight.Group
+}
+
+// readOptions selects how a parameter is read: wait retries a not-found
+// read per retry, decrypt returns SecureString values in plaintext.
+type readOptions struct {
+	wait    bool
+	decrypt bool
+	retry   readRetry
+}
+
+// get returns the parameter, sharing the call with concurrent readers of the
+// same name and options. The shared call is detached from any one
+// client's cancellation; each caller still stops waiting when its own
+// context ends.
+func (r *parameterReader) get(ctx context.Context, name string, opts readOptions) (*ssm.GetParameterOutput, error) {
+	key := requestRegion(ctx) + "\x00" + name + "\x00" + strconv.FormatBool(opts.wait) + "\x00" + strconv.FormatBool(opts.decrypt)
+	ch := r.group.DoChan(key, func() (any, error) {
+		shared, cancel := context.WithTimeout(context.WithoutCancel(ctx), sharedReadTimeout)
+		defer cancel()
+		input := &ssm.GetParameterInput{Name: aws.String(name), WithDecryption: aws.Bool(opts.decrypt)}
+		if opts.wait {
+			return getParameterWaiting(shared, r.cl, input, opts.retry)
+		}
+		return r.cl.ssmFor(shared).GetParameter(shared, input)
+	})
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case res := <-ch:
+		if res.Err != nil {
+			return nil, res.Err
+		}
+		return res.Val.(*ssm.GetParameterOutput), nil
+	}
+}
+
+// readRetry controls the read-after-write retries of ?wait=true reads.
+type readRetry struct {
+	attempts int
+	backoff  time.Duration
+}
+
+// getParameterWaiting retries GetParameter while SSM reports the parameter
+// missing, doubling the backoff each time, to ride out the eventual
+// consistency right after a PutParameter.
+func getParameterWaiting(ctx context.Context, cl *awsClients, input *ssm.GetParameterInput, retry readRetry) (*ssm.GetParameterOutput, error) {
+	backoff := retry.backoff
+	for attempt := 1; ; attempt++ {
+		out, err := cl.ssmFor(ctx).GetParameter(ctx, input)
+		var notFound *ssmtypes.ParameterNotFound
+		if err == nil || !errors.As(err, &notFound) || attempt >= retry.attempts {
+			return out, err
+		}
+		select {
+		case <-ctx.Done():
+			return nil, err
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+const (
+	maxStandardValueSize = 4 << 10
+	maxAdvancedValueSize = 8 << 10
+)
+
+// checkParameterValue validates value against the size limit of tier,
+// normalizing an empty tier to Standard. Intelligent-Tiering picks Advanced
+// for values too big for Standard, so it shares the Advanced limit.
+func checkParameterValue(value string, tier *string) error {
+	limit := maxStandardValueSize
+	switch ssmtypes.ParameterTier(*tier) {
+	case "":
+		*tier = string(ssmtypes.ParameterTierStandard)
+	case ssmtypes.ParameterTierStandard:
+	case ssmtypes.ParameterTierAdvanced, ssmtypes.ParameterTierIntelligentTiering:
+		limit = maxAdvancedValueSize
+	default:
+		return errors.New("tier must be Standard, Advanced or Intelligent-Tiering")
+	}
+	if len(value) > limit {
+		return fmt.Errorf("value is %d bytes, over the %d byte limit of the %s tier", len(value), limit, *tier)
+	}
+	return nil
+}
+
+// checkParameterType normalizes an empty type to String.
+func checkParameterType(typ *string) error {
+	switch ssmtypes.ParameterType(*typ) {
+	case "":
+		*typ = string(ssmtypes.ParameterTypeString)
+	case ssmtypes.ParameterTypeString, ssmtypes.ParameterTypeStringList, ssmtypes.ParameterTypeSecureString:
+	default:
+		return errors.New("type must be String, StringList or SecureString")
+	}
+	return nil
+}
+
+type putParameterRequest struct {
+	Value string `json:"value"`
+	Type  string `json:"type"` // String (default), StringList or SecureString
+	Tier  string `json:"tier"` // Standard (default), Advanced or Intelligent-Tiering
+	// Overwrite must be set to replace an existing parameter; without it
+	// a write to an existing name is refused with a 409.
+	Overwrite   bool   `json:"overwrite"`
+	Description string `json:"description"`
+	// KMSKeyID encrypts a SecureString with this key instead of the
+	// account's default SSM key.
+	KMSKeyID string `json:"kmsKeyId"`
+}
+
+type putParameterResult struct {
+	Name    string `json:"name"`
+	Version int64  `json:"version"`
+	Tier    string `json:"tier"`
+}
+
+// putParameterHandler creates or overwrites a parameter, checking the name,
+// type and value against SSM's limits up front rather than surfacing its
+// opaque ValidationException.
+func putParameterHandler(cl *awsClients) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		name := parameterName(c)
+		if err := checkWritableParameterName(name); err != nil {
+			respondError(c, http.StatusBadRequest, "bad_request", err.Error())
+			return
+		}
+		var req putParameterRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			respondError(c, http.StatusBadRequest, "bad_request",
+				`body must be {"value": "...", "type": "...", "tier": "...", "overwrite": bool, "description": "...", "kmsKeyId": "..."}`)
+			return
+		}
+		if req.Value == "" {
+			respondError(c, http.StatusBadRequest, "bad_request", "value is required")
+			return
+		}
+		if err := checkParameterType(&req.Type); err != nil {
+			respondError(c, http.StatusBadRequest, "bad_request", err.Error())
+			return
+		}
+		if req.KMSKeyID != "" && ssmtypes.ParameterType(req.Type) != ssmtypes.ParameterTypeSecureString {
+			respondError(c, http.StatusBadRequest, "bad_request", "kmsKeyId only applies to SecureString parameters")
+			return
+		}
+		if err := checkParameterValue(req.Value, &req.Tier); err != nil {
+			respondError(c, http.StatusBadRequest, "bad_request", err.Error())
+			return
+		}
+		input := &ssm.PutParameterInput{
+			Name:      aws.String(name),
+			Value:     aws.String(req.Value),
+			Type:      ssmtypes.ParameterType(req.Type),
+			Tier:      ssmtypes.ParameterTier(req.Tier),
+			Overwrite: aws.Bool(req.Overwrite),
+		}
+		if req.Description != "" {
+			input.Description = aws.String(req.Description)
+		}
+		if req.KMSKeyID != "" {
+			input.KeyId = aws.String(req.KMSKeyID)
+		}
+		out, err := cl.ssmFor(c.Request.Context()).PutParameter(c.Request.Context(), input)
+		if err != nil {
+			respondParameterWriteError(c, err)
+			return
+		}
+		respond(c, http.StatusOK, putParameterResult{Name: name, Version: out.Version, Tier: string(out.Tier)})
+	}
+}
+
+type deleteParameterResult struct {
+	Name    string `json:"name"`
+	Deleted bool   `json:"deleted"`
+}
+
+// deleteParameterHandler deletes a parameter with all of its versions. A
+// missing parameter answers 404.
+func deleteParameterHandler(cl *awsClients) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		name := parameterName(c)
+		if err := checkWritableParameterName(name); err != nil {
+			respondError(c, http.StatusBadRequest, "bad_request", err.Error())
+			return
+		}
+		ctx := c.Request.Context()
+		if _, err := cl.ssmFor(ctx).DeleteParameter(ctx, &ssm.DeleteParameterInput{Name: aws.String(name)}); err != nil {
+			respondParameterWriteError(c, err)
+			return
+		}
+		respond(c, http.StatusOK, deleteParameterResult{Name: name, Deleted: true})
+	}
+}
+
+// respondParameterWriteError reports a failed single-parameter write with
+// the status matching parameterItemError's code.
+func respondParameterWriteError(c *gin.Context, err error) {
+	e := parameterItemError(err)
+	status := http.StatusInternalServerError
+	switch e.Code {
+	case "bad_request":
+		status = http.StatusBadRequest
+	case "not_found":
+		status = http.StatusNotFound
+	case "conflict":
+		status = http.StatusConflict
+	case "access_denied":
+		status = http.StatusForbidden
+	case "throttled":
+		status = http.StatusTooManyRequests
+		c.Header("Retry-After", "1")
+	}
+	respondAWSError(c, err, status, e.Code, e.Message)
+}
+
+const (
+	maxBatchGetNames = 100
+	// batchGetConcurrency bounds the GetParameters calls of one batch get.
+	batchGetConcurrency = 4
+)
+
+type batchGetRequest struct {
+	Names   []string `json:"names" binding:"required"`
+	Decrypt bool     `json:"decrypt"`
+}
+
+type batchGetResult struct {
+	Parameters map[string]pathParameter `json:"parameters"`
+	// Invalid lists the names SSM reported as missing.
+	Invalid []string `json:"invalid"`
+}
+
+// batchGetParametersHandler reads up to 100 parameters in one request, ten
+// per GetParameters call with a few calls in flight, for services loading
+// their config at boot. Missing names are listed in invalid rather than
+// failing the batch; decrypt is gated like single reads.
+func batchGetParametersHandler(cl *awsClients, decryptEnabled bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req batchGetRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			respondError(c, http.StatusBadRequest, "bad_request", `body must be {"names": ["..."], "decrypt": bool}`)
+			return
+		}
+		if len(req.Names) == 0 || len(req.Names) > maxBatchGetNames {
+			respondError(c, http.StatusBadRequest, "bad_request",
+				fmt.Sprintf("names must hold between 1 and %d entries", maxBatchGetNames))
+			return
+		}
+		names := slices.Compact(slices.Sorted(slices.Values(req.Names)))
+		setAuditParameters(c, names)
+		for _, name := range names {
+			if err := checkParameterName(name); err != nil {
+				respondError(c, http.StatusBadRequest, "bad_request", fmt.Sprintf("%q: %v", name, err))
+				return
+			}
+		}
+		if req.Decrypt && !allowDecrypt(c, decryptEnabled) {
+			return
+		}
+
+		outs := make([]*ssm.GetParametersOutput, (len(names)+9)/10)
+		g, ctx := errgroup.WithContext(c.Request.Context())
+		g.SetLimit(batchGetConcurrency)
+		for i := range outs {
+			chunk := names[i*10 : min(i*10+10, len(names))]
+			g.Go(func() error {
+				out, err := cl.ssmFor(ctx).GetParameters(ctx, &ssm.GetParametersInput{
+					Names:          chunk,
+					WithDecryption: aws.Bool(req.Decrypt),
+				})
+				outs[i] = out
+				return err
+			})
+		}
+		if err := g.Wait(); err != nil {
+			respondParameterReadError(c, err)
+			return
+		}
+
+		result := batchGetResult{Parameters: map[string]pathParameter{}, Invalid: []string{}}
+		for _, out := range outs {
+			for _, p := range out.Parameters {
+				result.Parameters[aws.ToString(p.Name)] = pathParameter{Value: aws.ToString(p.Value), Type: string(p.Type), Version: p.Version}
+			}
+			result.Invalid = append(result.Invalid, out.InvalidParameters...)
+		}
+		respond(c, http.StatusOK, result)
+	}
+}
+
+const maxBatchSetItems = 100
+
+type batchSetItem struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+	Type  string `json:"type"` // String (default), StringList or SecureString
+	Tier  string `json:"tier"` // Standard (default), Advanced or Intelligent-Tiering
+}
+
+type batchSetRequest struct {
+	Items        []batchSetItem `json:"items" binding:"required"`
+	AllOrNothing bool           `json:"allOrNothing"`
+}
+
+// batchSetResult reports one item. Status is "written", "failed", "skipped"
+// (not attempted after an earlier failure), "rolledBack" or "rollbackFailed".
+type batchSetResult struct {
+	Name    string    `json:"name"`
+	Status  string    `json:"status"`
+	Version int64     `json:"version,omitempty"`
+	Error   *apiError `json:"error,omitempty"`
+}
+
+// priorParameter is a parameter's state before the batch touched it; a nil
+// entry means it did not exist.
+type priorParameter struct {
+	value string
+	typ   ssmtypes.ParameterType
+}
+
+func validateBatchSet(items []batchSetItem) error {
+	if len(items) == 0 || len(items) > maxBatchSetItems {
+		return fmt.Errorf("items must hold between 1 and %d entries", maxBatchSetItems)
+	}
+	seen := make(map[string]bool, len(items))
+	for i := range items {
+		it := &items[i]
+		if it.Name == "" || it.Value == "" {
+			return fmt.Errorf("item %d: name and value are required", i)
+		}
+		if err := checkWritableParameterName(it.Name); err != nil {
+			return fmt.Errorf("item %d: %w", i, err)
+		}
+		if seen[it.Name] {
+			return fmt.Errorf("item %d: duplicate name %q", i, it.Name)
+		}
+		seen[it.Name] = true
+		if err := checkParameterType(&it.Type); err != nil {
+			return fmt.Errorf("item %d: %w", i, err)
+		}
+		if err := checkParameterValue(it.Value, &it.Tier); err != nil {
+			return fmt.Errorf("item %d: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// priorParameters fetches the current value and type of each named
+// parameter, ten at a time as GetParameters allows.
+func priorParameters(ctx context.Context, cl *awsClients, names []string) (map[string]*priorParameter, error) {
+	prior := make(map[string]*priorParameter, len(names))
+	for start := 0; start < len(names); start += 10 {
+		chunk := names[start:min(start+10, len(names))]
+		out, err := cl.ssmFor(ctx).GetParameters(ctx, &ssm.GetParametersInput{
+			Names:          chunk,
+			WithDecryption: aws.Bool(true),
+		})
+		if err != nil {
+			return nil, err
+		}
+		for _, name := range chunk {
+			prior[name] = nil
+		}
+		for _, p := range out.Parameters {
+			prior[aws.ToString(p.Name)] = &priorParameter{value: aws.ToString(p.Value), typ: p.Type}
+		}
+	}
+	return prior, nil
+}
+
+func parameterItemError(err error) *apiError {
+	if isThrottled(err) {
+		return &apiError{Code: "throttled", Message: "ssm rejected the write, retry later"}
+	}
+	switch apiErrorCode(err) {
+	case "ParameterLimitExceeded":
+		return &apiError{Code: "throttled", Message: "ssm rejected the write, retry later"}
+	case "ValidationException", "ParameterPatternMismatchException", "UnsupportedParameterType", "HierarchyTypeMismatchException":
+		return &apiError{Code: "bad_request", Message: "ssm rejected the parameter"}
+	case "ParameterAlreadyExists":
+		return &apiError{Code: "conflict", Message: "parameter already exists and overwrite is false"}
+	case "ParameterNotFound":
+		return &apiError{Code: "not_found", Message: "parameter not found"}
+	case "AccessDeniedException":
+		return &apiError{Code: "access_denied", Message: "access to parameter denied"}
+	}
+	return &apiError{Code: "internal", Message: "ssm request failed"}
+}
+
+// batchSetParametersHandler writes many parameters in one call. Every item
+// is validated before anything is written. With allOrNothing the prior
+// values are read first and, if any put fails, the items already written are
+// rolled back: new parameters are deleted and overwritten ones get their
+// previous value and type back. SSM has no transactions, so this is best
+// effort: readers can observe the intermediate state, a rollback can itself
+// fail (reported as rollbackFailed), restored parameters get a new version,
+// and only the value and type are restored, not description, tier or
+// policies. The response is 200 when every item was written and 207 with
+// per-item results otherwise.
+func batchSetParametersHandler(cl *awsClients) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req batchSetRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			respondError(c, http.StatusBadRequest, "bad_request", `body must be {"items": [{"name", "value", "type"}], "allOrNothing": bool}`)
+			return
+		}
+		if err := validateBatchSet(req.Items); err != nil {
+			respondError(c, http.StatusBadRequest, "bad_request", err.Error())
+			return
+		}
+		ctx := c.Request.Context()
+		logger := loggerFrom(ctx)
+
+		var prior map[string]*priorParameter
+		if req.AllOrNothing {
+			names := make([]string, len(req.Items))
+			for i, it := range req.Items {
+				names[i] = it.Name
+			}
+			var err error
+			if prior, err = priorParameters(ctx, cl, names); err != nil {
+				respondAWSError(c, err, http.StatusInternalServerError, "internal", "failed to read current parameter values")
+				return
+			}
+		}
+
+		results := make([]batchSetResult, len(req.Items))
+		failed := -1
+		for i, it := range req.Items {
+			results[i].Name = it.Name
+			if failed >= 0 {
+				results[i].Status = "skipped"
+				continue
+			}
+			out, err := cl.ssmFor(ctx).PutParameter(ctx, &ssm.PutParameterInput{
+				Name:      aws.String(it.Name),
+				Value:     aws.String(it.Value),
+				Type:      ssmtypes.ParameterType(it.Type),
+				Tier:      ssmtypes.ParameterTier(it.Tier),
+				Overwrite: aws.Bool(true),
+			})
+			if err != nil {
+				logger.Warn("batch set: put failed", "name", it.Name, "err", err)
+				results[i].Status = "failed"
+				results[i].Error = parameterItemError(err)
+				if req.AllOrNothing {
+					failed = i
+				}
+				continue
+			}
+			results[i].Status = "written"
+			results[i].Version = out.Version
+		}
+
+		if failed >= 0 {
+			for i := failed - 1; i >= 0; i-- {
+				name := req.Items[i].Name
+				var err error
+				if p := prior[name]; p != nil {
+					_, err = cl.ssmFor(ctx).PutParameter(ctx, &ssm.PutParameterInput{
+						Name:      aws.String(name),
+						Value:     aws.String(p.value),
+						Type:      p.typ,
+						Overwrite: aws.Bool(true),
+					})
+				} else {
+					_, err = cl.ssmFor(ctx).DeleteParameter(ctx, &ssm.DeleteParameterInput{Name: aws.String(name)})
+				}
+				if err != nil {
+					logger.Error("batch set: rollback failed", "name", name, "err", err)
+					results[i].Status = "rollbackFailed"
+					results[i].Error = parameterItemError(err)
+					continue
+				}
+				results[i].Status = "rolledBack"
+				results[i].Version = 0
+			}
+		}
+
+		status := http.StatusOK
+		for _, r := range results {
+			if r.Status != "written" {
+				status = http.StatusMultiStatus
+				break
+			}
+		}
+		respond(c, status, results)
+	}
+}
+
+// parameterListLimit is listLimit for the parameter listing, which also
+// takes SSM's own ?max_results=, held to the 1 to 50 SSM allows.
+func parameterListLimit(c *gin.Context, max int) (int, error) {
+	v := c.Query("max_results")
+	if v == "" {
+		return listLimit(c, max)
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 1 || n > maxDescribeParametersResults {
+		return 0, fmt.Errorf("max_results must be an integer between 1 and %d", maxDescribeParametersResults)
+	}
+	if max > 0 && n > max {
+		return max, nil
+	}
+	return n, nil
+}
+
+// listParametersHandler lists parameter names, following DescribeParameters
+// pages up to MAX_RESPONSE_ITEMS, ?max_results= or ?limit=; ?next_token= (or
+// ?nextToken=) resumes a truncated listing and an unusable token is a 400.
+// ?path=, ?prefix=, ?type= and ?tag= filter the listing, echoed back in
+// filters, and ?stripPrefix= returns names relative to a prefix all of them
+// must share. ?verbose=true returns each parameter's metadata instead of
+// just its name. Listings are cached like single reads, keyed by region and
+// query.
+func listParametersHandler(cl *awsClients, live *liveConfig, cache *parameterCache) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		settings := live.get()
+		filters, applied, err := parameterListFilters(c)
+		if err != nil {
+			respondError(c, http.StatusBadRequest, "bad_request", err.Error())
+			return
+		}
+		limit, err := parameterListLimit(c, settings.MaxResponseItems)
+		if err != nil {
+			respondError(c, http.StatusBadRequest, "bad_request", err.Error())
+			return
+		}
+		setListFilters(c, applied)
+		key := parameterListingKey(requestRegion(c.Request.Context()), "list", c.Request.URL.Query())
+		entry, hit := parameterListingEntry{}, false
+		if c.Query("nocache") != "true" {
+			entry, hit = cache.getListing(key)
+		}
+		metadata, page := []ssmtypes.ParameterMetadata(nil), entry.page
+		if hit {
+			metadata = entry.data.([]ssmtypes.ParameterMetadata)
+		} else {
+			token := cmp.Or(c.Query("next_token"), c.Query("nextToken"))
+			if metadata, page, err = describeParameters(c.Request.Context(), cl, filters, limit, token); err != nil {
+				respondParameterListError(c, err)
+				return
+			}
+			cache.putListing(key, metadata, page)
+		}
+		cache.setHeaders(c, hit, entry.fetched)
+		setListPage(c, page)
+		names := make([]string, len(metadata))
+		for i, p := range metadata {
+			names[i] = aws.ToString(p.Name)
+		}
+		if prefix := c.Query("stripPrefix"); prefix != "" {
+			if names, err = stripNamePrefix(names, prefix); err != nil {
+				respondError(c, http.StatusBadRequest, "bad_request", err.Error())
+				return
+			}
+		}
+		if respondEmptyListing(c, len(names), "parameters") {
+			return
+		}
+		if c.Query("verbose") == "true" {
+			respondCacheable(c, settings.ListingMaxAge, "", parameterSummaries(metadata, names))
+			return
+		}
+		respondCacheable(c, settings.ListingMaxAge, "", names)
+	}
+}
+
+// getParameterHandler reads a single parameter. ?wait=true retries a
+// not-found read a few times for clients reading right after a write; it is
+// opt-in so genuine misses stay fast. The current version is returned in
+// X-Parameter-Version and its type in X-Parameter-Type, and a matching
+// If-Version header yields an empty 304 so pollers can cheaply detect
+// changes. Concurrent reads of the same parameter share one SSM call, and
+// with PARAMETER_CACHE_TTL set reads are served from cache (X-Cache, Age)
+// unless ?nocache=true. ?render=true treats the value as a text/template
+// that can pull in other parameters with {{param "/name"}}, applied before
+// ?parse=. ?decrypt=true returns SecureString values in plaintext and needs
+// a key with the decrypt scope on a service that allows decryption.
+// ?interpolate=true then fills ${NAME} placeholders from vars, failing on
+// unknown ones with ?strict=true.
+func getParameterHandler(cl *awsClients, live *liveConfig, cache *parameterCache, decryptEnabled bool, vars map[string]string) gin.HandlerFunc {
+	reads := &parameterReader{cl: cl}
+	return func(c *gin.Context) {
+		settings := live.get()
+		name := parameterName(c)
+		kind := c.Query("parse")
+		switch kind {
+		case "", "json", "int", "bool":
+		default:
+			respondError(c, http.StatusBadRequest, "bad_request", "parse must be json, int or bool")
+			return
+		}
+		if err := checkParameterName(name); err != nil {
+			respondError(c, http.StatusBadRequest, "bad_request", err.Error())
+			return
+		}
+		decrypt := c.Query("decrypt") == "true"
+		if decrypt && !allowDecrypt(c, decryptEnabled) {
+			return
+		}
+		key := parameterCacheKey(requestRegion(c.Request.Context()), name, decrypt)
+		entry, hit := parameterCacheEntry{}, false
+		if c.Query("nocache") != "true" {
+			entry, hit = cache.get(key)
+		}
+		var err error
+		out := entry.out
+		if !hit {
+			out, err = reads.get(c.Request.Context(), name, readOptions{
+				wait:    c.Query("wait") == "true",
+				decrypt: decrypt,
+				retry:   settings.readRetry(),
+			})
+			if err != nil {
+				respondParameterReadError(c, err)
+				return
+			}
+			cache.put(key, out)
+		}
+		cache.setHeaders(c, hit, entry.fetched)
+		render := c.Query("render") == "true"
+		version := strconv.FormatInt(out.Parameter.Version, 10)
+		c.Header(parameterVersionHeader, version)
+		c.Header(parameterTypeHeader, string(out.Parameter.Type))
+		// a rendered value also depends on the referenced parameters, whose
+		// changes the version doesn't reflect
+		if !render && c.GetHeader(ifVersionHeader) == version {
+			c.Status(http.StatusNotModified)
+			return
+		}
+		value := aws.ToString(out.Parameter.Value)
+		if render {
+			var resolved []string
+			value, err = renderParameter(c.Request.Context(), reads, value, decrypt, []string{name}, &resolved)
+			if len(resolved) > 0 {
+				setAuditParameters(c, resolved)
+			}
+			if err != nil {
+				respondError(c, http.StatusUnprocessableEntity, "unprocessable", "template error: "+err.Error())
+				return
+			}
+		}
+		if c.Query("interpolate") == "true" {
+			if value, err = interpolateParameter(value, vars, c.Query("strict") == "true"); err != nil {
+				respondError(c, http.StatusUnprocessableEntity, "unprocessable", err.Error())
+				return
+			}
+		}
+		var data any = value
+		if kind != "" {
+			if data, err = parseParameterValue(value, kind); err != nil {
+				respondError(c, http.StatusUnprocessableEntity, "unprocessable", err.Error())
+				return
+			}
+		}
+		etag := weakETag(name, version, value, kind)
+		respondCacheable(c, settings.ParameterMaxAge, etag, data)
+	}
+}
+
+// parseParameterValue converts a raw SSM string value into the native JSON
+// type requested with ?parse=, so clients don't have to decode it twice.
+// JSON numbers are kept as written rather than going through float64, so
+// large IDs and precise decimals survive.
+func parseParameterValue(value, kind string) (any, error) {
+	switch kind {
+	case "json":
+		dec := json.NewDecoder(strings.NewReader(value))
+		dec.UseNumber()
+		var v any
+		if err := dec.Decode(&v); err != nil {
+			return nil, fmt.Errorf("value is not valid JSON: %w", err)
+		}
+		if _, err := dec.Token(); err != io.EOF {
+			return nil, errors.New("value is not valid JSON: trailing data after the top-level value")
+		}
+		return v, nil
+	case "int":
+		v, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("value is not an integer: %q", value)
+		}
+		return v, nil
+	case "bool":
+		v, err := strconv.ParseBool(strings.TrimSpace(value))
+		if err != nil {
+			return nil, fmt.Errorf("value is not a boolean: %q", value)
+		}
+		return v, nil
+	default:
+		return nil, fmt.Errorf("unsupported parse type %q, want json, int or bool", kind)
+	}
+}
@@ -0,0 +1,880 @@
+package handlers
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	ssmtypes "github.com/aws/aws-sdk-go-v2/service/ssm/types"
+)
+
+// parameterStore is a fakeSSM over a fixed set of String parameters.
+func parameterStore(values map[string]string) *fakeSSM {
+	return &fakeSSM{getParameter: func(_ context.Context, in *ssm.GetParameterInput) (*ssm.GetParameterOutput, error) {
+		value, ok := values[aws.ToString(in.Name)]
+		if !ok {
+			return nil, &ssmtypes.ParameterNotFound{Message: aws.String("not found")}
+		}
+		return &ssm.GetParameterOutput{Parameter: &ssmtypes.Parameter{
+			Name:    in.Name,
+			Value:   aws.String(value),
+			Type:    ssmtypes.ParameterTypeString,
+			Version: 1,
+		}}, nil
+	}}
+}
+
+func TestListParametersHandler(t *testing.T) {
+	tests := []struct {
+		name   string
+		page   []ssmtypes.ParameterMetadata
+		err    error
+		want   []string
+		status int
+		code   string
+	}{
+		{
+			name: "names",
+			page: []ssmtypes.ParameterMetadata{{Name: aws.String("/a")}, {Name: aws.String("/b")}},
+			want: []string{"/a", "/b"},
+		},
+		{
+			name: "nil name",
+			page: []ssmtypes.ParameterMetadata{{Name: nil}, {Name: aws.String("/b")}},
+			want: []string{"", "/b"},
+		},
+		{name: "empty", want: []string{}},
+		{name: "bad token", err: awsError("InvalidNextToken"), status: http.StatusBadRequest, code: "bad_request"},
+		{name: "throttled", err: awsError("ThrottlingException"), status: http.StatusTooManyRequests, code: "throttled"},
+		{name: "other failure", err: errors.New("connection reset"), status: http.StatusInternalServerError, code: "internal"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := &fakeSSM{describeParameters: func(context.Context, *ssm.DescribeParametersInput) (*ssm.DescribeParametersOutput, error) {
+				if tt.err != nil {
+					return nil, tt.err
+				}
+				return &ssm.DescribeParametersOutput{Parameters: tt.page}, nil
+			}}
+			s := newTestServer(t, testConfig(t), testClients(&fakeS3{}, fake))
+
+			w := s.do(t, http.MethodGet, "/parameters", "")
+			if tt.status != 0 {
+				wantError(t, w, tt.status, tt.code)
+				return
+			}
+			var got []string
+			decodeData(t, w, &got)
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("names = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestListParametersFilters(t *testing.T) {
+	tests := []struct {
+		name    string
+		query   string
+		filters []ssmtypes.ParameterStringFilter
+		applied map[string][]string
+		token   string
+		code    string
+	}{
+		{name: "none", query: ""},
+		{
+			name:  "prefix",
+			query: "?prefix=/team-a/",
+			filters: []ssmtypes.ParameterStringFilter{
+				{Key: aws.String("Name"), Option: aws.String("BeginsWith"), Values: []string{"/team-a/"}},
+			},
+			applied: map[string][]string{"prefix": {"/team-a/"}},
+		},
+		{
+			name:  "type",
+			query: "?type=SecureString",
+			filters: []ssmtypes.ParameterStringFilter{
+				{Key: aws.String("Type"), Option: aws.String("Equals"), Values: []string{"SecureString"}},
+			},
+			applied: map[string][]string{"type": {"SecureString"}},
+		},
+		{
+			name:  "tags",
+			query: "?tag=team:a&tag=env:prod&tag=owner",
+			filters: []ssmtypes.ParameterStringFilter{
+				{Key: aws.String("tag:team"), Values: []string{"a"}},
+				{Key: aws.String("tag:env"), Values: []string{"prod"}},
+				{Key: aws.String("tag-key"), Values: []string{"owner"}},
+			},
+			applied: map[string][]string{"tag": {"team:a", "env:prod", "owner"}},
+		},
+		{
+			name:  "combined",
+			query: "?path=/team-a&prefix=/team-a/db&type=String&tag=env:prod",
+			filters: []ssmtypes.ParameterStringFilter{
+				{Key: aws.String("tag:env"), Values: []string{"prod"}},
+				{Key: aws.String("Path"), Option: aws.String("Recursive"), Values: []string{"/team-a"}},
+				{Key: aws.String("Name"), Option: aws.String("BeginsWith"), Values: []string{"/team-a/db"}},
+				{Key: aws.String("Type"), Option: aws.String("Equals"), Values: []string{"String"}},
+			},
+			applied: map[string][]string{
+				"path": {"/team-a"}, "prefix": {"/team-a/db"}, "type": {"String"}, "tag": {"env:prod"},
+			},
+		},
+		{
+			name:  "with next token",
+			query: "?type=StringList&next_token=page-2",
+			filters: []ssmtypes.ParameterStringFilter{
+				{Key: aws.String("Type"), Option: aws.String("Equals"), Values: []string{"StringList"}},
+			},
+			applied: map[string][]string{"type": {"StringList"}},
+			token:   "page-2",
+		},
+		{name: "unknown type", query: "?type=Binary", code: "type filter"},
+		{name: "empty tag value", query: "?tag=env:", code: "tag filter"},
+		{name: "empty tag key", query: "?tag=:prod", code: "tag filter"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// the input is reused across pages, so keep what each call saw
+			var inputs []ssm.DescribeParametersInput
+			fake := &fakeSSM{describeParameters: func(_ context.Context, in *ssm.DescribeParametersInput) (*ssm.DescribeParametersOutput, error) {
+				inputs = append(inputs, *in)
+				if len(inputs) == 1 {
+					return &ssm.DescribeParametersOutput{
+						Parameters: []ssmtypes.ParameterMetadata{{Name: aws.String("/team-a/db")}},
+						NextToken:  aws.String("more"),
+					}, nil
+				}
+				return &ssm.DescribeParametersOutput{Parameters: []ssmtypes.ParameterMetadata{{Name: aws.String("/team-a/cache")}}}, nil
+			}}
+			s := newTestServer(t, testConfig(t), testClients(&fakeS3{}, fake))
+
+			w := s.do(t, http.MethodGet, "/parameters"+tt.query, "")
+			if tt.code != "" {
+				wantError(t, w, http.StatusBadRequest, "bad_request")
+				if env := decodeEnvelope(t, w); !strings.Contains(env.Error.Message, tt.code) {
+					t.Errorf("message = %q, want it to name the %s", env.Error.Message, tt.code)
+				}
+				if len(inputs) != 0 {
+					t.Errorf("DescribeParameters called %d times for a rejected filter", len(inputs))
+				}
+				return
+			}
+			var names []string
+			env := decodeData(t, w, &names)
+			if len(inputs) != 2 {
+				t.Fatalf("DescribeParameters calls = %d, want 2", len(inputs))
+			}
+			for i, in := range inputs {
+				if !reflect.DeepEqual(in.ParameterFilters, tt.filters) {
+					t.Errorf("page %d filters = %s, want %s", i, describeFilters(in.ParameterFilters), describeFilters(tt.filters))
+				}
+			}
+			if got := aws.ToString(inputs[0].NextToken); got != tt.token {
+				t.Errorf("first NextToken = %q, want %q", got, tt.token)
+			}
+			if got := aws.ToString(inputs[1].NextToken); got != "more" {
+				t.Errorf("second NextToken = %q, want more", got)
+			}
+			if !reflect.DeepEqual(env.Filters, tt.applied) {
+				t.Errorf("echoed filters = %v, want %v", env.Filters, tt.applied)
+			}
+		})
+	}
+}
+
+// describeFilters renders filters readably for failure messages.
+func describeFilters(filters []ssmtypes.ParameterStringFilter) string {
+	parts := make([]string, len(filters))
+	for i, f := range filters {
+		parts[i] = fmt.Sprintf("{%s %s %q}", aws.ToString(f.Key), aws.ToString(f.Option), f.Values)
+	}
+	return "[" + strings.Join(parts, " ") + "]"
+}
+
+func TestGetParameterHandler(t *testing.T) {
+	tests := []struct {
+		name   string
+		out    *ssm.GetParameterOutput
+		err    error
+		want   string
+		status int
+		code   string
+	}{
+		{
+			name: "value",
+			out: &ssm.GetParameterOutput{Parameter: &ssmtypes.Parameter{
+				Name: aws.String("/app/db"), Value: aws.String("secret"), Type: ssmtypes.ParameterTypeString, Version: 7,
+			}},
+			want: "secret",
+		},
+		{
+			name: "nil value",
+			out:  &ssm.GetParameterOutput{Parameter: &ssmtypes.Parameter{Name: aws.String("/app/db"), Version: 7}},
+			want: "",
+		},
+		{name: "not found", err: &ssmtypes.ParameterNotFound{}, status: http.StatusNotFound, code: "not_found"},
+		{name: "access denied", err: awsError("AccessDeniedException"), status: http.StatusForbidden, code: "access_denied"},
+		{name: "throttled", err: awsError("ThrottlingException"), status: http.StatusTooManyRequests, code: "throttled"},
+		{name: "other failure", err: errors.New("connection reset"), status: http.StatusInternalServerError, code: "internal"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := &fakeSSM{getParameter: func(_ context.Context, in *ssm.GetParameterInput) (*ssm.GetParameterOutput, error) {
+				if name := aws.ToString(in.Name); name != "/app/db" {
+					t.Errorf("GetParameter name = %q, want /app/db", name)
+				}
+				return tt.out, tt.err
+			}}
+			s := newTestServer(t, testConfig(t), testClients(&fakeS3{}, fake))
+
+			w := s.do(t, http.MethodGet, "/parameters/app/db", "")
+			if tt.status != 0 {
+				wantError(t, w, tt.status, tt.code)
+				return
+			}
+			var got string
+			decodeData(t, w, &got)
+			if got != tt.want {
+				t.Errorf("value = %q, want %q", got, tt.want)
+			}
+			if v := w.Header().Get(parameterVersionHeader); v != "7" {
+				t.Errorf("%s = %q, want 7", parameterVersionHeader, v)
+			}
+		})
+	}
+}
+
+func TestParameterWritesNeedEnableWrites(t *testing.T) {
+	fake := &fakeSSM{}
+	s := newTestServer(t, testConfig(t), testClients(&fakeS3{}, fake))
+
+	for _, method := range []string{http.MethodPut, http.MethodDelete} {
+		w := s.do(t, method, "/parameters/app/db", `{"value": "v"}`, apiKeyHeader, testAdminKey)
+		if w.Code != http.StatusNotFound && w.Code != http.StatusMethodNotAllowed {
+			t.Errorf("%s with writes disabled: status = %d, want 404 or 405", method, w.Code)
+		}
+	}
+	if n := fake.count("PutParameter") + fake.count("DeleteParameter"); n != 0 {
+		t.Errorf("SSM write calls = %d, want 0", n)
+	}
+}
+
+func TestPutParameterHandler(t *testing.T) {
+	tests := []struct {
+		name   string
+		body   string
+		target string
+		header []string
+		err    error
+		want   *ssm.PutParameterInput
+		status int
+		code   string
+	}{
+		{
+			name: "defaults",
+			body: `{"value": "v"}`,
+			want: &ssm.PutParameterInput{
+				Name: aws.String("/app/db"), Value: aws.String("v"), Overwrite: aws.Bool(false),
+				Type: ssmtypes.ParameterTypeString, Tier: ssmtypes.ParameterTierStandard,
+			},
+		},
+		{
+			name: "overwrite",
+			body: `{"value": "v", "type": "SecureString", "tier": "Advanced", "overwrite": true, "kmsKeyId": "alias/app"}`,
+			want: &ssm.PutParameterInput{
+				Name: aws.String("/app/db"), Value: aws.String("v"), Overwrite: aws.Bool(true), KeyId: aws.String("alias/app"),
+				Type: ssmtypes.ParameterTypeSecureString, Tier: ssmtypes.ParameterTierAdvanced,
+			},
+		},
+		{name: "no admin key", body: `{"value": "v"}`, header: []string{}, status: http.StatusUnauthorized, code: "unauthorized"},
+		{name: "selector in name", target: "/parameters/app/db:3", body: `{"value": "v"}`, status: http.StatusBadRequest, code: "bad_request"},
+		{name: "no value", body: `{}`, status: http.StatusBadRequest, code: "bad_request"},
+		{name: "bad type", body: `{"value": "v", "type": "Binary"}`, status: http.StatusBadRequest, code: "bad_request"},
+		{name: "kms key on string", body: `{"value": "v", "kmsKeyId": "alias/app"}`, status: http.StatusBadRequest, code: "bad_request"},
+		{name: "bad tier", body: `{"value": "v", "tier": "Gold"}`, status: http.StatusBadRequest, code: "bad_request"},
+		{name: "value over standard limit", body: `{"value": "` + strings.Repeat("x", maxStandardValueSize+1) + `"}`, status: http.StatusBadRequest, code: "bad_request"},
+		{name: "exists", body: `{"value": "v"}`, err: &ssmtypes.ParameterAlreadyExists{}, status: http.StatusConflict, code: "conflict"},
+		{name: "rejected", body: `{"value": "v"}`, err: awsError("ValidationException"), status: http.StatusBadRequest, code: "bad_request"},
+		{name: "access denied", body: `{"value": "v"}`, err: awsError("AccessDeniedException"), status: http.StatusForbidden, code: "access_denied"},
+		{name: "throttled", body: `{"value": "v"}`, err: awsError("ThrottlingException"), status: http.StatusTooManyRequests, code: "throttled"},
+		{name: "limit exceeded", body: `{"value": "v"}`, err: awsError("ParameterLimitExceeded"), status: http.StatusTooManyRequests, code: "throttled"},
+		{name: "other failure", body: `{"value": "v"}`, err: errors.New("connection reset"), status: http.StatusInternalServerError, code: "internal"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got *ssm.PutParameterInput
+			fake := &fakeSSM{putParameter: func(_ context.Context, in *ssm.PutParameterInput) (*ssm.PutParameterOutput, error) {
+				got = in
+				if tt.err != nil {
+					return nil, tt.err
+				}
+				return &ssm.PutParameterOutput{Version: 2, Tier: in.Tier}, nil
+			}}
+			cfg := testConfig(t)
+			cfg.EnableWrites = true
+			s := newTestServer(t, cfg, testClients(&fakeS3{}, fake))
+
+			target, header := cmp.Or(tt.target, "/parameters/app/db"), tt.header
+			if header == nil {
+				header = []string{apiKeyHeader, testAdminKey}
+			}
+			w := s.do(t, http.MethodPut, target, tt.body, header...)
+			if tt.status != 0 {
+				wantError(t, w, tt.status, tt.code)
+				if tt.err == nil && got != nil {
+					t.Errorf("PutParameter called for a rejected request")
+				}
+				return
+			}
+			var res putParameterResult
+			decodeData(t, w, &res)
+			if res.Name != "/app/db" || res.Version != 2 {
+				t.Errorf("result = %+v", res)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("PutParameter input = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDeleteParameterHandler(t *testing.T) {
+	tests := []struct {
+		name   string
+		target string
+		err    error
+		status int
+		code   string
+	}{
+		{name: "deleted", target: "/parameters/app/db"},
+		{name: "missing", target: "/parameters/app/db", err: &ssmtypes.ParameterNotFound{}, status: http.StatusNotFound, code: "not_found"},
+		{name: "selector in name", target: "/parameters/app/db:prod", status: http.StatusBadRequest, code: "bad_request"},
+		{name: "access denied", target: "/parameters/app/db", err: awsError("AccessDeniedException"), status: http.StatusForbidden, code: "access_denied"},
+		{name: "other failure", target: "/parameters/app/db", err: errors.New("connection reset"), status: http.StatusInternalServerError, code: "internal"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := &fakeSSM{deleteParameter: func(_ context.Context, in *ssm.DeleteParameterInput) (*ssm.DeleteParameterOutput, error) {
+				if name := aws.ToString(in.Name); name != "/app/db" {
+					t.Errorf("DeleteParameter name = %q, want /app/db", name)
+				}
+				return &ssm.DeleteParameterOutput{}, tt.err
+			}}
+			cfg := testConfig(t)
+			cfg.EnableWrites = true
+			s := newTestServer(t, cfg, testClients(&fakeS3{}, fake))
+
+			w := s.do(t, http.MethodDelete, tt.target, "", apiKeyHeader, testAdminKey)
+			if tt.status != 0 {
+				wantError(t, w, tt.status, tt.code)
+				return
+			}
+			var res deleteParameterResult
+			decodeData(t, w, &res)
+			if res != (deleteParameterResult{Name: "/app/db", Deleted: true}) {
+				t.Errorf("result = %+v", res)
+			}
+		})
+	}
+}
+
+// batchStore is a fakeSSM answering GetParameters from values, recording
+// each call's names; a chunk holding failOn fails with err.
+type batchStore struct {
+	*fakeSSM
+	mu     sync.Mutex
+	chunks [][]string
+}
+
+func newBatchStore(values map[string]string, failOn string, err error) *batchStore {
+	b := &batchStore{}
+	b.fakeSSM = &fakeSSM{getParameters: func(_ context.Context, in *ssm.GetParametersInput) (*ssm.GetParametersOutput, error) {
+		b.mu.Lock()
+		b.chunks = append(b.chunks, in.Names)
+		b.mu.Unlock()
+		out := &ssm.GetParametersOutput{}
+		for _, name := range in.Names {
+			if name == failOn {
+				return nil, err
+			}
+			if v, ok := values[name]; ok {
+				out.Parameters = append(out.Parameters, ssmtypes.Parameter{
+					Name: aws.String(name), Value: aws.String(v), Type: ssmtypes.ParameterTypeString, Version: 1,
+				})
+			} else {
+				out.InvalidParameters = append(out.InvalidParameters, name)
+			}
+		}
+		return out, nil
+	}}
+	return b
+}
+
+// chunkSizes returns the sizes of the GetParameters calls, largest first.
+func (b *batchStore) chunkSizes() []int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var sizes []int
+	for _, c := range b.chunks {
+		sizes = append(sizes, len(c))
+	}
+	slices.Sort(sizes)
+	slices.Reverse(sizes)
+	return sizes
+}
+
+func numberedNames(n int) []string {
+	names := make([]string, n)
+	for i := range names {
+		names[i] = fmt.Sprintf("/app/p%02d", i)
+	}
+	return names
+}
+
+func namesBody(names []string) string {
+	b, _ := json.Marshal(map[string]any{"names": names})
+	return string(b)
+}
+
+func TestBatchGetParametersHandler(t *testing.T) {
+	values := map[string]string{}
+	for _, name := range numberedNames(maxBatchGetNames) {
+		values[name] = "v" + name
+	}
+	tests := []struct {
+		name        string
+		names       []string
+		failOn      string
+		err         error
+		wantChunks  []int
+		wantFound   int
+		wantInvalid []string
+		status      int
+		code        string
+	}{
+		{name: "one chunk", names: numberedNames(10), wantChunks: []int{10}, wantFound: 10},
+		{name: "one over a chunk", names: numberedNames(11), wantChunks: []int{10, 1}, wantFound: 11},
+		{name: "several chunks", names: numberedNames(25), wantChunks: []int{10, 10, 5}, wantFound: 25},
+		{
+			name:       "duplicates",
+			names:      append(numberedNames(10), numberedNames(3)...),
+			wantChunks: []int{10},
+			wantFound:  10,
+		},
+		{
+			name:        "partly missing",
+			names:       []string{"/app/p00", "/app/gone", "/app/p01", "/other/gone"},
+			wantChunks:  []int{4},
+			wantFound:   2,
+			wantInvalid: []string{"/app/gone", "/other/gone"},
+		},
+		{
+			name:   "failed chunk",
+			names:  numberedNames(25),
+			failOn: "/app/p12",
+			err:    awsError("InternalServerError"),
+			status: http.StatusInternalServerError,
+			code:   "internal",
+		},
+		{
+			name:   "throttled chunk",
+			names:  numberedNames(25),
+			failOn: "/app/p24",
+			err:    awsError("ThrottlingException"),
+			status: http.StatusTooManyRequests,
+			code:   "throttled",
+		},
+		{name: "too many", names: numberedNames(maxBatchGetNames + 1), status: http.StatusBadRequest, code: "bad_request"},
+		{name: "bad name", names: []string{"/app/p00", "/app/bad name"}, status: http.StatusBadRequest, code: "bad_request"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := newBatchStore(values, tt.failOn, tt.err)
+			s := newTestServer(t, testConfig(t), testClients(&fakeS3{}, store))
+
+			w := s.do(t, http.MethodPost, "/parameters/batch-get", namesBody(tt.names))
+			if tt.status != 0 {
+				wantError(t, w, tt.status, tt.code)
+				return
+			}
+			var got batchGetResult
+			decodeData(t, w, &got)
+			if sizes := store.chunkSizes(); !slices.Equal(sizes, tt.wantChunks) {
+				t.Errorf("GetParameters chunk sizes = %v, want %v", sizes, tt.wantChunks)
+			}
+			if len(got.Parameters) != tt.wantFound {
+				t.Errorf("found %d parameters, want %d", len(got.Parameters), tt.wantFound)
+			}
+			for name, p := range got.Parameters {
+				if p.Value != values[name] {
+					t.Errorf("%s = %q, want %q", name, p.Value, values[name])
+				}
+			}
+			slices.Sort(got.Invalid)
+			if !slices.Equal(got.Invalid, tt.wantInvalid) {
+				t.Errorf("invalid = %q, want %q", got.Invalid, tt.wantInvalid)
+			}
+		})
+	}
+}
+
+func TestBatchGetParametersAudit(t *testing.T) {
+	s := newTestServer(t, testConfig(t), testClients(&fakeS3{}, newBatchStore(nil, "", nil)))
+
+	s.do(t, http.MethodPost, "/parameters/batch-get", namesBody([]string{"/b", "/a", "/b"}))
+	lines := s.audit.lines(t)
+	if len(lines) != 1 {
+		t.Fatalf("audit events = %d, want 1", len(lines))
+	}
+	got, _ := json.Marshal(lines[0]["parameters"])
+	if string(got) != `["/a","/b"]` || lines[0]["action"] != "batch-get" {
+		t.Errorf("audit event = %v, want action batch-get with parameters [/a /b]", lines[0])
+	}
+}
+
+func TestParameterActionRouting(t *testing.T) {
+	tests := []struct {
+		target string
+		op     string
+		name   string
+	}{
+		{target: "/parameters/app/db", op: "GetParameter", name: "/app/db"},
+		{target: "/parameters/app/db/history", op: "GetParameterHistory", name: "/app/db"},
+		{target: "/parameters/app/history?literal=true", op: "GetParameter", name: "/app/history"},
+		{target: "/parameters/app/db/tags?literal=true", op: "GetParameter", name: "/app/db/tags"},
+		{target: "/parameters/app/watch?literal=true", op: "GetParameter", name: "/app/watch"},
+		{target: "/parameters/diff?literal=true", op: "GetParameter", name: "diff"},
+		{target: "/parameters/status?literal=true", op: "GetParameter", name: "status"},
+		{target: "/parameters/by-path?literal=true", op: "GetParameter", name: "by-path"},
+		{target: "/parameters/history", op: "GetParameter", name: "history"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.target, func(t *testing.T) {
+			var op, name string
+			fake := &fakeSSM{
+				getParameter: func(_ context.Context, in *ssm.GetParameterInput) (*ssm.GetParameterOutput, error) {
+					op, name = "GetParameter", aws.ToString(in.Name)
+					return &ssm.GetParameterOutput{Parameter: &ssmtypes.Parameter{Name: in.Name, Value: aws.String("v")}}, nil
+				},
+				getParameterHistory: func(_ context.Context, in *ssm.GetParameterHistoryInput) (*ssm.GetParameterHistoryOutput, error) {
+					op, name = "GetParameterHistory", aws.ToString(in.Name)
+					return &ssm.GetParameterHistoryOutput{}, nil
+				},
+			}
+			s := newTestServer(t, testConfig(t), testClients(&fakeS3{}, fake))
+
+			s.do(t, http.MethodGet, tt.target, "")
+			if op != tt.op || name != tt.name {
+				t.Errorf("called %s(%q), want %s(%q)", op, name, tt.op, tt.name)
+			}
+		})
+	}
+}
+
+func TestBatchSetParameterNames(t *testing.T) {
+	tests := []struct {
+		name  string
+		items string
+		ok    bool
+	}{
+		{name: "valid", items: `[{"name": "/app/a", "value": "1"}, {"name": "flat", "value": "2"}]`, ok: true},
+		{name: "version selector", items: `[{"name": "/app/a", "value": "1"}, {"name": "/app/b:3", "value": "2"}]`},
+		{name: "label selector", items: `[{"name": "/app/b:prod", "value": "2"}]`},
+		{name: "bad character", items: `[{"name": "/app/b c", "value": "2"}]`},
+		{name: "empty segment", items: `[{"name": "/app//b", "value": "2"}]`},
+		{name: "trailing slash", items: `[{"name": "/app/", "value": "2"}]`},
+		{name: "too long", items: `[{"name": "/` + strings.Repeat("a", maxParameterNameLength) + `", "value": "2"}]`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := &fakeSSM{putParameter: func(context.Context, *ssm.PutParameterInput) (*ssm.PutParameterOutput, error) {
+				return &ssm.PutParameterOutput{Version: 1}, nil
+			}}
+			cfg := testConfig(t)
+			cfg.EnableWrites = true
+			s := newTestServer(t, cfg, testClients(&fakeS3{}, fake))
+
+			w := s.do(t, http.MethodPost, "/parameters/batch-set", `{"items": `+tt.items+`}`, apiKeyHeader, testAdminKey)
+			if tt.ok {
+				var results []batchSetResult
+				decodeData(t, w, &results)
+				if n := fake.count("PutParameter"); n != 2 {
+					t.Errorf("PutParameter calls = %d, want 2", n)
+				}
+				return
+			}
+			wantError(t, w, http.StatusBadRequest, "bad_request")
+			if n := fake.count("PutParameter"); n != 0 {
+				t.Errorf("PutParameter calls = %d, want 0", n)
+			}
+		})
+	}
+}
+
+func TestGetParameterIfVersion(t *testing.T) {
+	tests := []struct {
+		name      string
+		ifVersion string
+		query     string
+		status    int
+	}{
+		{name: "no header", status: http.StatusOK},
+		{name: "match", ifVersion: "7", status: http.StatusNotModified},
+		{name: "older version", ifVersion: "6", status: http.StatusOK},
+		{name: "newer version", ifVersion: "8", status: http.StatusOK},
+		{name: "not a version", ifVersion: "latest", status: http.StatusOK},
+		{name: "match with render", ifVersion: "7", query: "?render=true", status: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := &fakeSSM{getParameter: func(_ context.Context, in *ssm.GetParameterInput) (*ssm.GetParameterOutput, error) {
+				return &ssm.GetParameterOutput{Parameter: &ssmtypes.Parameter{
+					Name: in.Name, Value: aws.String("secret"), Type: ssmtypes.ParameterTypeString, Version: 7,
+				}}, nil
+			}}
+			s := newTestServer(t, testConfig(t), testClients(&fakeS3{}, fake))
+
+			var header []string
+			if tt.ifVersion != "" {
+				header = []string{ifVersionHeader, tt.ifVersion}
+			}
+			w := s.do(t, http.MethodGet, "/parameters/app/db"+tt.query, "", header...)
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d", w.Code, tt.status)
+			}
+			if v := w.Header().Get(parameterVersionHeader); v != "7" {
+				t.Errorf("%s = %q, want 7", parameterVersionHeader, v)
+			}
+			if tt.status == http.StatusNotModified {
+				if w.Body.Len() != 0 {
+					t.Errorf("304 body = %q, want empty", w.Body.String())
+				}
+				return
+			}
+			var got string
+			if decodeData(t, w, &got); got != "secret" {
+				t.Errorf("value = %q, want secret", got)
+			}
+		})
+	}
+}
+
+func TestGetParameterSharesConcurrentReads(t *testing.T) {
+	tests := []struct {
+		name    string
+		targets []string
+		calls   int
+	}{
+		{name: "same parameter", targets: slices.Repeat([]string{"/parameters/app/db"}, 20), calls: 1},
+		{name: "two parameters", targets: slices.Repeat([]string{"/parameters/app/db", "/parameters/app/other"}, 10), calls: 2},
+		{name: "decrypt apart", targets: slices.Repeat([]string{"/parameters/app/db", "/parameters/app/db?decrypt=true"}, 10), calls: 2},
+		{name: "wait apart", targets: slices.Repeat([]string{"/parameters/app/db", "/parameters/app/db?wait=true"}, 10), calls: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			started, release := make(chan struct{}, len(tt.targets)), make(chan struct{})
+			fake := &fakeSSM{getParameter: func(_ context.Context, in *ssm.GetParameterInput) (*ssm.GetParameterOutput, error) {
+				started <- struct{}{}
+				<-release
+				return &ssm.GetParameterOutput{Parameter: &ssmtypes.Parameter{
+					Name: in.Name, Value: aws.String("v"), Type: ssmtypes.ParameterTypeString, Version: 1,
+				}}, nil
+			}}
+			s := newTestServer(t, testConfig(t), testClients(&fakeS3{}, fake))
+
+			var wg sync.WaitGroup
+			codes := make([]int, len(tt.targets))
+			for i, target := range tt.targets {
+				wg.Go(func() {
+					codes[i] = s.do(t, http.MethodGet, target, "", apiKeyHeader, testDecryptKey).Code
+				})
+			}
+			// let every request reach the in-flight calls before they return
+			for range tt.calls {
+				<-started
+			}
+			time.Sleep(50 * time.Millisecond)
+			close(release)
+			wg.Wait()
+
+			if n := fake.count("GetParameter"); n != tt.calls {
+				t.Errorf("GetParameter calls = %d, want %d", n, tt.calls)
+			}
+			for i, code := range codes {
+				if code != http.StatusOK {
+					t.Errorf("%s: status = %d, want 200", tt.targets[i], code)
+				}
+			}
+		})
+	}
+}
+
+func TestParseParameterValue(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		kind    string
+		want    string // the JSON the parsed value encodes to
+		wantErr bool
+	}{
+		{name: "int64 beyond float64", value: `{"id": 9007199254740993}`, kind: "json", want: `{"id":9007199254740993}`},
+		{name: "max int64", value: `[9223372036854775807]`, kind: "json", want: `[9223372036854775807]`},
+		{name: "precise decimal", value: `0.10000000000000000555`, kind: "json", want: `0.10000000000000000555`},
+		{name: "nested", value: `{"a": {"b": [1, 2.5, "x", true, null]}}`, kind: "json", want: `{"a":{"b":[1,2.5,"x",true,null]}}`},
+		{name: "trailing data", value: `{"a": 1} {"b": 2}`, kind: "json", wantErr: true},
+		{name: "invalid json", value: `{"a":`, kind: "json", wantErr: true},
+		{name: "int", value: " 9007199254740993 ", kind: "int", want: `9007199254740993`},
+		{name: "not an int", value: "1.5", kind: "int", wantErr: true},
+		{name: "bool", value: "true", kind: "bool", want: `true`},
+		{name: "not a bool", value: "yes", kind: "bool", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v, err := parseParameterValue(tt.value, tt.kind)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("parsed %q as %v, want an error", tt.value, v)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := json.Marshal(v)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("parsed %q to %s, want %s", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetParameterParseJSONKeepsIntegers(t *testing.T) {
+	s := newTestServer(t, testConfig(t), testClients(&fakeS3{}, parameterStore(map[string]string{
+		"/app/ids": `{"id": 9007199254740993}`,
+	})))
+
+	var got map[string]json.RawMessage
+	decodeData(t, s.do(t, http.MethodGet, "/parameters/app/ids?parse=json", ""), &got)
+	if string(got["id"]) != "9007199254740993" {
+		t.Errorf("id = %s, want 9007199254740993", got["id"])
+	}
+}
+
+func TestGetParameterNames(t *testing.T) {
+	store := map[string]string{
+		"db":                "flat",
+		"/app/db":           "hierarchical",
+		"/app/db-1.x_y":     "punctuated",
+		"/platform/db/pass": "deep",
+	}
+	tests := []struct {
+		target string
+		want   string // the value read, "" when the read fails
+		status int
+	}{
+		{target: "/parameters/db", want: "flat"},
+		{target: "/parameters/app/db", want: "hierarchical"},
+		{target: "/parameters//app/db", want: "hierarchical"},
+		{target: "/parameters/platform/db/pass", want: "deep"},
+		{target: "/parameters/app/db-1.x_y", want: "punctuated"},
+		{target: "/parameters/%2Fapp%2Fdb", want: "hierarchical"},
+		{target: "/parameters/app%2Fdb", want: "hierarchical"},
+		{target: "/parameters/platform%2Fdb%2Fpass", want: "deep"},
+		{target: "/parameters/%64%62", want: "flat"},
+		{target: "/parameters/app/missing", status: http.StatusNotFound},
+		{target: "/parameters/missing", status: http.StatusNotFound},
+		{target: "/parameters/app/my%20db", status: http.StatusBadRequest},
+		{target: "/parameters/app//db", status: http.StatusBadRequest},
+		{target: "/parameters/app/db$", status: http.StatusBadRequest},
+		{target: "/parameters/" + strings.Repeat("a", maxParameterNameLength+1), status: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.target, func(t *testing.T) {
+			fake := parameterStore(store)
+			s := newTestServer(t, testConfig(t), testClients(&fakeS3{}, fake))
+
+			w := s.do(t, http.MethodGet, tt.target, "")
+			switch tt.status {
+			case http.StatusNotFound:
+				wantError(t, w, tt.status, "not_found")
+			case http.StatusBadRequest:
+				wantError(t, w, tt.status, "bad_request")
+				if n := fake.count("GetParameter"); n != 0 {
+					t.Errorf("GetParameter calls for a malformed name = %d, want 0", n)
+				}
+			default:
+				var got string
+				if decodeData(t, w, &got); got != tt.want {
+					t.Errorf("value = %q, want %q", got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestParameterActionErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		target string
+		op     string // the SSM call the action makes
+		err    error
+		status int
+		code   string
+	}{
+		{name: "tags throttled", target: "/parameters/app/db/tags", op: "ListTagsForResource", err: awsError("ThrottlingException"), status: http.StatusTooManyRequests, code: "throttled"},
+		{name: "tags missing", target: "/parameters/app/db/tags", op: "ListTagsForResource", err: awsError("InvalidResourceId"), status: http.StatusNotFound, code: "not_found"},
+		{name: "tags denied", target: "/parameters/app/db/tags", op: "ListTagsForResource", err: awsError("AccessDeniedException"), status: http.StatusForbidden, code: "access_denied"},
+		{name: "tags bad name", target: "/parameters/app/my%20db/tags", op: "ListTagsForResource", status: http.StatusBadRequest, code: "bad_request"},
+		{name: "encryption throttled", target: "/parameters/app/db/encryption", op: "DescribeParameters", err: awsError("ThrottlingException"), status: http.StatusTooManyRequests, code: "throttled"},
+		{name: "encryption denied", target: "/parameters/app/db/encryption", op: "DescribeParameters", err: awsError("AccessDeniedException"), status: http.StatusForbidden, code: "access_denied"},
+		{name: "encryption bad name", target: "/parameters/app//db/encryption", op: "DescribeParameters", status: http.StatusBadRequest, code: "bad_request"},
+		{name: "watch throttled", target: "/parameters/app/db/watch", op: "GetParameter", err: awsError("ThrottlingException"), status: http.StatusTooManyRequests, code: "throttled"},
+		{name: "watch missing", target: "/parameters/app/db/watch", op: "GetParameter", err: awsError("ParameterNotFound"), status: http.StatusNotFound, code: "not_found"},
+		{name: "watch bad name", target: "/parameters/app/db$/watch", op: "GetParameter", status: http.StatusBadRequest, code: "bad_request"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := &fakeSSM{
+				getParameter: func(context.Context, *ssm.GetParameterInput) (*ssm.GetParameterOutput, error) {
+					return nil, tt.err
+				},
+				describeParameters: func(context.Context, *ssm.DescribeParametersInput) (*ssm.DescribeParametersOutput, error) {
+					return nil, tt.err
+				},
+				listTagsForResource: func(context.Context, *ssm.ListTagsForResourceInput) (*ssm.ListTagsForResourceOutput, error) {
+					return nil, tt.err
+				},
+			}
+			s := newTestServer(t, testConfig(t), testClients(&fakeS3{}, fake))
+
+			w := s.do(t, http.MethodGet, tt.target, "", apiKeyHeader, testAdminKey)
+			wantError(t, w, tt.status, tt.code)
+			if tt.status == http.StatusTooManyRequests && w.Header().Get("Retry-After") == "" {
+				t.Error("throttled response has no Retry-After")
+			}
+			wantCalls := 1
+			if tt.status == http.StatusBadRequest {
+				wantCalls = 0
+			}
+			if n := fake.count(tt.op); n != wantCalls {
+				t.Errorf("%s calls = %d, want %d", tt.op, n, wantCalls)
+			}
+		})
+	}
+}
@@ -0,0 +1,44 @@
+package handlers
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/pprof"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func pprofMux() *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	return mux
+}
+
+// registerPprof mounts the profiling endpoints on the main router behind the
+// given guards.
+func registerPprof(r *gin.Engine, guards ...gin.HandlerFunc) {
+	h := gin.WrapH(pprofMux())
+	group := r.Group("/debug/pprof", guards...)
+	group.GET("/*profile", h)
+	group.POST("/symbol", h)
+}
+
+// servePprof exposes the profiling endpoints on a separate listener meant to
+// be reachable only from inside the cluster; it carries no auth of its own.
+func servePprof(addr string) {
+	srv := &http.Server{
+		Addr:              addr,
+		Handler:           pprofMux(),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	slog.Info("pprof listening", "addr", addr)
+	if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		slog.Error("pprof server failed", "err", err)
+	}
+}
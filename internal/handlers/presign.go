@@ -0,0 +1,133 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/gin-gonic/gin"
+)
+
+const defaultPresignExpiry = 5 * time.Minute
+
+type presignedRequest struct {
+	URL       string    `json:"url"`
+	Method    string    `json:"method"`
+	ExpiresAt time.Time `json:"expiresAt"`
+	// Headers must be sent exactly as given or the signature won't match.
+	Headers map[string]string `json:"headers"`
+}
+
+// presignExpiry reads ?expires=, in seconds (default 300), clamped to
+// maxExpiry.
+func presignExpiry(c *gin.Context, maxExpiry time.Duration) (time.Duration, error) {
+	expires := defaultPresignExpiry
+	if v := c.Query("expires"); v != "" {
+		secs, err := strconv.Atoi(v)
+		if err != nil || secs <= 0 {
+			return 0, errors.New("expires must be a positive number of seconds")
+		}
+		expires = time.Duration(secs) * time.Second
+	}
+	if maxExpiry > 0 {
+		expires = min(expires, maxExpiry)
+	}
+	return expires, nil
+}
+
+// presignUploadHandler returns a presigned PutObject URL so clients can
+// upload straight to S3 instead of streaming through this service.
+// ?expires= is in seconds (default 300) and is clamped to maxExpiry;
+// ?contentType= is signed into the request.
+func presignUploadHandler(cl *awsClients, maxExpiry time.Duration) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := objectKey(c)
+		if key == "" {
+			respondError(c, http.StatusBadRequest, "bad_request", "object key is required")
+			return
+		}
+		expires, err := presignExpiry(c, maxExpiry)
+		if err != nil {
+			respondError(c, http.StatusBadRequest, "bad_request", err.Error())
+			return
+		}
+
+		input := &s3.PutObjectInput{
+			Bucket: aws.String(c.Param("bucket")),
+			Key:    aws.String(key),
+		}
+		if ct := c.Query("contentType"); ct != "" {
+			input.ContentType = aws.String(ct)
+		}
+		req, err := cl.bucketPresigner(c.Request.Context(), *input.Bucket).PresignPutObject(c.Request.Context(), input, s3.WithPresignExpires(expires))
+		if err != nil {
+			respondAWSError(c, err, http.StatusInternalServerError, "internal", "failed to presign upload")
+			return
+		}
+
+		headers := map[string]string{}
+		for name, values := range req.SignedHeader {
+			if http.CanonicalHeaderKey(name) == "Host" || len(values) == 0 {
+				continue // sent by every HTTP client anyway
+			}
+			headers[http.CanonicalHeaderKey(name)] = values[0]
+		}
+		respond(c, http.StatusOK, presignedRequest{
+			URL:       req.URL,
+			Method:    req.Method,
+			ExpiresAt: time.Now().Add(expires).UTC(),
+			Headers:   headers,
+		})
+	}
+}
+
+// presignDownloadHandler returns a presigned GetObject URL so large
+// downloads go straight to S3 instead of through this service. ?expires=
+// works as for uploads. The object is checked with HeadObject first, so a
+// missing or forbidden object fails now rather than when the URL is used.
+func presignDownloadHandler(cl *awsClients, maxExpiry time.Duration) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := objectKey(c)
+		if key == "" {
+			respondError(c, http.StatusBadRequest, "bad_request", "object key is required")
+			return
+		}
+		expires, err := presignExpiry(c, maxExpiry)
+		if err != nil {
+			respondError(c, http.StatusBadRequest, "bad_request", err.Error())
+			return
+		}
+		ctx := c.Request.Context()
+		bucket := c.Param("bucket")
+		client := cl.bucketS3(ctx, bucket)
+		if _, err := client.HeadObject(ctx, &s3.HeadObjectInput{Bucket: aws.String(bucket), Key: aws.String(key)}); err != nil {
+			switch apiErrorCode(err) {
+			case "NotFound", "NoSuchKey":
+				respondAWSError(c, err, http.StatusNotFound, "not_found", "object not found")
+			case "AccessDenied", "Forbidden":
+				respondAWSError(c, err, http.StatusForbidden, "access_denied", "access to object denied")
+			default:
+				respondS3Error(c, err)
+			}
+			return
+		}
+
+		req, err := cl.bucketPresigner(ctx, bucket).PresignGetObject(ctx, &s3.GetObjectInput{
+			Bucket: aws.String(bucket),
+			Key:    aws.String(key),
+		}, s3.WithPresignExpires(expires))
+		if err != nil {
+			respondAWSError(c, err, http.StatusInternalServerError, "internal", "failed to presign download")
+			return
+		}
+		respond(c, http.StatusOK, presignedRequest{
+			URL:       req.URL,
+			Method:    req.Method,
+			ExpiresAt: time.Now().Add(expires).UTC(),
+			Headers:   map[string]string{},
+		})
+	}
+}
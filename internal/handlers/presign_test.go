@@ -0,0 +1,111 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+func TestPresignDownloadHandler(t *testing.T) {
+	tests := []struct {
+		name    string
+		target  string
+		headErr error
+		key     string
+		expires string
+		status  int
+		code    string
+	}{
+		{name: "default expiry", target: "/buckets/reports/objects/2024/q1.csv/presign", key: "2024/q1.csv", expires: "300"},
+		{name: "custom expiry", target: "/buckets/reports/objects/q1.csv/presign?expires=60", key: "q1.csv", expires: "60"},
+		{name: "clamped to max", target: "/buckets/reports/objects/q1.csv/presign?expires=86400", key: "q1.csv", expires: "3600"},
+		{
+			name:    "slashes and spaces",
+			target:  "/buckets/reports/objects/2024/q1%20final/sales%20report.csv/presign",
+			key:     "2024/q1 final/sales report.csv",
+			expires: "300",
+		},
+		{
+			name:    "reserved characters",
+			target:  "/buckets/reports/objects/a+b/c&d=e.txt/presign",
+			key:     "a+b/c&d=e.txt",
+			expires: "300",
+		},
+		{name: "bad expiry", target: "/buckets/reports/objects/q1.csv/presign?expires=soon", status: http.StatusBadRequest, code: "bad_request"},
+		{name: "zero expiry", target: "/buckets/reports/objects/q1.csv/presign?expires=0", status: http.StatusBadRequest, code: "bad_request"},
+		{name: "missing object", target: "/buckets/reports/objects/gone.csv/presign", headErr: awsError("NotFound"), status: http.StatusNotFound, code: "not_found"},
+		{name: "access denied", target: "/buckets/secret/objects/q1.csv/presign", headErr: awsError("Forbidden"), status: http.StatusForbidden, code: "access_denied"},
+		{name: "throttled", target: "/buckets/reports/objects/q1.csv/presign", headErr: awsError("SlowDown"), status: http.StatusTooManyRequests, code: "throttled"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var headKey string
+			fake := &fakeS3{headObject: func(_ context.Context, in *s3.HeadObjectInput) (*s3.HeadObjectOutput, error) {
+				headKey = aws.ToString(in.Key)
+				if tt.headErr != nil {
+					return nil, tt.headErr
+				}
+				return &s3.HeadObjectOutput{}, nil
+			}}
+			s := newTestServer(t, testConfig(t), testClients(fake, &fakeSSM{}))
+
+			start := time.Now().UTC()
+			w := s.do(t, http.MethodGet, tt.target, "")
+			if tt.status != 0 {
+				wantError(t, w, tt.status, tt.code)
+				return
+			}
+			var got presignedRequest
+			decodeData(t, w, &got)
+			if headKey != tt.key {
+				t.Errorf("HeadObject key = %q, want %q", headKey, tt.key)
+			}
+			if got.Method != http.MethodGet {
+				t.Errorf("method = %q, want GET", got.Method)
+			}
+			u, err := url.Parse(got.URL)
+			if err != nil {
+				t.Fatalf("parse %q: %v", got.URL, err)
+			}
+			if !strings.HasPrefix(u.Host, "reports.") {
+				t.Errorf("host = %q, want the reports bucket", u.Host)
+			}
+			if u.Path != "/"+tt.key {
+				t.Errorf("path = %q, want %q", u.Path, "/"+tt.key)
+			}
+			q := u.Query()
+			if q.Get("X-Amz-Expires") != tt.expires {
+				t.Errorf("X-Amz-Expires = %q, want %q", q.Get("X-Amz-Expires"), tt.expires)
+			}
+			if q.Get("X-Amz-Signature") == "" {
+				t.Error("URL is not signed")
+			}
+			secs, _ := time.ParseDuration(tt.expires + "s")
+			if d := got.ExpiresAt.Sub(start.Add(secs)); d < 0 || d > 5*time.Second {
+				t.Errorf("expiresAt = %v, want about %v", got.ExpiresAt, start.Add(secs))
+			}
+		})
+	}
+}
+
+func TestPresignDownloadSkipsSigningOnDenied(t *testing.T) {
+	fake := &fakeS3{headObject: func(context.Context, *s3.HeadObjectInput) (*s3.HeadObjectOutput, error) {
+		return nil, awsError("AccessDenied")
+	}}
+	s := newTestServer(t, testConfig(t), testClients(fake, &fakeSSM{}))
+
+	w := s.do(t, http.MethodGet, "/buckets/secret/objects/q1.csv/presign", "")
+	wantError(t, w, http.StatusForbidden, "access_denied")
+	if strings.Contains(w.Body.String(), "X-Amz-Signature") {
+		t.Errorf("denied response carries a presigned URL: %s", w.Body)
+	}
+	if n := fake.count("HeadObject"); n != 1 {
+		t.Errorf("HeadObject calls = %d, want 1", n)
+	}
+}
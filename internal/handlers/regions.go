@@ -0,0 +1,204 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/gin-gonic/gin"
+)
+
+// bucketClient is the S3 client of one region with a presigner signing for
+// it.
+type bucketClient struct {
+	api     s3API
+	presign s3Presigner
+}
+
+func sdkBucketClient(client *s3.Client) bucketClient {
+	return bucketClient{api: client, presign: s3.NewPresignClient(client)}
+}
+
+// s3Regions hands out S3 clients pinned to each bucket's region, since
+// requests for a bucket outside the configured region fail with a
+// PermanentRedirect. The bucket→region and region→client mappings are
+// learnt on first use and cached for the life of the process.
+type s3Regions struct {
+	home     string       // the configured region
+	fallback bucketClient // client for the configured region
+	build    func(region string) bucketClient
+
+	mu      sync.Mutex
+	buckets map[string]string
+	clients map[string]bucketClient
+}
+
+func newS3Regions(region string, fallback bucketClient, build func(region string) bucketClient) *s3Regions {
+	return &s3Regions{
+		home:     region,
+		fallback: fallback,
+		build:    build,
+		buckets:  map[string]string{},
+		clients:  map[string]bucketClient{region: fallback},
+	}
+}
+
+// region returns bucket's region, looking it up on first use.
+func (r *s3Regions) region(ctx context.Context, bucket string) (string, error) {
+	r.mu.Lock()
+	region, ok := r.buckets[bucket]
+	r.mu.Unlock()
+	if ok {
+		return region, nil
+	}
+	region, err := manager.GetBucketRegion(ctx, r.fallback.api, bucket)
+	if err != nil {
+		return "", err
+	}
+	if region == "" {
+		region = r.home
+	}
+	r.mu.Lock()
+	r.buckets[bucket] = region
+	r.mu.Unlock()
+	return region, nil
+}
+
+// client returns the client for bucket's region. When the region can't be
+// determined (missing bucket, no access) it returns the default client, so
+// the real operation reports the error.
+func (r *s3Regions) client(ctx context.Context, bucket string) bucketClient {
+	region, err := r.region(ctx, bucket)
+	if err != nil {
+		loggerFrom(ctx).Debug("bucket region lookup failed", "bucket", bucket, "err", err)
+		return r.fallback
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	client, ok := r.clients[region]
+	if !ok {
+		client = r.build(region)
+		r.clients[region] = client
+	}
+	return client
+}
+
+const regionHeader = "X-Region"
+
+// regionPattern matches region names such as eu-west-1 or us-gov-west-1.
+var regionPattern = regexp.MustCompile(`^[a-z]{2}(-[a-z]+)+-[0-9]+$`)
+
+type regionContextKey struct{}
+
+// regionChoice is the region a request overrode to, and whether anything
+// the request did depended on it.
+type regionChoice struct {
+	name string
+	used atomic.Bool
+}
+
+// requestRegion returns the region a request asked for, or "" for the
+// configured one, and records that the request depends on it so the
+// envelope echoes it.
+func requestRegion(ctx context.Context) string {
+	choice, _ := ctx.Value(regionContextKey{}).(*regionChoice)
+	if choice == nil {
+		return ""
+	}
+	choice.used.Store(true)
+	return choice.name
+}
+
+// servedRegion returns the region override a request's SSM calls used, or
+// "" when there was none or the route never consulted it.
+func servedRegion(ctx context.Context) string {
+	choice, _ := ctx.Value(regionContextKey{}).(*regionChoice)
+	if choice == nil || !choice.used.Load() {
+		return ""
+	}
+	return choice.name
+}
+
+// knownRegions are the regions of the aws, aws-cn and aws-us-gov partitions,
+// which ?region= may name unless ALLOWED_REGIONS narrows them.
+var knownRegions = []string{
+	"af-south-1", "ap-east-1", "ap-east-2", "ap-northeast-1", "ap-northeast-2", "ap-northeast-3",
+	"ap-south-1", "ap-south-2", "ap-southeast-1", "ap-southeast-2", "ap-southeast-3", "ap-southeast-4",
+	"ap-southeast-5", "ap-southeast-7", "ca-central-1", "ca-west-1", "eu-central-1", "eu-central-2",
+	"eu-north-1", "eu-south-1", "eu-south-2", "eu-west-1", "eu-west-2", "eu-west-3", "il-central-1",
+	"me-central-1", "me-south-1", "mx-central-1", "sa-east-1", "us-east-1", "us-east-2", "us-west-1",
+	"us-west-2", "cn-north-1", "cn-northwest-1", "us-gov-east-1", "us-gov-west-1",
+}
+
+// newRegionAllowlist returns the regions a request may override to: allowed,
+// or knownRegions when it is empty, plus the configured home region.
+func newRegionAllowlist(allowed []string, home string) map[string]bool {
+	if len(allowed) == 0 {
+		allowed = knownRegions
+	}
+	set := map[string]bool{home: true}
+	for _, region := range allowed {
+		if region = strings.TrimSpace(region); region != "" {
+			set[region] = true
+		}
+	}
+	return set
+}
+
+// regionOverride lets a request direct its SSM calls to another region with
+// ?region= or X-Region; the region is echoed in the envelope of routes
+// whose SSM calls used it. Bucket calls always go to the bucket's own
+// region. A malformed region, or one not in allowed, is a 400, so made-up
+// names never get a client built.
+func regionOverride(allowed map[string]bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		region := c.Query("region")
+		if region == "" {
+			region = c.GetHeader(regionHeader)
+		}
+		if region == "" {
+			c.Next()
+			return
+		}
+		if !regionPattern.MatchString(region) {
+			respondError(c, http.StatusBadRequest, "bad_request", "region is not a valid AWS region name")
+			return
+		}
+		if !allowed[region] {
+			respondError(c, http.StatusBadRequest, "bad_request", "region "+region+" is not enabled")
+			return
+		}
+		c.Request = c.Request.WithContext(context.WithValue(c.Request.Context(), regionContextKey{}, &regionChoice{name: region}))
+		c.Next()
+	}
+}
+
+// ssmRegions builds SSM clients for the regions requests override to, once
+// per region.
+type ssmRegions struct {
+	build func(region string) ssmAPI
+
+	mu      sync.Mutex
+	clients map[string]ssmAPI
+}
+
+func newSSMRegions(region string, fallback ssmAPI, build func(region string) ssmAPI) *ssmRegions {
+	return &ssmRegions{build: build, clients: map[string]ssmAPI{region: fallback}}
+}
+
+func (r *ssmRegions) client(region string) ssmAPI {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	client, ok := r.clients[region]
+	if !ok {
+		client = r.build(region)
+		r.clients[region] = client
+	}
+	return client
+}
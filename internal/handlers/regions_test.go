@@ -0,0 +1,96 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	ssmtypes "github.com/aws/aws-sdk-go-v2/service/ssm/types"
+)
+
+func TestRegionOverride(t *testing.T) {
+	tests := []struct {
+		name    string
+		allowed []string
+		target  string
+		header  []string
+		region  string // the envelope's region, echoed for overrides only
+		built   []string
+		bad     bool
+	}{
+		{name: "no override", target: "/parameters/app/db"},
+		{name: "query", target: "/parameters/app/db?region=eu-west-1", region: "eu-west-1", built: []string{"eu-west-1"}},
+		{name: "header", target: "/parameters/app/db", header: []string{regionHeader, "ap-south-1"}, region: "ap-south-1", built: []string{"ap-south-1"}},
+		{name: "home region", target: "/parameters/app/db?region=" + testRegion, region: testRegion},
+		{name: "malformed", target: "/parameters/app/db?region=EU_WEST", bad: true},
+		{name: "unknown", target: "/parameters/app/db?region=xx-fake-9", bad: true},
+		{name: "unknown header", target: "/parameters/app/db", header: []string{regionHeader, "zz-nowhere-1"}, bad: true},
+		{name: "allowed", allowed: []string{"eu-west-1"}, target: "/parameters/app/db?region=eu-west-1", region: "eu-west-1", built: []string{"eu-west-1"}},
+		{name: "home beside allowed", allowed: []string{"eu-west-1"}, target: "/parameters/app/db?region=" + testRegion, region: testRegion},
+		{name: "not allowed", allowed: []string{"eu-west-1"}, target: "/parameters/app/db?region=us-west-2", bad: true},
+		{name: "route without ssm", target: "/buckets?region=eu-west-1"},
+		{name: "listing", target: "/parameters?region=eu-west-1", region: "eu-west-1", built: []string{"eu-west-1"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := parameterStore(map[string]string{"/app/db": "v"})
+			store.describeParameters = func(context.Context, *ssm.DescribeParametersInput) (*ssm.DescribeParametersOutput, error) {
+				return &ssm.DescribeParametersOutput{Parameters: []ssmtypes.ParameterMetadata{{Name: aws.String("/app/db")}}}, nil
+			}
+			buckets := &fakeS3{listBuckets: func(context.Context, *s3.ListBucketsInput) (*s3.ListBucketsOutput, error) {
+				return &s3.ListBucketsOutput{Buckets: []s3types.Bucket{{Name: aws.String("alpha")}}}, nil
+			}}
+			cl := testClients(buckets, store)
+			var mu sync.Mutex
+			var built []string
+			cl.ssmIn = newSSMRegions(testRegion, store, func(region string) ssmAPI {
+				mu.Lock()
+				defer mu.Unlock()
+				built = append(built, region)
+				return store
+			})
+			cfg := testConfig(t)
+			cfg.AllowedRegions = tt.allowed
+			s := newTestServer(t, cfg, cl)
+
+			w := s.do(t, http.MethodGet, tt.target, "", tt.header...)
+			if tt.bad {
+				wantError(t, w, http.StatusBadRequest, "bad_request")
+			} else {
+				var data any
+				if e := decodeData(t, w, &data); e.Region != tt.region {
+					t.Errorf("region = %q, want %q", e.Region, tt.region)
+				}
+			}
+			if !slices.Equal(built, tt.built) {
+				t.Errorf("clients built for %q, want %q", built, tt.built)
+			}
+		})
+	}
+}
+
+// A cached read makes no SSM call but still answers for the region asked
+// for, so the envelope echoes it.
+func TestRegionOverrideCachedRead(t *testing.T) {
+	cfg := testConfig(t)
+	cfg.ParameterCacheTTL = time.Minute
+	s := newTestServer(t, cfg, testClients(&fakeS3{}, parameterStore(map[string]string{"/app/db": "v"})))
+
+	for _, want := range []string{"MISS", "HIT"} {
+		w := s.do(t, http.MethodGet, "/parameters/app/db?region=eu-west-1", "")
+		if got := w.Header().Get(cacheHeader); got != want {
+			t.Errorf("%s = %q, want %q", cacheHeader, got, want)
+		}
+		var value string
+		if e := decodeData(t, w, &value); e.Region != "eu-west-1" {
+			t.Errorf("%s read: region = %q, want eu-west-1", want, e.Region)
+		}
+	}
+}
@@ -0,0 +1,192 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	"github.com/gin-gonic/gin"
+	"github.com/kelseyhightower/envconfig"
+)
+
+// tunables are the settings that can change without a restart through
+// POST /admin/reload, from the environment or the RELOAD_PARAMETER overrides.
+// Everything else in Config (listen address, AWS
+// clients, auth, allowlist, async and pprof wiring) is read once at startup.
+type tunables struct {
+	ListingMaxAge         time.Duration `envconfig:"LISTING_MAX_AGE"`
+	ParameterMaxAge       time.Duration `envconfig:"PARAMETER_MAX_AGE"`
+	MaxResponseItems      int           `envconfig:"MAX_RESPONSE_ITEMS"`
+	ParameterWaitAttempts int           `envconfig:"PARAMETER_WAIT_ATTEMPTS"`
+	ParameterWaitBackoff  time.Duration `envconfig:"PARAMETER_WAIT_BACKOFF"`
+	SlowRequestThreshold  time.Duration `envconfig:"SLOW_REQUEST_THRESHOLD"`
+	ErrorVerbosity        string        `envconfig:"ERROR_VERBOSITY"`
+	LogLevel              string        `envconfig:"LOG_LEVEL"`
+}
+
+func (cfg Config) tunables() tunables {
+	return tunables{
+		ListingMaxAge:         cfg.ListingMaxAge,
+		ParameterMaxAge:       cfg.ParameterMaxAge,
+		MaxResponseItems:      cfg.MaxResponseItems,
+		ParameterWaitAttempts: cfg.ParameterWaitAttempts,
+		ParameterWaitBackoff:  cfg.ParameterWaitBackoff,
+		SlowRequestThreshold:  cfg.SlowRequestThreshold,
+		ErrorVerbosity:        cfg.ErrorVerbosity,
+		LogLevel:              cfg.LogLevel,
+	}
+}
+
+func (t tunables) validate() error {
+	if t.ErrorVerbosity != errorVerbosityMinimal && t.ErrorVerbosity != errorVerbosityFull {
+		return fmt.Errorf("ERROR_VERBOSITY must be %s or %s", errorVerbosityMinimal, errorVerbosityFull)
+	}
+	_, err := parseLogLevel(t.LogLevel)
+	return err
+}
+
+func (t tunables) readRetry() readRetry {
+	return readRetry{attempts: t.ParameterWaitAttempts, backoff: t.ParameterWaitBackoff}
+}
+
+// liveConfig holds the current tunables; handlers load it per request so a
+// reload applies to the next request without locking.
+type liveConfig struct {
+	current atomic.Pointer[tunables]
+}
+
+func newLiveConfig(t tunables) *liveConfig {
+	l := &liveConfig{}
+	l.swap(t)
+	return l
+}
+
+// swap installs t, applies its log level and returns the previous settings.
+// t must have been validated.
+func (l *liveConfig) swap(t tunables) tunables {
+	level, _ := parseLogLevel(t.LogLevel)
+	logLevel.Set(level)
+	if prev := l.current.Swap(&t); prev != nil {
+		return *prev
+	}
+	return t
+}
+
+func (l *liveConfig) get() tunables {
+	return *l.current.Load()
+}
+
+type settingChange struct {
+	Setting string `json:"setting"`
+	Old     string `json:"old"`
+	New     string `json:"new"`
+}
+
+// diff lists the settings that differ between t and next.
+func (t tunables) diff(next tunables) []settingChange {
+	changes := []settingChange{}
+	ov, nv := reflect.ValueOf(t), reflect.ValueOf(next)
+	for i := 0; i < ov.NumField(); i++ {
+		o, n := fmt.Sprint(ov.Field(i).Interface()), fmt.Sprint(nv.Field(i).Interface())
+		if o != n {
+			changes = append(changes, settingChange{
+				Setting: ov.Type().Field(i).Tag.Get("envconfig"),
+				Old:     o,
+				New:     n,
+			})
+		}
+	}
+	return changes
+}
+
+// overrides applies settings from a JSON object keyed by environment
+// variable name, e.g. {"LISTING_MAX_AGE": "30s"}, on top of t.
+func (t tunables) overrides(raw string) (tunables, error) {
+	var values map[string]string
+	if err := json.Unmarshal([]byte(raw), &values); err != nil {
+		return t, fmt.Errorf("reload parameter must be a JSON object of strings: %w", err)
+	}
+	v := reflect.ValueOf(&t).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		name := v.Type().Field(i).Tag.Get("envconfig")
+		value, ok := values[name]
+		if !ok {
+			continue
+		}
+		delete(values, name)
+		f := v.Field(i)
+		switch {
+		case f.Type() == reflect.TypeOf(time.Duration(0)):
+			d, err := time.ParseDuration(value)
+			if err != nil {
+				return t, fmt.Errorf("%s: %w", name, err)
+			}
+			f.SetInt(int64(d))
+		case f.Kind() == reflect.Int:
+			n, err := strconv.Atoi(value)
+			if err != nil {
+				return t, fmt.Errorf("%s: %w", name, err)
+			}
+			f.SetInt(int64(n))
+		default:
+			f.SetString(value)
+		}
+	}
+	for name := range values {
+		return t, fmt.Errorf("%s is not a reloadable setting", name)
+	}
+	return t, nil
+}
+
+// loadTunables reads the tunables from the environment and, when
+// RELOAD_PARAMETER names an SSM parameter, applies its overrides. The
+// parameter is what makes reloads useful in containers, whose environment
+// cannot change after start.
+func loadTunables(ctx context.Context, cl *awsClients) (tunables, error) {
+	var cfg Config
+	if err := envconfig.Process(EnvPrefix(), &cfg); err != nil {
+		return tunables{}, err
+	}
+	t := cfg.tunables()
+	if cfg.ReloadParameter != "" {
+		out, err := cl.ssm.GetParameter(ctx, &ssm.GetParameterInput{
+			Name:           aws.String(cfg.ReloadParameter),
+			WithDecryption: aws.Bool(true),
+		})
+		if err != nil {
+			return t, fmt.Errorf("read %s: %w", cfg.ReloadParameter, err)
+		}
+		if t, err = t.overrides(aws.ToString(out.Parameter.Value)); err != nil {
+			return t, err
+		}
+	}
+	return t, t.validate()
+}
+
+// reloadHandler re-reads the tunables and swaps them in. Invalid settings
+// leave the running ones untouched.
+func reloadHandler(cl *awsClients, live *liveConfig) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		next, err := loadTunables(c.Request.Context(), cl)
+		if err != nil {
+			loggerFrom(c.Request.Context()).Error("reload failed", "err", err)
+			respondError(c, http.StatusUnprocessableEntity, "unprocessable", err.Error())
+			return
+		}
+		changes := live.swap(next).diff(next)
+		for _, ch := range changes {
+			loggerFrom(c.Request.Context()).Info("setting reloaded", "setting", ch.Setting, "old", ch.Old, "new", ch.New)
+		}
+		if len(changes) == 0 {
+			loggerFrom(c.Request.Context()).Info("reload: no changes")
+		}
+		respond(c, http.StatusOK, changes)
+	}
+}
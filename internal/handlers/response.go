@@ -0,0 +1,80 @@
+package handlers
+
+import (
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// rawMediaType requests the bare payload, like ?raw=true.
+const rawMediaType = "application/vnd.aux.raw+json"
+
+// response is the envelope of every successful JSON reply.
+type response struct {
+	Version     string `json:"version"`
+	Environment string `json:"environment,omitempty"`
+	Region      string `json:"region,omitempty"` // set when a ?region= override was used
+	Data        any    `json:"data"`
+	// Truncated is set when a listing hit its item limit; NextToken resumes it.
+	Truncated bool   `json:"truncated,omitempty"`
+	NextToken string `json:"nextToken,omitempty"`
+	// Filters echoes the filters a listing applied.
+	Filters map[string][]string `json:"filters,omitempty"`
+}
+
+// responseMeta holds the per-instance settings that shape every response.
+type responseMeta struct {
+	version        string
+	environment    string
+	errorVerbosity string
+	canary         *canaryVersion
+}
+
+const responseMetaKey = "responseMeta"
+
+// withResponseMeta makes meta available to respond and respondError, with
+// the error verbosity taken from the live settings and the version possibly
+// swapped for the canary one.
+func withResponseMeta(meta responseMeta, live *liveConfig) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		meta := meta
+		meta.errorVerbosity = live.get().ErrorVerbosity
+		meta.version = meta.canary.pick(meta.version)
+		c.Set(responseMetaKey, meta)
+		c.Next()
+	}
+}
+
+func metaFrom(c *gin.Context) responseMeta {
+	v, _ := c.Get(responseMetaKey)
+	meta, _ := v.(responseMeta)
+	return meta
+}
+
+// respond writes data wrapped in the standard envelope. Clients asking for
+// ?raw=true (or Accept: application/vnd.aux.raw+json) get data itself as the
+// top-level JSON value instead, e.g. the bare names array of /buckets or the
+// parameter value of /parameters/:name. This applies to every JSON success
+// response; error bodies keep the envelope and streamed object reads are
+// unaffected.
+func respond(c *gin.Context, status int, data any) {
+	if wantsRaw(c) {
+		c.JSON(status, data)
+		return
+	}
+	meta := metaFrom(c)
+	page := listPageFrom(c)
+	c.JSON(status, response{
+		Version:     meta.version,
+		Environment: meta.environment,
+		Region:      servedRegion(c.Request.Context()),
+		Data:        data,
+		Truncated:   page.truncated,
+		NextToken:   page.nextToken,
+		Filters:     listFiltersFrom(c),
+	})
+}
+
+func wantsRaw(c *gin.Context) bool {
+	return c.Query("raw") == "true" || strings.Contains(c.GetHeader("Accept"), rawMediaType)
+}
@@ -0,0 +1,124 @@
+package handlers
+
+import (
+	"log/slog"
+
+	"github.com/gin-gonic/gin"
+)
+
+// buildRouter wires the middleware and routes. queue is nil unless async
+// jobs are enabled, audit when auditing is off.
+//
+// extra middleware runs, in the order given, after the built-in chain
+// (metrics, request ID, access log, recovery, caller identity, region
+// override, response metadata, slow request log) and before any route's own
+// guards such as admin auth, concurrency limits and service checks. It
+// therefore sees every request, including 404s and 405s, can use loggerFrom
+// and respondError, and may abort to reject a request before it reaches a
+// handler.
+func buildRouter(cfg Config, logger *slog.Logger, clients *awsClients, live *liveConfig,
+	health *healthChecker, queue *jobQueue, canary *canaryVersion, audit *auditLogger, metrics *metrics,
+	extra ...gin.HandlerFunc,
+) *gin.Engine {
+	r := gin.New()
+	// the access log and recovery come right after the request ID, so every
+	// request gets its line, including those the later middleware rejects
+	r.Use(metrics.middleware(), requestIDMiddleware(logger), accessLogger(), gin.Recovery(),
+		identifyCaller(cfg.AdminAPIKey, cfg.APIKeys), regionOverride(newRegionAllowlist(cfg.AllowedRegions, clients.region)),
+		withResponseMeta(responseMeta{
+			version:     cfg.VERSION,
+			environment: cfg.Environment,
+			canary:      canary,
+		}, live), slowRequestLogger(live))
+	r.Use(extra...)
+	r.HandleMethodNotAllowed = true
+	r.NoRoute(noRouteHandler())
+	r.NoMethod(noMethodHandler(r))
+
+	admin := requireAdmin(cfg.AdminAPIKey)
+	allow := newBucketAllowlist(cfg.BucketAllowlist)
+
+	needS3 := requireService(clients, serviceS3)
+	needSSM := requireService(clients, serviceSSM)
+
+	// Object streaming is bandwidth-bound, so it gets its own concurrency
+	// budget and a flood of downloads can't starve the cheap routes.
+	heavy := newConcurrencyLimit("heavy", cfg.HeavyMaxConcurrent, metrics).
+		withQueue(cfg.HeavyQueueDepth, cfg.HeavyQueueTimeout).
+		withShedding(cfg.OverloadThreshold).middleware()
+	lightLimit := newConcurrencyLimit("light", cfg.LightMaxConcurrent, metrics).withShedding(cfg.OverloadThreshold)
+	light := lightLimit.middleware()
+
+	bucketCache := newBucketListCache(cfg.BucketListCacheTTL)
+	paramCache := newParameterCache(cfg.ParameterCacheTTL)
+	r.GET("/buckets", light, needS3, listBucketsHandler(clients, allow, live, bucketCache))
+	bucket := r.Group("/buckets/:bucket", needS3, requireAllowedBucket(allow))
+	bucketHeavy := bucket.Group("", heavy)
+	bucketHeavy.GET("/objects/*key", objectActions(getObjectHandler(clients, cfg.MaxEncodedObjectSize), map[string]gin.HandlersChain{
+		"presign":        {presignDownloadHandler(clients, cfg.PresignMaxExpiry)},
+		"presign-upload": {admin, presignUploadHandler(clients, cfg.PresignMaxExpiry)},
+	}))
+	bucketHeavy.POST("/objects", admin, formUploadHandler(clients, cfg.MaxUploadSize, cfg.DefaultContentType))
+	bucketHeavy.POST("/objects/*key", objectActions(exactKey("metadata", batchObjectMetadataHandler(clients)), map[string]gin.HandlersChain{
+		"move":   {admin, moveObjectHandler(clients, allow)},
+		"select": {selectObjectHandler(clients)},
+	}))
+	bucketHeavy.PUT("/objects/*key", admin, putObjectHandler(clients, cfg.MaxUploadSize, cfg.DefaultContentType))
+	bucketHeavy.GET("/archive", archiveHandler(clients, live, cfg.ArchiveMaxSize, cfg.ArchiveTimeout))
+	bucketLight := bucket.Group("", light)
+	bucketLight.GET("/objects", listObjectsHandler(clients, live))
+	bucketLight.GET("/policy", admin, bucketPolicyHandler(clients))
+	bucketLight.GET("/acl", admin, bucketACLHandler(clients))
+	bucketLight.GET("/size", bucketSizeHandler(clients, queue))
+	if queue != nil {
+		r.GET("/jobs/:id", light, needS3, jobResultHandler(queue))
+	}
+
+	params := r.Group("/parameters", light, needSSM)
+	params.GET("", listParametersHandler(clients, live, paramCache))
+	if cfg.EnableWrites {
+		params.PUT("/*name", admin, paramCache.invalidates(), putParameterHandler(clients))
+		params.DELETE("/*name", admin, paramCache.invalidates(), deleteParameterHandler(clients))
+		params.POST("/batch-set", admin, paramCache.invalidates(), batchSetParametersHandler(clients))
+		params.POST("/copy-tree", admin, paramCache.invalidates(), copyTreeParametersHandler(clients))
+	}
+	params.POST("/batch-get", audit.middleware("batch-get"), batchGetParametersHandler(clients, cfg.AllowDecrypt))
+	params.POST("/validate", audit.middleware("validate"), admin, validateParametersHandler(clients, cfg.AllowDecrypt))
+	// names may contain slashes, so single-parameter reads share one
+	// catch-all and take the light limit per action: watch streams are
+	// long-lived and get their own cap instead of holding light slots.
+	// ?literal=true reads a parameter whose name ends in an action or is
+	// diff, status or by-path.
+	watchLimit := newConcurrencyLimit("watch", cfg.ParameterMaxWatchers, metrics)
+	r.GET("/parameters/*name", needSSM, trailingActions("name",
+		exactName("diff", audit.parameterReads("diff", lightLimit.wrap(diffParametersHandler(clients, live, cfg.AllowDecrypt))),
+			exactName("status", lightLimit.wrap(parameterStatusHandler(clients, live)),
+				exactName("by-path", audit.parameterReads("read", lightLimit.wrap(parametersByPathHandler(clients, live, paramCache, cfg.AllowDecrypt))),
+					audit.parameterReads("read", lightLimit.wrap(getParameterHandler(clients, live, paramCache, cfg.AllowDecrypt,
+						interpolationVars(cfg, clients, cfg.InterpolationVars))))))),
+		map[string]gin.HandlersChain{
+			"tags":       {lightLimit.wrap(parameterTagsHandler(clients))},
+			"history":    {audit.parameterReads("history", lightLimit.wrap(parameterHistoryHandler(clients, live, cfg.AllowDecrypt)))},
+			"encryption": {admin, lightLimit.wrap(parameterEncryptionHandler(clients))},
+			"watch": {audit.parameterReads("watch",
+				watchLimit.wrap(watchParameterHandler(clients, cfg.ParameterWatchInterval)))},
+		}))
+
+	r.POST("/kms/encrypt", light, admin, kmsEncryptHandler(clients))
+	r.POST("/kms/decrypt", light, admin, kmsDecryptHandler(clients))
+	r.GET("/iam/can", admin, iamCanHandler(clients))
+	r.POST("/admin/reload", admin, reloadHandler(clients, live))
+	r.DELETE("/cache", admin, flushCachesHandler(paramCache, bucketCache))
+
+	if cfg.PprofEnabled && cfg.PprofAddr == "" {
+		registerPprof(r, admin)
+	}
+
+	// Health entpoint
+	r.GET("/livez", livenessHandler)
+	r.GET("/metrics", metrics.handler())
+	r.GET("/metrics/snapshot", metrics.snapshotHandler())
+	r.GET("/readyz", readinessHandler(health))
+	r.GET("/healthz", healthHandler(health))
+	return r
+}
@@ -0,0 +1,91 @@
+// Package handlers is the aux HTTP API over S3 and SSM: its routes and
+// middleware, the AWS clients behind them and the server lifecycle.
+package handlers
+
+import (
+	"context"
+	"log"
+	"log/slog"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Run serves the API described by cfg until ctx is cancelled. The listener
+// comes up right away, answering 503 while the AWS clients are set up in
+// the background; cfg must already have been validated.
+func Run(ctx context.Context, cfg Config, logger *slog.Logger) error {
+	audit, err := newAuditLogger(cfg.AuditLog)
+	if err != nil {
+		return err
+	}
+	metrics := newMetrics(prometheus.NewRegistry())
+
+	// the environment's tunables apply from the start, so LOG_LEVEL covers
+	// AWS initialization; RELOAD_PARAMETER overrides follow once SSM is up
+	settings := cfg.tunables()
+	if err := settings.validate(); err != nil {
+		return err
+	}
+	live := newLiveConfig(settings)
+
+	if cfg.PprofEnabled && cfg.PprofAddr != "" {
+		go servePprof(cfg.PprofAddr)
+	}
+
+	// listen right away and bring up AWS in the background, so a slow
+	// credential source at pod start makes the instance unready rather
+	// than crash it
+	startup := newStartupHandler(cfg)
+	go initAWS(ctx, cfg, logger, startup, live, audit, metrics)
+
+	logger.Info("service listening", "addr", cfg.ListenAddr, "tls", cfg.TLSCertFile != "")
+	return serve(ctx, newServer(cfg, startup), cfg, logger)
+}
+
+// initAWS connects to AWS, retrying until it succeeds or ctx is cancelled,
+// then builds the full router and swaps it in for startup's 503s.
+func initAWS(ctx context.Context, cfg Config, logger *slog.Logger, startup *startupHandler, live *liveConfig,
+	audit *auditLogger, metrics *metrics,
+) {
+	clients, err := connectAWS(ctx, cfg, metrics, cfg.StartupRetry)
+	if err != nil {
+		return // shutting down
+	}
+	clients.logStatus()
+
+	if cfg.ReloadParameter != "" {
+		settings, err := loadTunables(ctx, clients)
+		if err != nil {
+			log.Fatal(err)
+		}
+		live.swap(settings)
+	}
+
+	logConfig(cfg, cfg.ListenAddr, clients.region)
+
+	watchdog := newCredentialWatchdog(clients.sts, cfg.CredentialCheckInterval, cfg.CredentialCheckTimeout, cfg.CredentialCheckFailures)
+	go watchdog.run(ctx)
+	health, err := newHealthChecker(watchdog, clients, cfg.HealthCheckServices)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var queue *jobQueue
+	if cfg.AsyncEnabled {
+		queue = &jobQueue{
+			sqs:           clients.sqs,
+			s3:            clients.bucketS3(ctx, cfg.AsyncResultsBucket),
+			regions:       clients.regions,
+			queueURL:      cfg.AsyncQueueURL,
+			resultsBucket: cfg.AsyncResultsBucket,
+			resultsPrefix: cfg.AsyncResultsPrefix,
+		}
+		go queue.run(ctx)
+	}
+
+	canary := newCanaryVersion(cfg.CanaryVersion, cfg.CanaryPercent)
+	go canary.run(ctx)
+
+	startup.ready(buildRouter(cfg, logger, clients, live, health, queue, canary, audit, metrics))
+	logger.Info("AWS initialized, serving requests")
+}
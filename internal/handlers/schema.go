@@ -0,0 +1,204 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	ssmtypes "github.com/aws/aws-sdk-go-v2/service/ssm/types"
+	"github.com/gin-gonic/gin"
+	"github.com/santhosh-tekuri/jsonschema/v6"
+)
+
+// errTreeConflict is returned when a parameter both has a value and has
+// parameters nested under it, which no JSON object can represent.
+var errTreeConflict = errors.New("parameter hierarchy does not map to an object")
+
+type schemaViolation struct {
+	Location string `json:"location"` // JSON pointer into the assembled config
+	Keyword  string `json:"keyword"`
+	Message  string `json:"message"`
+}
+
+type schemaValidation struct {
+	Path   string            `json:"path"`
+	Valid  bool              `json:"valid"`
+	Errors []schemaViolation `json:"errors"`
+}
+
+// coerceParameter turns an SSM value into the JSON value a schema sees.
+// Values that are JSON literals (numbers, booleans, null, objects, arrays)
+// are decoded, a StringList becomes an array of strings and anything else
+// stays a string, so "8080" validates as an integer and "true" as a boolean.
+func coerceParameter(p ssmtypes.Parameter) any {
+	value := aws.ToString(p.Value)
+	if p.Type == ssmtypes.ParameterTypeStringList {
+		items := []any{}
+		for _, item := range strings.Split(value, ",") {
+			items = append(items, item)
+		}
+		return items
+	}
+	if v, err := jsonschema.UnmarshalJSON(strings.NewReader(value)); err == nil {
+		return v
+	}
+	return value
+}
+
+// parameterTree fetches every parameter below path and nests them into one
+// object by name segment: /app/db/host becomes {"db": {"host": ...}}. It
+// also returns the JSON pointers of the SecureStrings, whose values must
+// not be echoed. Without decrypt a SecureString stays its opaque encrypted
+// string.
+func parameterTree(ctx context.Context, cl *awsClients, path string, decrypt bool) (map[string]any, map[string]bool, error) {
+	path = "/" + strings.Trim(path, "/")
+	tree := map[string]any{}
+	secrets := map[string]bool{}
+	paginator := ssm.NewGetParametersByPathPaginator(cl.ssmFor(ctx), &ssm.GetParametersByPathInput{
+		Path:           aws.String(path),
+		Recursive:      aws.Bool(true),
+		WithDecryption: aws.Bool(decrypt),
+	})
+	for paginator.HasMorePages() {
+		out, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, p := range out.Parameters {
+			name := aws.ToString(p.Name)
+			segments := strings.Split(strings.Trim(strings.TrimPrefix(name, path), "/"), "/")
+			node := tree
+			for _, seg := range segments[:len(segments)-1] {
+				child, ok := node[seg].(map[string]any)
+				if !ok {
+					if _, taken := node[seg]; taken {
+						return nil, nil, fmt.Errorf("%w: %s nests under a parameter that has a value", errTreeConflict, name)
+					}
+					child = map[string]any{}
+					node[seg] = child
+				}
+				node = child
+			}
+			leaf := segments[len(segments)-1]
+			if _, taken := node[leaf]; taken {
+				return nil, nil, fmt.Errorf("%w: %s has a value and parameters nested under it", errTreeConflict, name)
+			}
+			if p.Type == ssmtypes.ParameterTypeSecureString {
+				secrets[jsonPointer(segments)] = true
+				if !decrypt {
+					node[leaf] = aws.ToString(p.Value)
+					continue
+				}
+			}
+			node[leaf] = coerceParameter(p)
+		}
+	}
+	return tree, secrets, nil
+}
+
+// jsonPointer is the RFC 6901 pointer to the object member at segments.
+func jsonPointer(segments []string) string {
+	var b strings.Builder
+	for _, seg := range segments {
+		b.WriteString("/")
+		b.WriteString(strings.NewReplacer("~", "~0", "/", "~1").Replace(seg))
+	}
+	return b.String()
+}
+
+// compileSchema compiles a schema supplied in a request body. Loading of
+// remote or file $refs is disabled, so only self-contained schemas work.
+func compileSchema(body []byte) (*jsonschema.Schema, error) {
+	doc, err := jsonschema.UnmarshalJSON(bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("schema is not valid JSON: %w", err)
+	}
+	c := jsonschema.NewCompiler()
+	c.UseLoader(jsonschema.SchemeURLLoader{})
+	if err := c.AddResource("request.json", doc); err != nil {
+		return nil, err
+	}
+	return c.Compile("request.json")
+}
+
+// schemaViolations flattens a validation failure into one entry per
+// failing keyword. Messages such as pattern's and format's quote the
+// value, so at a SecureString location only the failing keyword is named.
+func schemaViolations(err *jsonschema.ValidationError, secrets map[string]bool) []schemaViolation {
+	violations := []schemaViolation{}
+	for _, unit := range err.BasicOutput().Errors {
+		if unit.Error == nil {
+			continue
+		}
+		message := unit.Error.String()
+		if secrets[unit.InstanceLocation] {
+			keyword := unit.KeywordLocation[strings.LastIndex(unit.KeywordLocation, "/")+1:]
+			message = "SecureString value fails " + keyword
+		}
+		violations = append(violations, schemaViolation{
+			Location: unit.InstanceLocation,
+			Keyword:  unit.KeywordLocation,
+			Message:  message,
+		})
+	}
+	return violations
+}
+
+// validateParametersHandler assembles the parameters under ?path= into a
+// config object and validates it against the JSON Schema in the body, so CI
+// can gate deploys on configuration. A failing config is still a 200 with
+// valid=false; only a bad request or an SSM failure is an error.
+//
+// SecureStrings are validated as their encrypted strings unless the request
+// asks for ?decrypt=true and may decrypt; either way their values never
+// appear in the returned messages.
+func validateParametersHandler(cl *awsClients, decryptEnabled bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		path := c.Query("path")
+		if path == "" {
+			respondError(c, http.StatusBadRequest, "bad_request", "path is required")
+			return
+		}
+		decrypt := c.Query("decrypt") == "true"
+		if decrypt && !allowDecrypt(c, decryptEnabled) {
+			return
+		}
+		body, err := c.GetRawData()
+		if err != nil {
+			respondError(c, http.StatusBadRequest, "bad_request", "failed to read body")
+			return
+		}
+		schema, err := compileSchema(body)
+		if err != nil {
+			respondError(c, http.StatusBadRequest, "bad_request", "invalid schema: "+err.Error())
+			return
+		}
+		tree, secrets, err := parameterTree(c.Request.Context(), cl, path, decrypt)
+		if err != nil {
+			if errors.Is(err, errTreeConflict) {
+				respondError(c, http.StatusUnprocessableEntity, "unprocessable", err.Error())
+				return
+			}
+			respondAWSError(c, err, http.StatusInternalServerError, "internal", "ssm request failed")
+			return
+		}
+
+		result := schemaValidation{Path: path, Valid: true, Errors: []schemaViolation{}}
+		if err := schema.Validate(tree); err != nil {
+			var verr *jsonschema.ValidationError
+			if !errors.As(err, &verr) {
+				loggerFrom(c.Request.Context()).Error("schema validation failed", "path", path, "err", err)
+				respondError(c, http.StatusInternalServerError, "internal", err.Error())
+				return
+			}
+			result.Valid = false
+			result.Errors = schemaViolations(verr, secrets)
+		}
+		respond(c, http.StatusOK, result)
+	}
+}
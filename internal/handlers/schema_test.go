@@ -0,0 +1,87 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	ssmtypes "github.com/aws/aws-sdk-go-v2/service/ssm/types"
+)
+
+func TestValidateParametersSecureStrings(t *testing.T) {
+	const (
+		plaintext  = "hunter2"
+		ciphertext = "AQICAH+encrypted/blob=="
+		schema     = `{"type":"object","properties":{"db":{"type":"object","properties":{
+			"host":{"type":"string","pattern":"^[a-z]+$"},
+			"password":{"type":"string","pattern":"^[A-Za-z0-9]{16,}$"}}}}}`
+	)
+	tests := []struct {
+		name         string
+		query        string
+		allowDecrypt bool
+		decrypted    bool
+		status       int
+		code         string
+	}{
+		{name: "encrypted", allowDecrypt: true},
+		{name: "decrypted", query: "&decrypt=true", allowDecrypt: true, decrypted: true},
+		{name: "encrypted with decryption disabled"},
+		{name: "decrypt disabled", query: "&decrypt=true", status: http.StatusForbidden, code: "forbidden"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var withDecryption *bool
+			fake := &fakeSSM{getParametersByPath: func(_ context.Context, in *ssm.GetParametersByPathInput) (*ssm.GetParametersByPathOutput, error) {
+				withDecryption = in.WithDecryption
+				password := ciphertext
+				if aws.ToBool(in.WithDecryption) {
+					password = plaintext
+				}
+				return &ssm.GetParametersByPathOutput{Parameters: []ssmtypes.Parameter{
+					{Name: aws.String("/svc/db/host"), Value: aws.String("db.internal"), Type: ssmtypes.ParameterTypeString},
+					{Name: aws.String("/svc/db/password"), Value: aws.String(password), Type: ssmtypes.ParameterTypeSecureString},
+				}}, nil
+			}}
+			cfg := testConfig(t)
+			cfg.AllowDecrypt = tt.allowDecrypt
+			s := newTestServer(t, cfg, testClients(&fakeS3{}, fake))
+
+			w := s.do(t, http.MethodPost, "/parameters/validate?path=/svc"+tt.query, schema, apiKeyHeader, testAdminKey)
+			if tt.status != 0 {
+				wantError(t, w, tt.status, tt.code)
+				if n := fake.count("GetParametersByPath"); n != 0 {
+					t.Errorf("GetParametersByPath calls = %d, want 0", n)
+				}
+				return
+			}
+			if got := aws.ToBool(withDecryption); got != tt.decrypted {
+				t.Errorf("WithDecryption = %v, want %v", got, tt.decrypted)
+			}
+			for _, secret := range []string{plaintext, ciphertext} {
+				if strings.Contains(w.Body.String(), secret) {
+					t.Errorf("response leaks the SecureString value %q: %s", secret, w.Body)
+				}
+			}
+
+			var got schemaValidation
+			decodeData(t, w, &got)
+			if got.Valid {
+				t.Fatal("valid = true, want both patterns to fail")
+			}
+			messages := map[string]string{}
+			for _, v := range got.Errors {
+				messages[v.Location] = v.Message
+			}
+			if want := "SecureString value fails pattern"; messages["/db/password"] != want {
+				t.Errorf("password message = %q, want %q", messages["/db/password"], want)
+			}
+			if !strings.Contains(messages["/db/host"], "db.internal") {
+				t.Errorf("host message = %q, want the value quoted as before", messages["/db/host"])
+			}
+		})
+	}
+}
@@ -0,0 +1,169 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/gin-gonic/gin"
+)
+
+type selectInput struct {
+	Format         string `json:"format"` // csv, json or parquet
+	Compression    string `json:"compression"`
+	FileHeaderInfo string `json:"fileHeaderInfo"`
+	FieldDelimiter string `json:"fieldDelimiter"`
+	JSONType       string `json:"jsonType"` // DOCUMENT or LINES
+}
+
+type selectOutput struct {
+	Format         string `json:"format"` // csv or json
+	FieldDelimiter string `json:"fieldDelimiter"`
+}
+
+type selectRequest struct {
+	Expression string       `json:"expression" binding:"required"`
+	Input      selectInput  `json:"input"`
+	Output     selectOutput `json:"output"`
+}
+
+func (in selectInput) serialization() (*s3types.InputSerialization, error) {
+	ser := &s3types.InputSerialization{CompressionType: s3types.CompressionType(strings.ToUpper(in.Compression))}
+	switch in.Format {
+	case "csv":
+		ser.CSV = &s3types.CSVInput{FileHeaderInfo: s3types.FileHeaderInfo(strings.ToUpper(in.FileHeaderInfo))}
+		if in.FieldDelimiter != "" {
+			ser.CSV.FieldDelimiter = aws.String(in.FieldDelimiter)
+		}
+	case "json":
+		ser.JSON = &s3types.JSONInput{Type: s3types.JSONType(strings.ToUpper(in.JSONType))}
+		if ser.JSON.Type == "" {
+			ser.JSON.Type = s3types.JSONTypeLines
+		}
+	case "parquet":
+		ser.Parquet = &s3types.ParquetInput{}
+	default:
+		return nil, errors.New("input.format must be csv, json or parquet")
+	}
+	return ser, nil
+}
+
+func (out selectOutput) serialization() (*s3types.OutputSerialization, string, error) {
+	switch out.Format {
+	case "csv":
+		ser := &s3types.OutputSerialization{CSV: &s3types.CSVOutput{}}
+		if out.FieldDelimiter != "" {
+			ser.CSV.FieldDelimiter = aws.String(out.FieldDelimiter)
+		}
+		return ser, "text/csv", nil
+	case "", "json":
+		return &s3types.OutputSerialization{JSON: &s3types.JSONOutput{}}, "application/x-ndjson", nil
+	default:
+		return nil, "", errors.New("output.format must be csv or json")
+	}
+}
+
+// isSelectInputError reports whether err is S3 Select rejecting the query
+// or the serialization settings rather than failing on its own.
+func isSelectInputError(err error) bool {
+	code := apiErrorCode(err)
+	for _, prefix := range []string{"Invalid", "Parse", "Missing", "Unsupported", "Unrecognized", "CSV", "JSON", "Cast", "Evaluator", "Lexer", "ObjectSerializationConflict", "IllegalSqlFunctionArgument", "IncorrectSqlFunctionArgumentType", "ValueParseFailure"} {
+		if strings.HasPrefix(code, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func respondSelectError(c *gin.Context, err error) {
+	if isSelectInputError(err) {
+		respondAWSError(c, err, http.StatusBadRequest, "bad_request", "query or serialization rejected by S3 Select")
+		return
+	}
+	respondS3Error(c, err)
+}
+
+// selectObjectHandler runs an S3 Select query over a CSV, JSON or Parquet
+// object and streams the matching records back as they arrive. Headers are
+// only sent with the first record, so a query that fails before producing
+// output still gets a proper error response; a failure midway can only cut
+// the stream short. A stream that stops without S3's end event counts as a
+// failure: the results may be incomplete.
+func selectObjectHandler(cl *awsClients) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req selectRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			respondError(c, http.StatusBadRequest, "bad_request", `body must be {"expression": "...", "input": {...}, "output": {...}}`)
+			return
+		}
+		input, err := req.Input.serialization()
+		if err != nil {
+			respondError(c, http.StatusBadRequest, "bad_request", err.Error())
+			return
+		}
+		output, contentType, err := req.Output.serialization()
+		if err != nil {
+			respondError(c, http.StatusBadRequest, "bad_request", err.Error())
+			return
+		}
+
+		out, err := cl.bucketS3(c.Request.Context(), c.Param("bucket")).SelectObjectContent(c.Request.Context(), &s3.SelectObjectContentInput{
+			Bucket:              aws.String(c.Param("bucket")),
+			Key:                 aws.String(objectKey(c)),
+			Expression:          aws.String(req.Expression),
+			ExpressionType:      s3types.ExpressionTypeSql,
+			InputSerialization:  input,
+			OutputSerialization: output,
+		})
+		if err != nil {
+			respondSelectError(c, err)
+			return
+		}
+		stream := out.GetStream()
+		defer func() { _ = stream.Close() }()
+
+		started, ended := false, false
+		for event := range stream.Events() {
+			if _, ok := event.(*s3types.SelectObjectContentEventStreamMemberEnd); ok {
+				ended = true
+				continue
+			}
+			records, ok := event.(*s3types.SelectObjectContentEventStreamMemberRecords)
+			if !ok {
+				continue // progress, stats and keep-alive events carry no data
+			}
+			if !started {
+				c.Header("Content-Type", contentType)
+				c.Status(http.StatusOK)
+				started = true
+			}
+			if _, err := c.Writer.Write(records.Value.Payload); err != nil {
+				return // client went away
+			}
+			c.Writer.Flush()
+		}
+		if err := stream.Err(); err != nil {
+			if !started {
+				respondSelectError(c, err)
+				return
+			}
+			loggerFrom(c.Request.Context()).Error("select stream failed after output started", "key", objectKey(c), "err", err)
+			return
+		}
+		if !ended {
+			if !started {
+				respondError(c, http.StatusBadGateway, "upstream", "s3 select stream ended without its end event")
+				return
+			}
+			loggerFrom(c.Request.Context()).Error("select stream ended without its end event after output started", "key", objectKey(c))
+			return
+		}
+		if !started {
+			c.Header("Content-Type", contentType)
+			c.Status(http.StatusOK)
+		}
+	}
+}
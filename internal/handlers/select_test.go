@@ -0,0 +1,96 @@
+package handlers
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/protocol/eventstream"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// selectEvent is one S3 Select event: Records with a payload, Stats or End.
+type selectEvent struct {
+	kind    string
+	payload string
+}
+
+// selectEndpoint answers SelectObjectContent with events, encoded as the
+// event stream S3 sends, and serves a real S3 client pointed at it: the SDK
+// offers no way to build a select stream by hand.
+func selectEndpoint(t *testing.T, events []selectEvent) *s3.Client {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+		w.WriteHeader(http.StatusOK)
+		enc := eventstream.NewEncoder()
+		for _, e := range events {
+			var headers eventstream.Headers
+			headers.Set(":message-type", eventstream.StringValue("event"))
+			headers.Set(":event-type", eventstream.StringValue(e.kind))
+			payload := []byte(e.payload)
+			if e.kind == "Stats" {
+				headers.Set(":content-type", eventstream.StringValue("text/xml"))
+				payload = []byte(`<Stats><BytesScanned>1</BytesScanned><BytesProcessed>1</BytesProcessed><BytesReturned>0</BytesReturned></Stats>`)
+			}
+			if err := enc.Encode(w, eventstream.Message{Headers: headers, Payload: payload}); err != nil {
+				t.Error(err)
+				return
+			}
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return s3.New(s3.Options{
+		Region: testRegion, BaseEndpoint: aws.String(srv.URL), UsePathStyle: true,
+		Credentials:      credentials.NewStaticCredentialsProvider("AKIDTEST", "secret", ""),
+		RetryMaxAttempts: 1,
+	})
+}
+
+func TestSelectObjectEndEvent(t *testing.T) {
+	tests := []struct {
+		name    string
+		events  []selectEvent
+		status  int
+		body    string
+		errLogs int // "ended without its end event" lines
+	}{
+		{
+			name:   "complete",
+			events: []selectEvent{{kind: "Records", payload: "a\n"}, {kind: "Stats"}, {kind: "Records", payload: "b\n"}, {kind: "End"}},
+			status: http.StatusOK,
+			body:   "a\nb\n",
+		},
+		{name: "no records", events: []selectEvent{{kind: "Stats"}, {kind: "End"}}, status: http.StatusOK},
+		{name: "no end before output", events: []selectEvent{{kind: "Stats"}}, status: http.StatusBadGateway},
+		{
+			name:    "no end after output",
+			events:  []selectEvent{{kind: "Records", payload: "a\n"}},
+			status:  http.StatusOK,
+			body:    "a\n",
+			errLogs: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer(t, testConfig(t), testClients(selectEndpoint(t, tt.events), &fakeSSM{}))
+
+			w := s.do(t, http.MethodPost, "/buckets/data/objects/rows.csv/select",
+				`{"expression": "SELECT * FROM s3object", "input": {"format": "csv"}, "output": {"format": "csv"}}`)
+			if tt.status != http.StatusOK {
+				wantError(t, w, tt.status, "upstream")
+				return
+			}
+			if w.Code != tt.status || w.Body.String() != tt.body {
+				t.Errorf("response = %d %q, want %d %q", w.Code, w.Body, tt.status, tt.body)
+			}
+			lines := linesWithMsg(s.log.lines(t), "select stream ended without its end event after output started")
+			if len(lines) != tt.errLogs {
+				t.Errorf("missing end event lines = %d, want %d", len(lines), tt.errLogs)
+			}
+		})
+	}
+}
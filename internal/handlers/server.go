@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// newServer builds the HTTP server for the API router.
+func newServer(cfg Config, handler http.Handler) *http.Server {
+	return &http.Server{
+		Addr:              cfg.ListenAddr,
+		Handler:           handler,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+}
+
+// serve runs srv, over TLS when a certificate is configured, until ctx is
+// cancelled, then shuts it down: new connections are refused and in-flight
+// requests get up to timeout to finish. Long-lived parameter watch streams
+// only end at the deadline.
+func serve(ctx context.Context, srv *http.Server, cfg Config, logger *slog.Logger) error {
+	errc := make(chan error, 1)
+	go func() {
+		var err error
+		if cfg.TLSCertFile != "" {
+			err = srv.ListenAndServeTLS(cfg.TLSCertFile, cfg.TLSKeyFile)
+		} else {
+			err = srv.ListenAndServe()
+		}
+		errc <- err
+	}()
+
+	select {
+	case err := <-errc:
+		return err
+	case <-ctx.Done():
+	}
+
+	logger.Info("shutting down", "timeout", cfg.ShutdownTimeout)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		if errors.Is(err, context.DeadlineExceeded) {
+			logger.Warn("shutdown deadline exceeded, dropping remaining requests")
+			return srv.Close()
+		}
+		return err
+	}
+	logger.Info("shutdown complete")
+	return nil
+}
+
+// startupHandler fronts the API while the AWS clients are still being set
+// up: /livez succeeds, /readyz and everything else answer 503, until ready
+// swaps in the fully built router in one step.
+type startupHandler struct {
+	router  atomic.Pointer[gin.Engine]
+	waiting *gin.Engine
+}
+
+func newStartupHandler(cfg Config) *startupHandler {
+	waiting := gin.New()
+	waiting.Use(gin.Recovery(), func(c *gin.Context) {
+		c.Set(responseMetaKey, responseMeta{version: cfg.VERSION, environment: cfg.Environment})
+	})
+	waiting.GET("/livez", livenessHandler)
+	waiting.NoRoute(func(c *gin.Context) {
+		c.Header("Retry-After", "5")
+		respondError(c, http.StatusServiceUnavailable, "not_ready", "AWS not initialized yet")
+	})
+	return &startupHandler{waiting: waiting}
+}
+
+func (h *startupHandler) ready(r *gin.Engine) {
+	h.router.Store(r)
+}
+
+func (h *startupHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if r := h.router.Load(); r != nil {
+		r.ServeHTTP(w, req)
+		return
+	}
+	h.waiting.ServeHTTP(w, req)
+}
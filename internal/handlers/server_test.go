@@ -0,0 +1,109 @@
+package handlers
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestStartupHandler(t *testing.T) {
+	cfg := testConfig(t)
+	startup := newStartupHandler(cfg)
+
+	for _, target := range []string{"/parameters", "/parameters/app/db", "/readyz", "/buckets"} {
+		w := serveRequest(t, startup, http.MethodGet, target, "")
+		wantError(t, w, http.StatusServiceUnavailable, "not_ready")
+		if got := w.Header().Get("Retry-After"); got != "5" {
+			t.Errorf("%s: Retry-After = %q, want 5", target, got)
+		}
+		if e := decodeEnvelope(t, w); e.Version != "test" {
+			t.Errorf("%s: version = %q, want test", target, e.Version)
+		}
+	}
+	if w := serveRequest(t, startup, http.MethodGet, "/livez", ""); w.Code != http.StatusOK {
+		t.Errorf("/livez while starting: status = %d, want 200", w.Code)
+	}
+
+	store := parameterStore(map[string]string{"/app/db": "v"})
+	startup.ready(newTestServer(t, cfg, testClients(&fakeS3{}, store)).router)
+
+	var value string
+	decodeData(t, serveRequest(t, startup, http.MethodGet, "/parameters/app/db", ""), &value)
+	if value != "v" {
+		t.Errorf("value once ready = %q, want v", value)
+	}
+	if w := serveRequest(t, startup, http.MethodGet, "/readyz", ""); w.Code != http.StatusOK {
+		t.Errorf("/readyz once ready: status = %d, want 200; body %s", w.Code, w.Body.String())
+	}
+}
+
+// Run rejects bad tunables before it starts on AWS, and applies good ones
+// right away.
+func TestRunAppliesTunablesBeforeAWS(t *testing.T) {
+	prev := logLevel.Level()
+	t.Cleanup(func() { logLevel.Set(prev) })
+	t.Setenv("AWS_REGION", testRegion)
+	t.Setenv("AWS_EC2_METADATA_DISABLED", "true")
+	logger := slog.New(slog.DiscardHandler)
+
+	for _, bad := range []func(*Config){
+		func(cfg *Config) { cfg.LogLevel = "loud" },
+		func(cfg *Config) { cfg.ErrorVerbosity = "everything" },
+	} {
+		cfg := testConfig(t)
+		bad(&cfg)
+		if err := Run(t.Context(), cfg, logger); err == nil {
+			t.Errorf("Run with LOG_LEVEL %q, ERROR_VERBOSITY %q: no error", cfg.LogLevel, cfg.ErrorVerbosity)
+		}
+	}
+
+	cfg := testConfig(t)
+	cfg.ListenAddr = "127.0.0.1:0"
+	cfg.LogLevel = "debug"
+	ctx, cancel := context.WithCancel(t.Context())
+	cancel()
+	if err := Run(ctx, cfg, logger); err != nil {
+		t.Fatal(err)
+	}
+	if got := logLevel.Level(); got != slog.LevelDebug {
+		t.Errorf("log level = %v, want debug", got)
+	}
+}
+
+// A failed first attempt at AWS leaves the instance unready rather than
+// exiting, and the retry that follows brings it up.
+func TestInitAWSRetriesUntilReady(t *testing.T) {
+	calls := awsEndpoint(t, false, 1)
+	cfg := testConfig(t)
+	cfg.StartupRetry = 0 // every retry logs as an error, but still retries
+	startup := newStartupHandler(cfg)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		initAWS(t.Context(), cfg, slog.New(slog.DiscardHandler), startup, newLiveConfig(cfg.tunables()),
+			&auditLogger{logger: slog.New(slog.DiscardHandler)}, newMetrics(prometheus.NewRegistry()))
+	}()
+
+	wantError(t, serveRequest(t, startup, http.MethodGet, "/readyz", ""), http.StatusServiceUnavailable, "not_ready")
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("AWS init did not finish")
+	}
+	if w := serveRequest(t, startup, http.MethodGet, "/readyz", ""); w.Code != http.StatusOK {
+		t.Errorf("/readyz after the retry: status = %d, want 200; body %s", w.Code, w.Body.String())
+	}
+	identity := 0
+	for _, c := range calls() {
+		if c.action == "GetCallerIdentity" {
+			identity++
+		}
+	}
+	if identity < 2 {
+		t.Errorf("GetCallerIdentity calls = %d, want the refused one and a retry", identity)
+	}
+}
@@ -0,0 +1,91 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"text/template"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+// maxRenderDepth bounds how deeply rendered parameters may reference
+// further templated parameters.
+const maxRenderDepth = 5
+
+// renderParameter executes value as a text/template in which
+// {{param "/other/key"}} is replaced by that parameter, itself rendered, so
+// configuration can be layered. stack holds the names being rendered, for
+// cycle detection. Referenced parameters are read with the same decrypt
+// setting as the one being rendered, and each one read is added to
+// resolved, once, for the audit trail.
+func renderParameter(ctx context.Context, reads *parameterReader, value string, decrypt bool, stack []string, resolved *[]string) (string, error) {
+	if len(stack) > maxRenderDepth {
+		return "", fmt.Errorf("template nesting deeper than %d: %s", maxRenderDepth, strings.Join(stack, " -> "))
+	}
+	funcs := template.FuncMap{
+		"param": func(name string) (string, error) {
+			if slices.Contains(stack, name) {
+				return "", fmt.Errorf("template cycle: %s -> %s", strings.Join(stack, " -> "), name)
+			}
+			out, err := reads.get(ctx, name, readOptions{decrypt: decrypt})
+			if err != nil {
+				return "", fmt.Errorf("param %q: %s", name, parameterItemError(err).Message)
+			}
+			if !slices.Contains(*resolved, name) {
+				*resolved = append(*resolved, name)
+			}
+			return renderParameter(ctx, reads, aws.ToString(out.Parameter.Value), decrypt, append(slices.Clip(stack), name), resolved)
+		},
+	}
+	tmpl, err := template.New(stack[len(stack)-1]).Funcs(funcs).Parse(value)
+	if err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	if err := tmpl.Execute(&b, nil); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+// placeholderPattern matches ${NAME} placeholders for interpolateParameter.
+var placeholderPattern = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// interpolationVars returns the server-side values ${NAME} placeholders may
+// refer to, limited to the names in allow. Only these fixed facts about the
+// instance are offered, never the process environment.
+func interpolationVars(cfg Config, cl *awsClients, allow []string) map[string]string {
+	known := map[string]string{
+		"REGION":      cl.region,
+		"ENVIRONMENT": cfg.Environment,
+		"ACCOUNT":     cl.account,
+	}
+	vars := map[string]string{}
+	for _, name := range allow {
+		if v, ok := known[strings.ToUpper(name)]; ok {
+			vars[strings.ToUpper(name)] = v
+		}
+	}
+	return vars
+}
+
+// interpolateParameter replaces ${NAME} placeholders in value from vars.
+// Unknown placeholders are left as they are, or fail when strict.
+func interpolateParameter(value string, vars map[string]string, strict bool) (string, error) {
+	var unknown []string
+	out := placeholderPattern.ReplaceAllStringFunc(value, func(m string) string {
+		name := m[2 : len(m)-1]
+		if v, ok := vars[name]; ok {
+			return v
+		}
+		unknown = append(unknown, name)
+		return m
+	})
+	if strict && len(unknown) > 0 {
+		return "", fmt.Errorf("unknown placeholders: %s", strings.Join(unknown, ", "))
+	}
+	return out, nil
+}
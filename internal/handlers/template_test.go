@@ -0,0 +1,212 @@
+package handlers
+
+import (
+	"maps"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestInterpolationVars(t *testing.T) {
+	cfg := testConfig(t)
+	cfg.Environment = "staging"
+	cl := testClients(&fakeS3{}, &fakeSSM{})
+	t.Setenv("SECRET_TOKEN", "from-the-environment")
+
+	tests := []struct {
+		name  string
+		allow []string
+		want  map[string]string
+	}{
+		{
+			name:  "defaults",
+			allow: cfg.InterpolationVars,
+			want:  map[string]string{"REGION": testRegion, "ENVIRONMENT": "staging", "ACCOUNT": testAccount},
+		},
+		{name: "narrowed", allow: []string{"REGION"}, want: map[string]string{"REGION": testRegion}},
+		{name: "any case", allow: []string{"account"}, want: map[string]string{"ACCOUNT": testAccount}},
+		{name: "unknown names", allow: []string{"SECRET_TOKEN", "HOME", "REGION"}, want: map[string]string{"REGION": testRegion}},
+		{name: "none", allow: nil, want: map[string]string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := interpolationVars(cfg, cl, tt.allow); !maps.Equal(got, tt.want) {
+				t.Errorf("vars = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestInterpolateParameter(t *testing.T) {
+	vars := map[string]string{"REGION": "eu-west-1", "ENVIRONMENT": "prod"}
+	tests := []struct {
+		name    string
+		value   string
+		strict  bool
+		want    string
+		wantErr bool
+	}{
+		{name: "one", value: "https://ssm.${REGION}.amazonaws.com", want: "https://ssm.eu-west-1.amazonaws.com"},
+		{name: "several", value: "${ENVIRONMENT}-${REGION}-${REGION}", want: "prod-eu-west-1-eu-west-1"},
+		{name: "none", value: "plain $REGION {REGION}", want: "plain $REGION {REGION}"},
+		{name: "unknown kept", value: "${REGION}/${HOME}", want: "eu-west-1/${HOME}"},
+		{name: "unknown strict", value: "${REGION}/${HOME}", strict: true, wantErr: true},
+		{name: "known strict", value: "${REGION}", strict: true, want: "eu-west-1"},
+		{name: "not a placeholder", value: "${1X} ${}", strict: true, want: "${1X} ${}"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := interpolateParameter(tt.value, vars, tt.strict)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, want error %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && got != tt.want {
+				t.Errorf("interpolated %q to %q, want %q", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetParameterInterpolate(t *testing.T) {
+	tests := []struct {
+		name   string
+		query  string
+		allow  []string
+		want   string
+		status int
+	}{
+		{name: "off", query: "", want: "${REGION}/${ACCOUNT}"},
+		{name: "on", query: "?interpolate=true", want: testRegion + "/" + testAccount},
+		{name: "allowlist", query: "?interpolate=true", allow: []string{"REGION"}, want: testRegion + "/${ACCOUNT}"},
+		{name: "strict", query: "?interpolate=true&strict=true", allow: []string{"REGION"}, status: http.StatusUnprocessableEntity},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig(t)
+			if tt.allow != nil {
+				cfg.InterpolationVars = tt.allow
+			}
+			store := parameterStore(map[string]string{"/app/url": "${REGION}/${ACCOUNT}"})
+			s := newTestServer(t, cfg, testClients(&fakeS3{}, store))
+
+			w := s.do(t, http.MethodGet, "/parameters/app/url"+tt.query, "")
+			if tt.status != 0 {
+				wantError(t, w, tt.status, "unprocessable")
+				return
+			}
+			var got string
+			if decodeData(t, w, &got); got != tt.want {
+				t.Errorf("value = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetParameterRender(t *testing.T) {
+	store := map[string]string{
+		"/app/url":    `https://{{param "/app/host"}}/{{param "/app/name"}}`,
+		"/app/host":   `db.{{param "/app/region"}}.internal`,
+		"/app/region": "eu",
+		"/app/name":   "orders",
+		"/loop/a":     `{{param "/loop/b"}}`,
+		"/loop/b":     `b-{{param "/loop/a"}}`,
+		"/loop/self":  `{{param "/loop/self"}}`,
+		"/chain/6":    "end",
+	}
+	for i := range 6 {
+		store["/chain/"+strconv.Itoa(i)] = `{{param "/chain/` + strconv.Itoa(i+1) + `"}}`
+	}
+	tests := []struct {
+		name   string
+		target string
+		want   string // the value, or a fragment of the error message
+		status int
+	}{
+		{name: "nested", target: "/parameters/app/url?render=true", want: "https://db.eu.internal/orders"},
+		{name: "unrendered", target: "/parameters/app/host", want: `db.{{param "/app/region"}}.internal`},
+		{name: "cycle", target: "/parameters/loop/a?render=true", want: "template cycle: /loop/a -> /loop/b -> /loop/a", status: http.StatusUnprocessableEntity},
+		{name: "self reference", target: "/parameters/loop/self?render=true", want: "template cycle: /loop/self -> /loop/self", status: http.StatusUnprocessableEntity},
+		{name: "at the depth limit", target: "/parameters/chain/2?render=true", want: "end"},
+		{name: "too deep", target: "/parameters/chain/0?render=true", want: "template nesting deeper than " + strconv.Itoa(maxRenderDepth), status: http.StatusUnprocessableEntity},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer(t, testConfig(t), testClients(&fakeS3{}, parameterStore(store)))
+
+			w := s.do(t, http.MethodGet, tt.target, "")
+			if tt.status != 0 {
+				wantError(t, w, tt.status, "unprocessable")
+				if env := decodeEnvelope(t, w); !strings.Contains(env.Error.Message, tt.want) {
+					t.Errorf("message = %q, want it to contain %q", env.Error.Message, tt.want)
+				}
+				return
+			}
+			var got string
+			if decodeData(t, w, &got); got != tt.want {
+				t.Errorf("value = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRenderParameterAudit(t *testing.T) {
+	tests := []struct {
+		name      string
+		target    string
+		parameter string
+		status    int
+		want      []string // audited referenced parameters
+	}{
+		{
+			name:      "nested references",
+			target:    "/parameters/app/dsn?render=true&decrypt=true",
+			parameter: "/app/dsn",
+			status:    http.StatusOK,
+			want:      []string{"/app/user", "/app/pass", "/app/host", "/app/region"},
+		},
+		{
+			name:      "failed reference",
+			target:    "/parameters/app/broken?render=true",
+			parameter: "/app/broken",
+			status:    http.StatusUnprocessableEntity,
+			want:      []string{"/app/user"},
+		},
+		{name: "plain read", target: "/parameters/app/dsn", parameter: "/app/dsn", status: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := parameterStore(map[string]string{
+				"/app/dsn":    `{{param "/app/user"}}:{{param "/app/pass"}}@{{param "/app/host"}}/{{param "/app/user"}}`,
+				"/app/broken": `{{param "/app/user"}}@{{param "/app/missing"}}`,
+				"/app/host":   `db.{{param "/app/region"}}`,
+				"/app/user":   "svc",
+				"/app/pass":   "hunter2",
+				"/app/region": "eu",
+			})
+			s := newTestServer(t, testConfig(t), testClients(&fakeS3{}, store))
+
+			w := s.do(t, http.MethodGet, tt.target, "", apiKeyHeader, testDecryptKey)
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.status, w.Body)
+			}
+			lines := s.audit.lines(t)
+			if len(lines) != 1 {
+				t.Fatalf("audit events = %d, want 1", len(lines))
+			}
+			if got := lines[0]["parameter"]; got != tt.parameter {
+				t.Errorf("audited parameter = %v, want %s", got, tt.parameter)
+			}
+			var got []string
+			if v, ok := lines[0]["parameters"].([]any); ok {
+				for _, name := range v {
+					got = append(got, name.(string))
+				}
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("audited references = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,77 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/gin-contrib/sse"
+	"github.com/gin-gonic/gin"
+)
+
+type parameterChange struct {
+	Name    string `json:"name"`
+	Version int64  `json:"version"`
+	Value   string `json:"value"`
+}
+
+// watchParameterHandler streams a parameter as server-sent events, polling
+// it every interval: a "parameter" event with the current value when the
+// stream opens, then one per new version. The event ID is the version, so a
+// client reconnecting with Last-Event-ID skips a value it already has. Read
+// failures are sent as "error" events without closing the stream; it ends
+// when the client disconnects.
+func watchParameterHandler(cl *awsClients, interval time.Duration) gin.HandlerFunc {
+	reads := &parameterReader{cl: cl}
+	return func(c *gin.Context) {
+		ctx := c.Request.Context()
+		name := parameterName(c)
+		if err := checkParameterName(name); err != nil {
+			respondError(c, http.StatusBadRequest, "bad_request", err.Error())
+			return
+		}
+		out, err := reads.get(ctx, name, readOptions{})
+		if err != nil {
+			respondParameterReadError(c, err)
+			return
+		}
+
+		c.Header("Content-Type", "text/event-stream")
+		c.Header("Cache-Control", "no-cache")
+		c.Header("X-Accel-Buffering", "no")
+		c.Status(http.StatusOK)
+
+		var seen int64
+		if id, err := strconv.ParseInt(c.GetHeader("Last-Event-ID"), 10, 64); err == nil {
+			seen = id
+		}
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			if err != nil {
+				c.SSEvent("error", gin.H{"message": parameterItemError(err).Message})
+				c.Writer.Flush()
+			} else if out.Parameter.Version > seen {
+				seen = out.Parameter.Version
+				c.Render(-1, sse.Event{
+					Event: "parameter",
+					Id:    strconv.FormatInt(seen, 10),
+					Data: parameterChange{
+						Name:    name,
+						Version: seen,
+						Value:   aws.ToString(out.Parameter.Value),
+					},
+				})
+				c.Writer.Flush()
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			out, err = reads.get(ctx, name, readOptions{})
+		}
+	}
+}
@@ -2,130 +2,64 @@ package main
 
 import (
 	"context"
+	"errors"
 	"log"
+	"log/slog"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
 
-	"github.com/aws/aws-sdk-go-v2/config"
-	"github.com/aws/aws-sdk-go-v2/service/s3"
-	"github.com/aws/aws-sdk-go-v2/service/ssm"
-	"github.com/aws/aws-sdk-go-v2/service/sts"
-	"github.com/gin-gonic/gin"
+	"github.com/2solt/aux-kxc/internal/handlers"
+	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/kelseyhightower/envconfig"
 )
 
-type Config struct {
-	VERSION string `envconfig:"VERSION" required:"true"`
-}
-
-type response struct {
-	Version string `json:"version"`
-	Data    any    `json:"data"`
-}
-
-type awsClients struct {
-	s3  *s3.Client
-	ssm *ssm.Client
-}
-
-func newAWSClients(ctx context.Context) (*awsClients, error) {
-	cfg, err := config.LoadDefaultConfig(ctx) // reads env vars automatically
+func main() {
+	var cfg handlers.Config
+	err := envconfig.Process(handlers.EnvPrefix(), &cfg)
 	if err != nil {
-		return nil, err
+		log.Fatal(err)
 	}
 
-	// validate credentials with a cheap sts call
-	stsClient := sts.NewFromConfig(cfg)
-	if _, err = stsClient.GetCallerIdentity(ctx, &sts.GetCallerIdentityInput{}); err != nil {
-		return nil, err
+	logger, err := handlers.NewLogger(cfg.LogFormat)
+	if err != nil {
+		log.Fatal(err)
 	}
+	slog.SetDefault(logger)
 
-	return &awsClients{
-		s3:  s3.NewFromConfig(cfg),
-		ssm: ssm.NewFromConfig(cfg),
-	}, nil
-}
-
-func listBucketsHandler(cl *awsClients, version string) gin.HandlerFunc {
-	return func(c *gin.Context) {
-		out, err := cl.s3.ListBuckets(c.Request.Context(), &s3.ListBucketsInput{})
-		if err != nil {
-			c.Status(http.StatusInternalServerError)
-			return
-		}
-		var names []string
-		for _, b := range out.Buckets {
-			names = append(names, *b.Name)
-		}
-		c.JSON(http.StatusOK, response{
-			Version: version,
-			Data:    names,
-		})
+	switch aws.RetryMode(cfg.AWSRetryMode) {
+	case aws.RetryModeStandard, aws.RetryModeAdaptive:
+	default:
+		log.Fatal("AWS_RETRY_MODE must be standard or adaptive")
 	}
-}
-
-func listParametersHandler(cl *awsClients, version string) gin.HandlerFunc {
-	return func(c *gin.Context) {
-		out, err := cl.ssm.DescribeParameters(c.Request.Context(), &ssm.DescribeParametersInput{})
-		if err != nil {
-			c.Status(http.StatusInternalServerError)
-			return
-		}
-		var names []string
-		for _, p := range out.Parameters {
-			names = append(names, *p.Name)
-		}
-		c.JSON(http.StatusOK, response{
-			Version: version,
-			Data:    names,
-		})
+	if cfg.AWSMaxRetries < 0 {
+		log.Fatal("AWS_MAX_RETRIES must not be negative")
 	}
-}
 
-func getParameterHandler(cl *awsClients, version string) gin.HandlerFunc {
-	return func(c *gin.Context) {
-		name := c.Param("name")
-		out, err := cl.ssm.GetParameter(c.Request.Context(), &ssm.GetParameterInput{
-			Name: &name,
-		})
-		if err != nil {
-			c.Status(http.StatusNotFound)
-			return
-		}
-		c.JSON(http.StatusOK, response{
-			Version: version,
-			Data:    *out.Parameter.Value,
-		})
+	if cfg.AsyncEnabled && (cfg.AsyncQueueURL == "" || cfg.AsyncResultsBucket == "") {
+		log.Fatal("ASYNC_ENABLED requires ASYNC_QUEUE_URL and ASYNC_RESULTS_BUCKET")
 	}
-}
-
-func livenessHandler(c *gin.Context) {
-	c.Status(http.StatusOK)
-}
-
-func main() {
-	var cfg Config
-	err := envconfig.Process("", &cfg)
-	if err != nil {
-		log.Fatal(err)
+	if cfg.CanaryPercent < 0 || cfg.CanaryPercent > 100 {
+		log.Fatal("CANARY_PERCENT must be between 0 and 100")
 	}
-
-	ctx := context.Background()
-	clients, err := newAWSClients(ctx)
-	if err != nil {
-		panic("AWS init failed: " + err.Error())
+	if cfg.CanaryPercent > 0 && cfg.CanaryVersion == "" {
+		log.Fatal("CANARY_PERCENT requires CANARY_VERSION")
+	}
+	if cfg.ParameterWatchInterval <= 0 {
+		log.Fatal("PARAMETER_WATCH_INTERVAL must be positive")
+	}
+	if (cfg.TLSCertFile == "") != (cfg.TLSKeyFile == "") {
+		log.Fatal("TLS_CERT_FILE and TLS_KEY_FILE must be set together")
+	}
+	if cfg.CredentialCheckTimeout <= 0 {
+		log.Fatal("CREDENTIAL_CHECK_TIMEOUT must be positive")
 	}
 
-	r := gin.Default()
-	r.GET("/buckets", listBucketsHandler(clients, cfg.VERSION))
-	r.GET("/parameters", listParametersHandler(clients, cfg.VERSION))
-	r.GET("/parameters/:name", getParameterHandler(clients, cfg.VERSION))
-
-	// Health entpoint
-	r.GET("/livez", livenessHandler)
-
-	addr := ":8081"
-	log.Printf("Service listening on %s", addr)
-	if err := r.Run(addr); err != nil {
-		log.Fatalf("router error: %v", err)
+	// cancelled on SIGINT or SIGTERM, which starts the graceful shutdown
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if err := handlers.Run(ctx, cfg, logger); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		log.Fatalf("server error: %v", err)
 	}
 }